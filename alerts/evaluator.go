@@ -0,0 +1,195 @@
+package alerts
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"dbtop/config"
+	"dbtop/monitor/stats"
+)
+
+// State is whether an alert started or stopped
+type State string
+
+const (
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+)
+
+// Alert is a notification about a rule that started or stopped breaching
+type Alert struct {
+	State     State     `json:"state"`
+	Instance  string    `json:"instance"`
+	Rule      string    `json:"rule"`
+	Condition string    `json:"condition"`
+	ProcessID int64     `json:"process_id,omitempty"`
+	Subject   string    `json:"subject,omitempty"` // the process a per-process alert is about
+	Since     time.Time `json:"since"`             // when the condition started to hold
+	Time      time.Time `json:"time"`
+}
+
+// Message returns a one-line description of the alert
+func (a Alert) Message() string {
+	message := fmt.Sprintf("[%s] %s: %s", a.State, a.Instance, a.Rule)
+	if a.Subject != "" {
+		message += " - " + a.Subject
+	}
+	if a.State == StateResolved {
+		return message + fmt.Sprintf(" (after %s)", a.Time.Sub(a.Since).Round(time.Second))
+	}
+	return message + " since " + a.Since.Local().Format(time.TimeOnly)
+}
+
+// Status is the outcome of evaluating the rules against one snapshot
+type Status struct {
+	// Processes are the IDs of the processes breaching a rule
+	Processes map[int64]bool
+	// Fields are the instance fields used by breaching instance rules
+	Fields map[string]bool
+	// Firing are the alerts that are currently firing
+	Firing []Alert
+}
+
+// alertKey identifies an alert: a rule, and for per-process rules a process
+type alertKey struct {
+	rule    int
+	process int64
+}
+
+// pending is a breach that started and may be firing
+type pending struct {
+	rule   *Rule
+	alert  Alert
+	firing bool
+}
+
+// Evaluator checks the rules of one instance against successive snapshots.
+// A rule fires once its condition held for the rule's duration, and is
+// not notified again until it resolves.
+type Evaluator struct {
+	instance string
+	rules    []*Rule
+	notify   func(Alert)
+	breaches map[alertKey]*pending
+}
+
+// NewEvaluator parses the rules of an instance. notify is called for every
+// alert that fires or resolves.
+func NewEvaluator(instance string, rules []config.AlertRule, notify func(Alert)) (*Evaluator, error) {
+	e := &Evaluator{
+		instance: instance,
+		notify:   notify,
+		breaches: make(map[alertKey]*pending),
+	}
+	for _, rule := range rules {
+		parsed, err := Parse(rule.Name, rule.Rule)
+		if err != nil {
+			return nil, fmt.Errorf("instance %s: %w", instance, err)
+		}
+		e.rules = append(e.rules, parsed)
+	}
+	return e, nil
+}
+
+// breach records that a rule's condition holds, starting the clock if it
+// did not hold before, and returns the key of the alert
+func (e *Evaluator) breach(key alertKey, rule *Rule, process *stats.ProcessInfo, now time.Time) alertKey {
+	if _, ok := e.breaches[key]; ok {
+		return key
+	}
+
+	alert := Alert{
+		State:     StateFiring,
+		Instance:  e.instance,
+		Rule:      rule.Name,
+		Condition: rule.Text,
+		Since:     now,
+	}
+	if process != nil {
+		alert.ProcessID = process.ID
+		alert.Subject = fmt.Sprintf("process %d (%s@%s)", process.ID, process.User, process.Host)
+	}
+	e.breaches[key] = &pending{rule: rule, alert: alert}
+	return key
+}
+
+// Evaluate checks the rules against a snapshot, fires and resolves alerts,
+// and returns what is breaching
+func (e *Evaluator) Evaluate(snapshot *stats.DatabaseStats) Status {
+	status := Status{
+		Processes: make(map[int64]bool),
+		Fields:    make(map[string]bool),
+	}
+	now := snapshot.Timestamp
+
+	breaching := make(map[alertKey]bool)
+	for i, rule := range e.rules {
+		if !rule.PerProcess {
+			if rule.Matches(snapshot, nil) {
+				breaching[e.breach(alertKey{i, 0}, rule, nil, now)] = true
+				for _, field := range rule.Fields {
+					status.Fields[field] = true
+				}
+			}
+			continue
+		}
+		for j := range snapshot.Processes {
+			process := &snapshot.Processes[j]
+			if rule.Matches(snapshot, process) {
+				breaching[e.breach(alertKey{i, process.ID}, rule, process, now)] = true
+				status.Processes[process.ID] = true
+			}
+		}
+	}
+
+	// Resolve the alerts whose condition no longer holds, including those
+	// of processes that went away
+	var notifications []Alert
+	for key, breach := range e.breaches {
+		if breaching[key] {
+			continue
+		}
+		delete(e.breaches, key)
+		if breach.firing {
+			resolved := breach.alert
+			resolved.State = StateResolved
+			resolved.Time = now
+			notifications = append(notifications, resolved)
+		}
+	}
+	sortAlerts(notifications)
+
+	var fired []Alert
+	for _, breach := range e.breaches {
+		if !breach.firing && now.Sub(breach.alert.Since) >= breach.rule.For {
+			breach.firing = true
+			breach.alert.Time = now
+			fired = append(fired, breach.alert)
+		}
+		if breach.firing {
+			status.Firing = append(status.Firing, breach.alert)
+		}
+	}
+	sortAlerts(fired)
+	sortAlerts(status.Firing)
+
+	for _, alert := range append(notifications, fired...) {
+		e.notify(alert)
+	}
+	return status
+}
+
+// sortAlerts orders alerts by when their condition started to hold
+func sortAlerts(alerts []Alert) {
+	sort.Slice(alerts, func(i, j int) bool {
+		a, b := alerts[i], alerts[j]
+		if !a.Since.Equal(b.Since) {
+			return a.Since.Before(b.Since)
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.ProcessID < b.ProcessID
+	})
+}
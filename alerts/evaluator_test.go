@@ -0,0 +1,87 @@
+package alerts
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"dbtop/config"
+	"dbtop/monitor/stats"
+)
+
+func TestEvaluator(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var notified []string
+	evaluator, err := NewEvaluator("prod", []config.AlertRule{
+		{Name: "connections", Rule: "active_connections > 200 for 1m"},
+		{Name: "long-query", Rule: "process.time > 300 and command != 'Sleep'"},
+	}, func(alert Alert) {
+		notified = append(notified, fmt.Sprintf("%s %s %d", alert.State, alert.Rule, alert.ProcessID))
+	})
+	if err != nil {
+		t.Fatalf("NewEvaluator failed: %v", err)
+	}
+
+	long := stats.ProcessInfo{ID: 7, User: "app", Host: "10.0.0.1", Command: "Query", Time: 400}
+	short := stats.ProcessInfo{ID: 8, User: "app", Command: "Query", Time: 10}
+
+	steps := []struct {
+		seconds     int
+		connections int64
+		processes   []stats.ProcessInfo
+		notified    []string
+		firing      int
+		fields      bool
+	}{
+		// Breaching, but not for a minute yet
+		{0, 250, []stats.ProcessInfo{long, short}, []string{"firing long-query 7"}, 1, true},
+		{30, 260, []stats.ProcessInfo{long, short}, nil, 1, true},
+		{60, 270, []stats.ProcessInfo{long, short}, []string{"firing connections 0"}, 2, true},
+		// Still breaching: no repeated notifications
+		{90, 280, []stats.ProcessInfo{long, short}, nil, 2, true},
+		// The process went away and the connections dropped
+		{120, 100, []stats.ProcessInfo{short}, []string{"resolved connections 0", "resolved long-query 7"}, 0, false},
+		// A short breach that recovers before the minute is never notified
+		{150, 300, nil, nil, 0, true},
+		{180, 100, nil, nil, 0, false},
+	}
+	for _, step := range steps {
+		notified = nil
+		status := evaluator.Evaluate(&stats.DatabaseStats{
+			Timestamp:         start.Add(time.Duration(step.seconds) * time.Second),
+			ActiveConnections: step.connections,
+			Processes:         step.processes,
+		})
+		if !reflect.DeepEqual(notified, step.notified) {
+			t.Errorf("at %ds: notified %v, want %v", step.seconds, notified, step.notified)
+		}
+		if len(status.Firing) != step.firing {
+			t.Errorf("at %ds: %d alerts firing, want %d", step.seconds, len(status.Firing), step.firing)
+		}
+		if status.Fields["active_connections"] != step.fields {
+			t.Errorf("at %ds: active_connections breaching = %v, want %v", step.seconds, status.Fields["active_connections"], step.fields)
+		}
+		wantProcess := step.seconds < 120
+		if status.Processes[7] != wantProcess || status.Processes[8] {
+			t.Errorf("at %ds: breaching processes %v", step.seconds, status.Processes)
+		}
+	}
+}
+
+func TestAlertMessage(t *testing.T) {
+	since := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	alert := Alert{
+		State:    StateResolved,
+		Instance: "prod",
+		Rule:     "long-query",
+		Subject:  "process 7 (app@10.0.0.1)",
+		Since:    since,
+		Time:     since.Add(90 * time.Second),
+	}
+	want := "[resolved] prod: long-query - process 7 (app@10.0.0.1) (after 1m30s)"
+	if got := alert.Message(); got != want {
+		t.Errorf("Message() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package alerts
+
+import (
+	"strings"
+
+	"dbtop/monitor/stats"
+)
+
+// field is a value a rule can compare. Exactly one of instance and process
+// is set.
+type field struct {
+	name     string
+	text     bool
+	instance func(s *stats.DatabaseStats) value
+	process  func(p *stats.ProcessInfo) value
+}
+
+// number returns a known numeric value
+func number(n float64) value {
+	return value{number: n, known: true}
+}
+
+// text returns a known string value
+func text(s string) value {
+	return value{text: &s, known: true}
+}
+
+// instanceFields are the fields of a snapshot, by name
+var instanceFields = map[string]field{
+	"active_connections": {instance: func(s *stats.DatabaseStats) value { return number(float64(s.ActiveConnections)) }},
+	"total_connections":  {instance: func(s *stats.DatabaseStats) value { return number(float64(s.TotalConnections)) }},
+	"queries_per_second": {instance: func(s *stats.DatabaseStats) value { return number(s.QueriesPerSecond) }},
+	"slow_queries":       {instance: func(s *stats.DatabaseStats) value { return number(float64(s.SlowQueries)) }},
+	"threads_running":    {instance: func(s *stats.DatabaseStats) value { return number(float64(s.Threads.Running)) }},
+	"threads_connected":  {instance: func(s *stats.DatabaseStats) value { return number(float64(s.Threads.Connected)) }},
+	"threads_sleeping":   {instance: func(s *stats.DatabaseStats) value { return number(float64(s.Threads.Sleeping)) }},
+	"threads_locked":     {instance: func(s *stats.DatabaseStats) value { return number(float64(s.Threads.Locked)) }},
+	"uptime":             {instance: func(s *stats.DatabaseStats) value { return number(s.Uptime.Seconds()) }},
+	"processes":          {instance: func(s *stats.DatabaseStats) value { return number(float64(len(s.Processes))) }},
+	"lock_waits":         {instance: func(s *stats.DatabaseStats) value { return number(float64(len(s.Locks))) }},
+	"replication_lag": {instance: func(s *stats.DatabaseStats) value {
+		if s.Replication == nil || !s.Replication.LagKnown {
+			return value{}
+		}
+		return number(s.Replication.Lag)
+	}},
+}
+
+// processFields are the fields of a process, by name. In rules they can be
+// written with or without the "process." prefix.
+var processFields = map[string]field{
+	"id":               {process: func(p *stats.ProcessInfo) value { return number(float64(p.ID)) }},
+	"user":             {text: true, process: func(p *stats.ProcessInfo) value { return text(p.User) }},
+	"host":             {text: true, process: func(p *stats.ProcessInfo) value { return text(p.Host) }},
+	"database":         {text: true, process: func(p *stats.ProcessInfo) value { return text(p.Database) }},
+	"command":          {text: true, process: func(p *stats.ProcessInfo) value { return text(p.Command) }},
+	"state":            {text: true, process: func(p *stats.ProcessInfo) value { return text(p.State) }},
+	"info":             {text: true, process: func(p *stats.ProcessInfo) value { return text(p.Info) }},
+	"time":             {process: func(p *stats.ProcessInfo) value { return number(float64(p.Time)) }},
+	"transaction_time": {process: func(p *stats.ProcessInfo) value { return number(float64(p.TransactionTime)) }},
+	"wait_event_type":  {text: true, process: func(p *stats.ProcessInfo) value { return text(p.WaitEventType) }},
+	"wait_event":       {text: true, process: func(p *stats.ProcessInfo) value { return text(p.WaitEvent) }},
+	"backend_type":     {text: true, process: func(p *stats.ProcessInfo) value { return text(p.BackendType) }},
+}
+
+// lookupField returns the field with the given name
+func lookupField(name string) (field, bool) {
+	name = strings.ToLower(name)
+	if f, ok := processFields[strings.TrimPrefix(name, "process.")]; ok {
+		f.name = "process." + strings.TrimPrefix(name, "process.")
+		return f, true
+	}
+	if f, ok := instanceFields[name]; ok {
+		f.name = name
+		return f, true
+	}
+	return field{}, false
+}
@@ -0,0 +1,255 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dbtop/config"
+)
+
+// notifyTimeout bounds how long a single notification may take
+const notifyTimeout = 10 * time.Second
+
+// Notifier delivers alerts to a destination
+type Notifier interface {
+	Notify(alert Alert) error
+}
+
+// payload is the JSON form of an alert sent to notifiers
+type payload struct {
+	Alert
+	Message string `json:"message"`
+}
+
+// encode returns the JSON form of an alert
+func encode(alert Alert) ([]byte, error) {
+	return json.Marshal(payload{alert, alert.Message()})
+}
+
+// NewNotifier creates the notifier described by a configuration entry
+func NewNotifier(notifier config.NotifierConfig) (Notifier, error) {
+	switch notifier.Type {
+	case "exec":
+		if len(notifier.Command) == 0 {
+			return nil, errors.New("exec notifier needs a command")
+		}
+		return &execNotifier{command: notifier.Command}, nil
+	case "file":
+		if notifier.Path == "" {
+			return nil, errors.New("file notifier needs a path")
+		}
+		return &fileNotifier{path: notifier.Path}, nil
+	case "webhook":
+		if notifier.URL == "" {
+			return nil, errors.New("webhook notifier needs a url")
+		}
+		return &webhookNotifier{
+			url:     notifier.URL,
+			headers: notifier.Headers,
+			client:  &http.Client{Timeout: notifyTimeout},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type '%s' (expected exec, file, or webhook)", notifier.Type)
+	}
+}
+
+// NewNotifiers creates the notifiers of the alerts configuration
+func NewNotifiers(notifiers []config.NotifierConfig) ([]Notifier, error) {
+	var result []Notifier
+	for i, notifier := range notifiers {
+		n, err := NewNotifier(notifier)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %d: %w", i+1, err)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// execNotifier runs a command for every alert. The alert is passed as JSON
+// on stdin and in DBTOP_ALERT_* environment variables.
+type execNotifier struct {
+	command []string
+}
+
+func (n *execNotifier) Notify(alert Alert) error {
+	data, err := encode(alert)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, n.command[0], n.command[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(),
+		"DBTOP_ALERT_STATE="+string(alert.State),
+		"DBTOP_ALERT_INSTANCE="+alert.Instance,
+		"DBTOP_ALERT_RULE="+alert.Rule,
+		"DBTOP_ALERT_CONDITION="+alert.Condition,
+		"DBTOP_ALERT_PROCESS_ID="+strconv.FormatInt(alert.ProcessID, 10),
+		"DBTOP_ALERT_MESSAGE="+alert.Message(),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to run %s: %w: %s", n.command[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// fileNotifier appends every alert to a file as a line of JSON
+type fileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (n *fileNotifier) Notify(alert Alert) error {
+	data, err := encode(alert)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open alert file: %w", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write alert file: %w", err)
+	}
+	return file.Close()
+}
+
+// webhookNotifier POSTs every alert as JSON to a URL
+type webhookNotifier struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (n *webhookNotifier) Notify(alert Alert) error {
+	data, err := encode(alert)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range n.headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := n.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", response.Status)
+	}
+	return nil
+}
+
+// dispatchQueue is the number of alerts a dispatcher buffers
+const dispatchQueue = 100
+
+// closeTimeout bounds how long Close waits for queued alerts
+const closeTimeout = 5 * time.Second
+
+// Dispatcher sends alerts to the notifiers in the background, in order,
+// so a slow webhook does not hold up monitoring
+type Dispatcher struct {
+	notifiers    []Notifier
+	onError      func(error)
+	closeTimeout time.Duration
+
+	mu       sync.Mutex
+	closed   bool
+	queue    chan Alert
+	done     chan struct{}
+	stop     chan struct{} // closed when Close gives up waiting
+	stopOnce sync.Once
+}
+
+// NewDispatcher starts a dispatcher. onError is called from the
+// background goroutine for every notification that fails.
+func NewDispatcher(notifiers []Notifier, onError func(error)) *Dispatcher {
+	d := &Dispatcher{
+		notifiers:    notifiers,
+		onError:      onError,
+		closeTimeout: closeTimeout,
+		queue:        make(chan Alert, dispatchQueue),
+		done:         make(chan struct{}),
+		stop:         make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// run delivers queued alerts until the dispatcher is closed
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	for alert := range d.queue {
+		for _, notifier := range d.notifiers {
+			select {
+			case <-d.stop:
+				return
+			default:
+			}
+			if err := notifier.Notify(alert); err != nil {
+				d.onError(fmt.Errorf("failed to send alert '%s': %w", alert.Rule, err))
+			}
+		}
+	}
+}
+
+// Send queues an alert for the notifiers. Alerts are dropped when the
+// queue is full or the dispatcher is closed.
+func (d *Dispatcher) Send(alert Alert) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed || len(d.notifiers) == 0 {
+		return
+	}
+	select {
+	case d.queue <- alert:
+	default:
+		d.onError(fmt.Errorf("alert queue is full, dropped alert '%s'", alert.Rule))
+	}
+}
+
+// Close delivers the queued alerts and stops the dispatcher. Alerts that
+// are not delivered within closeTimeout are dropped, so that quitting does
+// not hang on a notifier that is down.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	timer := time.NewTimer(d.closeTimeout)
+	defer timer.Stop()
+	select {
+	case <-d.done:
+	case <-timer.C:
+		d.stopOnce.Do(func() { close(d.stop) })
+	}
+}
@@ -0,0 +1,210 @@
+package alerts
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dbtop/config"
+)
+
+// testAlert is the alert sent in the notifier tests
+var testAlert = Alert{
+	State:     StateFiring,
+	Instance:  "prod",
+	Rule:      "connections",
+	Condition: "active_connections > 200",
+	Since:     time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	Time:      time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC),
+}
+
+// decodePayload parses the JSON form of an alert
+func decodePayload(t *testing.T, data []byte) payload {
+	t.Helper()
+	var p payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatalf("invalid alert JSON %q: %v", data, err)
+	}
+	return p
+}
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.log")
+	notifier, err := NewNotifier(config.NotifierConfig{Type: "file", Path: path})
+	if err != nil {
+		t.Fatalf("NewNotifier failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := notifier.Notify(testAlert); err != nil {
+			t.Fatalf("Notify failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	if p := decodePayload(t, []byte(lines[0])); p.Rule != "connections" || p.Message != testAlert.Message() {
+		t.Errorf("unexpected alert %+v", p)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	notifier, err := NewNotifier(config.NotifierConfig{
+		Type:    "webhook",
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	})
+	if err != nil {
+		t.Fatalf("NewNotifier failed: %v", err)
+	}
+	if err := notifier.Notify(testAlert); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q", header.Get("Content-Type"))
+	}
+	if p := decodePayload(t, body); p.State != StateFiring || p.Instance != "prod" {
+		t.Errorf("unexpected alert %+v", p)
+	}
+
+	rejected, _ := NewNotifier(config.NotifierConfig{Type: "webhook", URL: server.URL})
+	if err := rejected.Notify(testAlert); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Notify error = %v, want the 401 status", err)
+	}
+}
+
+func TestExecNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out")
+	notifier, err := NewNotifier(config.NotifierConfig{
+		Type:    "exec",
+		Command: []string{"sh", "-c", `{ echo "$DBTOP_ALERT_STATE $DBTOP_ALERT_RULE"; cat; } > "$0"`, path},
+	})
+	if err != nil {
+		t.Fatalf("NewNotifier failed: %v", err)
+	}
+	if err := notifier.Notify(testAlert); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, rest, _ := strings.Cut(string(data), "\n")
+	if first != "firing connections" {
+		t.Errorf("environment = %q, want \"firing connections\"", first)
+	}
+	if p := decodePayload(t, []byte(rest)); p.Condition != testAlert.Condition {
+		t.Errorf("unexpected alert %+v", p)
+	}
+
+	failing, _ := NewNotifier(config.NotifierConfig{Type: "exec", Command: []string{"sh", "-c", "echo boom; exit 3"}})
+	if err := failing.Notify(testAlert); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Notify error = %v, want the command output", err)
+	}
+}
+
+func TestNewNotifierErrors(t *testing.T) {
+	tests := []struct {
+		notifier config.NotifierConfig
+		want     string
+	}{
+		{config.NotifierConfig{Type: "exec"}, "needs a command"},
+		{config.NotifierConfig{Type: "file"}, "needs a path"},
+		{config.NotifierConfig{Type: "webhook"}, "needs a url"},
+		{config.NotifierConfig{Type: "pager"}, "unknown notifier type 'pager'"},
+	}
+	for _, tt := range tests {
+		_, err := NewNotifier(tt.notifier)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("NewNotifier(%+v) error = %v, want %q", tt.notifier, err, tt.want)
+		}
+	}
+}
+
+// recordingNotifier remembers the rules of the alerts it receives
+type recordingNotifier struct {
+	rules []string
+}
+
+func (n *recordingNotifier) Notify(alert Alert) error {
+	n.rules = append(n.rules, alert.Rule)
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	notifier := &recordingNotifier{}
+	dispatcher := NewDispatcher([]Notifier{notifier}, func(err error) {
+		t.Errorf("unexpected error: %v", err)
+	})
+	for _, rule := range []string{"a", "b", "c"} {
+		dispatcher.Send(Alert{Rule: rule})
+	}
+	dispatcher.Close()
+	// Sending after Close is ignored
+	dispatcher.Send(Alert{Rule: "d"})
+
+	if got := strings.Join(notifier.rules, ","); got != "a,b,c" {
+		t.Errorf("delivered %s, want a,b,c", got)
+	}
+}
+
+// blockingNotifier holds every notification until release is closed
+type blockingNotifier struct {
+	release chan struct{}
+	mu      sync.Mutex
+	sent    int
+}
+
+func (n *blockingNotifier) Notify(alert Alert) error {
+	<-n.release
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent++
+	return nil
+}
+
+func TestDispatcherCloseTimeout(t *testing.T) {
+	notifier := &blockingNotifier{release: make(chan struct{})}
+	dispatcher := NewDispatcher([]Notifier{notifier}, func(err error) {})
+	dispatcher.closeTimeout = 10 * time.Millisecond
+	for _, rule := range []string{"a", "b", "c"} {
+		dispatcher.Send(Alert{Rule: rule})
+	}
+
+	start := time.Now()
+	dispatcher.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close took %s with a notifier that is down", elapsed)
+	}
+
+	// The notification in flight finishes; the queued ones are dropped
+	close(notifier.release)
+	<-dispatcher.done
+	if notifier.sent != 1 {
+		t.Errorf("delivered %d alerts after Close gave up, want 1", notifier.sent)
+	}
+}
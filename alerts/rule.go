@@ -0,0 +1,388 @@
+// Package alerts evaluates threshold rules against database snapshots and
+// sends notifications when a rule starts or stops breaching.
+package alerts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"dbtop/monitor/stats"
+)
+
+// Rule is a parsed alert rule such as "active_connections > 200 for 1m"
+type Rule struct {
+	Name string
+	Text string
+	// For is how long the condition has to hold before the alert fires
+	For time.Duration
+	// PerProcess is set when the condition uses process fields. Such a
+	// rule is checked against every process separately.
+	PerProcess bool
+	// Fields are the instance fields the condition uses
+	Fields []string
+
+	condition node
+}
+
+// Matches reports whether the condition holds for a snapshot, and for a
+// process of it when the rule is per process
+func (r *Rule) Matches(snapshot *stats.DatabaseStats, process *stats.ProcessInfo) bool {
+	return r.condition.eval(env{snapshot, process})
+}
+
+// env is what a condition is evaluated against
+type env struct {
+	snapshot *stats.DatabaseStats
+	process  *stats.ProcessInfo
+}
+
+// node is a boolean expression
+type node interface {
+	eval(e env) bool
+}
+
+// logical combines two expressions with "and" or "or"
+type logical struct {
+	and         bool
+	left, right node
+}
+
+func (l logical) eval(e env) bool {
+	if l.and {
+		return l.left.eval(e) && l.right.eval(e)
+	}
+	return l.left.eval(e) || l.right.eval(e)
+}
+
+// negation inverts an expression
+type negation struct {
+	operand node
+}
+
+func (n negation) eval(e env) bool {
+	return !n.operand.eval(e)
+}
+
+// comparison compares two operands. A comparison with an unknown value,
+// such as the lag of a replica whose SQL thread is stopped, is false.
+type comparison struct {
+	op          string
+	left, right operand
+}
+
+func (c comparison) eval(e env) bool {
+	left, right := c.left.value(e), c.right.value(e)
+	if !left.known || !right.known {
+		return false
+	}
+
+	var order int
+	if left.text != nil {
+		order = strings.Compare(*left.text, *right.text)
+	} else {
+		switch {
+		case left.number < right.number:
+			order = -1
+		case left.number > right.number:
+			order = 1
+		}
+	}
+
+	switch c.op {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	case ">=":
+		return order >= 0
+	case "==":
+		return order == 0
+	default: // "!="
+		return order != 0
+	}
+}
+
+// value is the value of an operand: a number or, if text is set, a string
+type value struct {
+	number float64
+	text   *string
+	known  bool
+}
+
+// operand is a field or a literal
+type operand interface {
+	value(e env) value
+	isText() bool
+}
+
+// literal is a number, duration, or quoted string in a rule
+type literal struct {
+	v value
+}
+
+func (l literal) value(env) value { return l.v }
+func (l literal) isText() bool    { return l.v.text != nil }
+
+// fieldRef is a reference to an instance or process field
+type fieldRef struct {
+	field
+}
+
+func (f fieldRef) value(e env) value {
+	if f.process != nil {
+		if e.process == nil {
+			return value{}
+		}
+		return f.process(e.process)
+	}
+	return f.instance(e.snapshot)
+}
+
+func (f fieldRef) isText() bool { return f.text }
+
+// token is a lexical element of a rule
+type token struct {
+	kind string // "word", "string", "op", "(", ")", or "" at the end
+	text string
+}
+
+// tokenize splits a rule into tokens
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, token{string(r), string(r)})
+			i++
+		case r == '\'' || r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i+1)
+			}
+			tokens = append(tokens, token{"string", string(runes[i+1 : end])})
+			i = end + 1
+		case strings.ContainsRune("<>=!", r):
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			i += len(op)
+			switch op {
+			case "=":
+				op = "=="
+			case "!":
+				return nil, fmt.Errorf("unexpected '!' at position %d", i)
+			}
+			tokens = append(tokens, token{"op", op})
+		case isWordRune(r):
+			end := i
+			for end < len(runes) && isWordRune(runes[end]) {
+				end++
+			}
+			tokens = append(tokens, token{"word", string(runes[i:end])})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected '%c' at position %d", r, i+1)
+		}
+	}
+	return tokens, nil
+}
+
+// isWordRune reports whether r belongs to a field name, number, or duration
+func isWordRune(r rune) bool {
+	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// parser is a recursive descent parser over the tokens of a rule
+type parser struct {
+	tokens     []token
+	pos        int
+	perProcess bool
+	fields     []string
+}
+
+// peek returns the next token without consuming it
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{}
+}
+
+// next consumes and returns the next token
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// keyword reports whether the next token is the given keyword, consuming
+// it if so
+func (p *parser) keyword(word string) bool {
+	if t := p.peek(); t.kind == "word" && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// or parses expressions joined by "or"
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{false, left, right}
+	}
+	return left, nil
+}
+
+// and parses expressions joined by "and"
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{true, left, right}
+	}
+	return left, nil
+}
+
+// unary parses a negation, a parenthesized expression, or a comparison
+func (p *parser) unary() (node, error) {
+	if p.keyword("not") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negation{operand}, nil
+	}
+
+	if p.peek().kind == "(" {
+		p.next()
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		return expr, nil
+	}
+
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	if op.kind != "op" {
+		return nil, fmt.Errorf("expected a comparison operator after '%s'", p.tokens[p.pos-2].text)
+	}
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	if left.isText() != right.isText() {
+		return nil, fmt.Errorf("cannot compare text with a number in '%s %s %s'",
+			p.tokens[p.pos-3].text, op.text, p.tokens[p.pos-1].text)
+	}
+	return comparison{op.text, left, right}, nil
+}
+
+// operand parses a field name, a number, a duration, or a quoted string
+func (p *parser) operand() (operand, error) {
+	t := p.next()
+	switch t.kind {
+	case "string":
+		text := t.text
+		return literal{value{text: &text, known: true}}, nil
+	case "word":
+	case "":
+		return nil, fmt.Errorf("unexpected end of rule")
+	default:
+		return nil, fmt.Errorf("unexpected '%s'", t.text)
+	}
+
+	if number, err := strconv.ParseFloat(t.text, 64); err == nil {
+		return literal{value{number: number, known: true}}, nil
+	}
+	// Durations compare as seconds, e.g. "process.time > 5m"
+	if duration, err := time.ParseDuration(t.text); err == nil {
+		return literal{value{number: duration.Seconds(), known: true}}, nil
+	}
+
+	f, ok := lookupField(t.text)
+	if !ok {
+		return nil, fmt.Errorf("unknown field '%s'", t.text)
+	}
+	if f.process != nil {
+		p.perProcess = true
+	} else {
+		p.fields = append(p.fields, f.name)
+	}
+	return fieldRef{f}, nil
+}
+
+// Parse parses a rule of the form "<condition> [for <duration>]".
+// Conditions compare fields with numbers, durations, or quoted strings
+// using <, <=, >, >=, == (or =), and !=, and combine comparisons with
+// and, or, not, and parentheses.
+func Parse(name, text string) (*Rule, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule '%s': %w", text, err)
+	}
+
+	// A trailing "for <duration>" is the time the condition has to hold
+	var hold time.Duration
+	if n := len(tokens); n >= 2 && tokens[n-2].kind == "word" && strings.EqualFold(tokens[n-2].text, "for") {
+		hold, err = time.ParseDuration(tokens[n-1].text)
+		if err != nil || hold < 0 {
+			return nil, fmt.Errorf("invalid rule '%s': invalid duration '%s'", text, tokens[n-1].text)
+		}
+		tokens = tokens[:n-2]
+	}
+
+	p := &parser{tokens: tokens}
+	condition, err := p.or()
+	if err == nil && p.pos < len(tokens) {
+		err = fmt.Errorf("unexpected '%s'", tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule '%s': %w", text, err)
+	}
+
+	if name == "" {
+		name = text
+	}
+	return &Rule{
+		Name:       name,
+		Text:       text,
+		For:        hold,
+		PerProcess: p.perProcess,
+		Fields:     p.fields,
+		condition:  condition,
+	}, nil
+}
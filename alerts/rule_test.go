@@ -0,0 +1,80 @@
+package alerts
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"dbtop/monitor/stats"
+)
+
+func TestParse(t *testing.T) {
+	snapshot := &stats.DatabaseStats{
+		ActiveConnections: 250,
+		QueriesPerSecond:  12.5,
+		Threads:           stats.ThreadStats{Running: 3},
+		Replication:       &stats.Replication{Role: "replica"},
+	}
+	query := &stats.ProcessInfo{ID: 7, User: "app", Command: "Query", Time: 400}
+	sleeping := &stats.ProcessInfo{ID: 8, User: "app", Command: "Sleep", Time: 900}
+
+	tests := []struct {
+		rule       string
+		hold       time.Duration
+		perProcess bool
+		fields     []string
+		process    *stats.ProcessInfo
+		want       bool
+	}{
+		{rule: "active_connections > 200 for 1m", hold: time.Minute, fields: []string{"active_connections"}, want: true},
+		{rule: "active_connections > 300", fields: []string{"active_connections"}, want: false},
+		{rule: "200 < active_connections", fields: []string{"active_connections"}, want: true},
+		{rule: "queries_per_second >= 12.5 and threads_running = 3", fields: []string{"queries_per_second", "threads_running"}, want: true},
+		{rule: "threads_running > 5 or not (queries_per_second < 10)", fields: []string{"threads_running", "queries_per_second"}, want: true},
+		// Unknown values never compare
+		{rule: "replication_lag > 10", fields: []string{"replication_lag"}, want: false},
+		{rule: "replication_lag <= 10", fields: []string{"replication_lag"}, want: false},
+		{rule: "process.time > 300 and command != 'Sleep'", perProcess: true, process: query, want: true},
+		{rule: "process.time > 300 and command != 'Sleep'", perProcess: true, process: sleeping, want: false},
+		{rule: "time > 5m AND user == \"app\"", perProcess: true, process: query, want: true},
+		{rule: "process.time > 300 and active_connections > 100 for 30s", hold: 30 * time.Second, perProcess: true, fields: []string{"active_connections"}, process: query, want: true},
+	}
+	for _, tt := range tests {
+		rule, err := Parse("", tt.rule)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.rule, err)
+			continue
+		}
+		if rule.Name != tt.rule || rule.For != tt.hold || rule.PerProcess != tt.perProcess || strings.Join(rule.Fields, ",") != strings.Join(tt.fields, ",") {
+			t.Errorf("Parse(%q) = name %q, for %v, per process %v, fields %v; want for %v, per process %v, fields %v",
+				tt.rule, rule.Name, rule.For, rule.PerProcess, rule.Fields, tt.hold, tt.perProcess, tt.fields)
+		}
+		if got := rule.Matches(snapshot, tt.process); got != tt.want {
+			t.Errorf("%q matches = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"", "unexpected end of rule"},
+		{"active_connections >", "unexpected end of rule"},
+		{"connections > 200", "unknown field 'connections'"},
+		{"active_connections 200", "expected a comparison operator after 'active_connections'"},
+		{"command > 5", "cannot compare text with a number in 'command > 5'"},
+		{"(threads_running > 1", "missing ')'"},
+		{"threads_running > 1 threads_locked > 1", "unexpected 'threads_locked'"},
+		{"user == 'app", "unterminated string"},
+		{"threads_running ! 1", "unexpected '!'"},
+		{"threads_running > 1 for soon", "invalid duration 'soon'"},
+	}
+	for _, tt := range tests {
+		_, err := Parse("", tt.rule)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.rule, err, tt.want)
+		}
+	}
+}
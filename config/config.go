@@ -3,11 +3,17 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
+	"sort"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// DefaultQueryTimeout bounds the queries of one collection when the
+// instance does not set query_timeout
+const DefaultQueryTimeout = 5 * time.Second
+
 // DatabaseInstance represents a database instance configuration
 type DatabaseInstance struct {
 	Type            string            `yaml:"type"`
@@ -15,15 +21,149 @@ type DatabaseInstance struct {
 	Port            int               `yaml:"port"`
 	Username        string            `yaml:"username"`
 	Password        string            `yaml:"password"`
-	Database        string            `yaml:"database,omitempty"` // Optional - if not set, monitor all databases
+	PasswordEnv     string            `yaml:"password_env,omitempty"`     // Environment variable holding the password
+	PasswordFile    string            `yaml:"password_file,omitempty"`    // File holding the password
+	PasswordCommand string            `yaml:"password_command,omitempty"` // Shell command printing the password
+	Database        string            `yaml:"database,omitempty"`         // Optional - if not set, monitor all databases
+	Databases       *DatabaseFilter   `yaml:"databases,omitempty"`        // Optional - which databases to monitor when database is not set
 	SSLMode         string            `yaml:"ssl_mode,omitempty"`
 	RefreshInterval time.Duration     `yaml:"refresh_interval,omitempty"` // Default 2s if not set
+	QueryTimeout    time.Duration     `yaml:"query_timeout,omitempty"`    // Default 5s if not set
 	Options         map[string]string `yaml:"options,omitempty"`
+	TLS             *TLSConfig        `yaml:"tls,omitempty"` // Optional - connect over TLS when set
+	SSH             *SSHConfig        `yaml:"ssh,omitempty"` // Optional - connect through an SSH tunnel when set
+}
+
+// TLSConfig represents the TLS settings of an instance. The file settings
+// apply to MySQL, MariaDB, and PostgreSQL; Oracle uses a wallet instead.
+type TLSConfig struct {
+	CAFile     string `yaml:"ca_file,omitempty"`     // CA certificates to verify the server with
+	CertFile   string `yaml:"cert_file,omitempty"`   // Client certificate
+	KeyFile    string `yaml:"key_file,omitempty"`    // Client private key
+	ServerName string `yaml:"server_name,omitempty"` // Name expected in the server certificate; defaults to the host
+	ServerDN   string `yaml:"server_dn,omitempty"`   // Oracle: distinguished name expected in the server certificate
+	SkipVerify bool   `yaml:"skip_verify,omitempty"` // Encrypt without verifying the server certificate
+	Wallet     string `yaml:"wallet,omitempty"`      // Oracle wallet directory
+}
+
+// SSHConfig represents the SSH host that an instance is reached through.
+// The database host and port are dialed from the SSH host.
+type SSHConfig struct {
+	Host       string   `yaml:"host"`
+	Port       int      `yaml:"port,omitempty"` // Default 22 if not set
+	User       string   `yaml:"user"`
+	KeyFile    string   `yaml:"key_file,omitempty"`    // Private key to authenticate with
+	Agent      bool     `yaml:"agent,omitempty"`       // Authenticate with the keys in $SSH_AUTH_SOCK
+	KnownHosts string   `yaml:"known_hosts,omitempty"` // Default ~/.ssh/known_hosts if not set
+	Jump       []string `yaml:"jump,omitempty"`        // Hosts to connect through first, as [user@]host[:port]
+}
+
+// DatabaseFilter selects the databases of an instance by glob pattern.
+// PostgreSQL connects to each selected database to collect its tables.
+type DatabaseFilter struct {
+	Include []string `yaml:"include,omitempty"` // Databases to monitor; all if empty
+	Exclude []string `yaml:"exclude,omitempty"` // Databases to skip, even if included
+}
+
+// Match reports whether the named database is selected. A nil filter
+// selects every database.
+func (f *DatabaseFilter) Match(name string) bool {
+	if f == nil {
+		return true
+	}
+	for _, pattern := range f.Exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, pattern := range f.Include {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// check reports malformed patterns
+func (f *DatabaseFilter) check() error {
+	if f == nil {
+		return nil
+	}
+	for _, patterns := range [][]string{f.Include, f.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid database pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ExporterConfig represents the Prometheus exporter settings
+type ExporterConfig struct {
+	Listen string `yaml:"listen,omitempty"` // Default :9922 if not set
+}
+
+// AlertRule represents a threshold rule such as
+// "active_connections > 200 for 1m". In YAML a rule can be given as just
+// the rule text.
+type AlertRule struct {
+	Name string `yaml:"name,omitempty"` // Defaults to the rule text
+	Rule string `yaml:"rule"`
+}
+
+// UnmarshalYAML accepts either a plain rule string or a mapping
+func (r *AlertRule) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		r.Name = ""
+		r.Rule = node.Value
+		return nil
+	}
+	type plain AlertRule
+	return node.Decode((*plain)(r))
+}
+
+// NotifierConfig represents a destination for alert notifications
+type NotifierConfig struct {
+	Type    string            `yaml:"type"`              // exec, file, or webhook
+	Command []string          `yaml:"command,omitempty"` // exec: program and arguments
+	Path    string            `yaml:"path,omitempty"`    // file: file the alerts are appended to
+	URL     string            `yaml:"url,omitempty"`     // webhook: URL the alerts are POSTed to
+	Headers map[string]string `yaml:"headers,omitempty"` // webhook: extra request headers
+}
+
+// AlertsConfig represents the alert rules and where alerts are sent
+type AlertsConfig struct {
+	Rules     map[string][]AlertRule `yaml:"rules,omitempty"` // By instance name or glob pattern
+	Notifiers []NotifierConfig       `yaml:"notifiers,omitempty"`
+}
+
+// RulesFor returns the rules that apply to the named instance: those
+// listed under its name and under every glob pattern matching it
+func (a *AlertsConfig) RulesFor(instanceName string) []AlertRule {
+	var patterns []string
+	for pattern := range a.Rules {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	var rules []AlertRule
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, instanceName); ok {
+			rules = append(rules, a.Rules[pattern]...)
+		}
+	}
+	return rules
 }
 
 // Config represents the overall configuration structure
 type Config struct {
 	Instances map[string]DatabaseInstance `yaml:"instances"`
+	Exporter  ExporterConfig              `yaml:"exporter,omitempty"`
+	Alerts    AlertsConfig                `yaml:"alerts,omitempty"`
 }
 
 // Load reads and parses the configuration file
@@ -33,8 +173,17 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	// Replace ${VAR} references before decoding so they work in any field
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if err := expandEnv(&root); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
 	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	if err := root.Decode(&config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
@@ -44,12 +193,25 @@ func Load(configPath string) (*Config, error) {
 
 	// Set default refresh interval for instances that don't have it
 	for name, instance := range config.Instances {
+		if err := instance.checkPasswordSources(); err != nil {
+			return nil, fmt.Errorf("instance %s: %w", name, err)
+		}
+		if err := instance.Databases.check(); err != nil {
+			return nil, fmt.Errorf("instance %s: %w", name, err)
+		}
 		if instance.RefreshInterval == 0 {
 			instance.RefreshInterval = 2 * time.Second
 		}
+		if instance.QueryTimeout == 0 {
+			instance.QueryTimeout = DefaultQueryTimeout
+		}
 		config.Instances[name] = instance
 	}
 
+	if config.Exporter.Listen == "" {
+		config.Exporter.Listen = ":9922"
+	}
+
 	return &config, nil
 }
 
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a config file with owner-only permissions
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".dbtop")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadExpandsEnv(t *testing.T) {
+	t.Setenv("DBTOP_TEST_HOST", "db.example.com")
+	t.Setenv("DBTOP_TEST_PORT", "5433")
+	t.Setenv("DBTOP_TEST_USER", "monitor")
+
+	path := writeConfig(t, `
+instances:
+  prod:
+    type: postgres
+    host: ${DBTOP_TEST_HOST}
+    port: ${DBTOP_TEST_PORT}
+    username: "${DBTOP_TEST_USER}_ro"
+    password: "pa$${not_a_var}"
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	prod := cfg.Instances["prod"]
+	if prod.Host != "db.example.com" || prod.Port != 5433 || prod.Username != "monitor_ro" {
+		t.Errorf("got host %q, port %d, username %q", prod.Host, prod.Port, prod.Username)
+	}
+	if prod.Password != "pa${not_a_var}" {
+		t.Errorf("password = %q, want the escaped reference kept", prod.Password)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{
+			"instances:\n  prod:\n    host: ${DBTOP_TEST_UNSET}\n",
+			"line 3: environment variable DBTOP_TEST_UNSET is not set",
+		},
+		{
+			"instances:\n  prod:\n    password: secret\n    password_env: DB_PASSWORD\n",
+			"instance prod: only one of password, password_env may be set",
+		},
+		{
+			"instances:\n  prod:\n    databases:\n      exclude: [\"tmp[\"]\n",
+			`instance prod: invalid database pattern "tmp["`,
+		},
+	}
+	for _, tt := range tests {
+		_, err := Load(writeConfig(t, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Load error = %v, want %q", err, tt.want)
+		}
+	}
+}
+
+func TestDatabaseFilter(t *testing.T) {
+	filter := &DatabaseFilter{Include: []string{"shop", "analytics_*"}, Exclude: []string{"*_archive"}}
+	for name, want := range map[string]bool{
+		"shop":              true,
+		"analytics_eu":      true,
+		"analytics_archive": false,
+		"postgres":          false,
+		"shop_archive":      false,
+	} {
+		if got := filter.Match(name); got != want {
+			t.Errorf("Match(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	var none *DatabaseFilter
+	if !none.Match("postgres") {
+		t.Error("nil filter does not match every database")
+	}
+	exclude := &DatabaseFilter{Exclude: []string{"postgres"}}
+	if exclude.Match("postgres") || !exclude.Match("shop") {
+		t.Error("exclude-only filter does not match the other databases")
+	}
+}
+
+func TestResolvePassword(t *testing.T) {
+	t.Setenv("DBTOP_TEST_PASSWORD", "from-env")
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		instance DatabaseInstance
+		want     string
+		err      string
+	}{
+		{instance: DatabaseInstance{Password: "plain"}, want: "plain"},
+		{instance: DatabaseInstance{PasswordEnv: "DBTOP_TEST_PASSWORD"}, want: "from-env"},
+		{instance: DatabaseInstance{PasswordFile: file}, want: "from-file"},
+		{instance: DatabaseInstance{PasswordCommand: "printf 'from-command\\n'"}, want: "from-command"},
+		{instance: DatabaseInstance{PasswordEnv: "DBTOP_TEST_UNSET"}, err: "environment variable DBTOP_TEST_UNSET is not set"},
+		{instance: DatabaseInstance{PasswordFile: file + ".missing"}, err: "failed to read password file"},
+		{instance: DatabaseInstance{PasswordCommand: "exit 1"}, err: "failed to run password command"},
+		{instance: DatabaseInstance{PasswordCommand: "true"}, err: "password command printed nothing"},
+	}
+	for _, tt := range tests {
+		instance := tt.instance
+		err := instance.ResolvePassword()
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ResolvePassword(%+v) error = %v, want %q", tt.instance, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || instance.Password != tt.want {
+			t.Errorf("ResolvePassword(%+v) = %q, %v; want %q", tt.instance, instance.Password, err, tt.want)
+		}
+	}
+}
+
+func TestResolvePasswords(t *testing.T) {
+	t.Setenv("DBTOP_TEST_PASSWORD", "from-env")
+	instances := map[string]DatabaseInstance{
+		"a": {PasswordEnv: "DBTOP_TEST_PASSWORD"},
+		"b": {Password: "plain"},
+	}
+	if err := ResolvePasswords(instances); err != nil {
+		t.Fatal(err)
+	}
+	if instances["a"].Password != "from-env" || instances["b"].Password != "plain" {
+		t.Errorf("ResolvePasswords() = %+v", instances)
+	}
+
+	instances["c"] = DatabaseInstance{PasswordEnv: "DBTOP_TEST_UNSET"}
+	err := ResolvePasswords(instances)
+	if err == nil || !strings.HasPrefix(err.Error(), "instance c: failed to get password") {
+		t.Errorf("ResolvePasswords() error = %v, want instance c to fail", err)
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	path := writeConfig(t, "instances: {}\n")
+	if err := CheckPermissions(path); err != nil {
+		t.Errorf("CheckPermissions on a 0600 file: %v", err)
+	}
+
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPermissions(path); err == nil || !strings.Contains(err.Error(), "mode 0644") {
+		t.Errorf("CheckPermissions on a 0644 file: %v", err)
+	}
+}
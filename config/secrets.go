@@ -0,0 +1,166 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envReference matches ${VAR}, and $${ as an escaped literal ${
+var envReference = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${VAR} in every scalar of a YAML document with the
+// value of the environment variable. A variable that is not set is an
+// error rather than an empty string.
+func expandEnv(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && strings.Contains(node.Value, "${") {
+		var missing []string
+		value := envReference.ReplaceAllStringFunc(node.Value, func(match string) string {
+			if match == "$${" {
+				return "${"
+			}
+			name := match[2 : len(match)-1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return value
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("line %d: environment variable %s is not set", node.Line, strings.Join(missing, ", "))
+		}
+		node.Value = value
+		// Let plain scalars resolve again, so "${PORT}" can fill an int
+		if node.Style == 0 {
+			node.Tag = ""
+		}
+	}
+
+	for _, child := range node.Content {
+		if err := expandEnv(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPasswordSources returns an error if more than one way of getting
+// the password is configured
+func (di *DatabaseInstance) checkPasswordSources() error {
+	var sources []string
+	if di.Password != "" {
+		sources = append(sources, "password")
+	}
+	if di.PasswordEnv != "" {
+		sources = append(sources, "password_env")
+	}
+	if di.PasswordFile != "" {
+		sources = append(sources, "password_file")
+	}
+	if di.PasswordCommand != "" {
+		sources = append(sources, "password_command")
+	}
+	if len(sources) > 1 {
+		return fmt.Errorf("only one of %s may be set", strings.Join(sources, ", "))
+	}
+	return nil
+}
+
+// ExpandHome replaces a leading ~/ in a path with the home directory
+func ExpandHome(path string) (string, error) {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, rest), nil
+}
+
+// ResolvePassword fills in Password from password_env, password_file, or
+// password_command. A password command may prompt on the terminal, so this
+// has to happen before the terminal UI starts.
+func (di *DatabaseInstance) ResolvePassword() error {
+	switch {
+	case di.PasswordEnv != "":
+		password, ok := os.LookupEnv(di.PasswordEnv)
+		if !ok {
+			return fmt.Errorf("environment variable %s is not set", di.PasswordEnv)
+		}
+		di.Password = password
+	case di.PasswordFile != "":
+		path, err := ExpandHome(di.PasswordFile)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read password file: %w", err)
+		}
+		di.Password = strings.TrimRight(string(data), "\r\n")
+	case di.PasswordCommand != "":
+		// The command may prompt, e.g. to unlock a password manager
+		var stdout bytes.Buffer
+		cmd := exec.Command("sh", "-c", di.PasswordCommand)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to run password command: %w", err)
+		}
+		di.Password = strings.TrimRight(stdout.String(), "\r\n")
+		if di.Password == "" {
+			return errors.New("password command printed nothing")
+		}
+	}
+	return nil
+}
+
+// CheckPermissions returns an error if the configuration file is
+// accessible by users other than its owner, since it may contain
+// passwords or commands that are run
+func CheckPermissions(configPath string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		// Load reports a missing or unreadable file
+		return nil
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return fmt.Errorf("%s is accessible by group or others (mode %04o)", configPath, perm)
+	}
+	return nil
+}
+
+// ResolvePasswords resolves the passwords of the given instances in name
+// order, so that commands only run for the instances that are used and
+// their prompts appear in a predictable order
+func ResolvePasswords(instances map[string]DatabaseInstance) error {
+	names := make([]string, 0, len(instances))
+	for name := range instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		instance := instances[name]
+		if err := instance.ResolvePassword(); err != nil {
+			return fmt.Errorf("instance %s: failed to get password: %w", name, err)
+		}
+		instances[name] = instance
+	}
+	return nil
+}
@@ -1,16 +1,62 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"dbtop/config"
 	"dbtop/monitor"
 )
 
 func main() {
+	// Parse command line flags
+	flags := flag.NewFlagSet("dbtop", flag.ExitOnError)
+	format := flags.String("format", "ui", "output format: ui or json")
+	once := flags.Bool("once", false, "write a single snapshot and exit (implies --format json)")
+	all := flags.Bool("all", false, "show an overview of all configured instances")
+	output := flags.String("o", "", "recording file for the record command")
+	listen := flags.String("listen", "", "listen address for the exporter (default from config or :9922)")
+	insecureConfig := flags.Bool("insecure-config", false, "use the config file even if other users can access it")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dbtop [flags] [instance_name]")
+		fmt.Fprintln(flags.Output(), "       dbtop [flags] --all | instance_name_or_glob...")
+		fmt.Fprintln(flags.Output(), "       dbtop [flags] exporter [instance_name...]")
+		fmt.Fprintln(flags.Output(), "       dbtop record instance_name -o file")
+		fmt.Fprintln(flags.Output(), "       dbtop replay file")
+		flags.PrintDefaults()
+	}
+	args := parseArgs(flags, os.Args[1:])
+
+	if *once {
+		if flagSet(flags, "format") && *format != "json" {
+			fmt.Fprintf(os.Stderr, "--once writes JSON and cannot be combined with --format %s\n", *format)
+			os.Exit(2)
+		}
+		*format = "json"
+	}
+	if *format != "ui" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown format '%s' (expected ui or json)\n", *format)
+		os.Exit(2)
+	}
+
+	// Replaying a recording does not need the configuration
+	if len(args) > 0 && args[0] == "replay" {
+		if len(args) != 2 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		if err := monitor.StartReplay(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "dbtop: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Get configuration file path
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -18,16 +64,99 @@ func main() {
 	}
 	configPath := filepath.Join(homeDir, ".dbtop")
 
+	// The config file may hold passwords, so refuse to use one that other
+	// users can read or change
+	if err := config.CheckPermissions(configPath); err != nil && !*insecureConfig {
+		fmt.Fprintf(os.Stderr, "dbtop: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Run 'chmod 600 %s' or pass --insecure-config to use it anyway\n", configPath)
+		os.Exit(1)
+	}
+
 	// Load configuration
 	cfg, err := config.Load(configPath)
 	if err != nil {
 		log.Fatal("Failed to load configuration:", err)
 	}
 
+	// Serve Prometheus metrics for the given instances, or all of them
+	if len(args) > 0 && args[0] == "exporter" {
+		instances := cfg.Instances
+		if len(args) > 1 {
+			instances = make(map[string]config.DatabaseInstance)
+			for _, name := range args[1:] {
+				instance, exists := cfg.Instances[name]
+				if !exists {
+					fmt.Printf("Instance '%s' not found in configuration\n", name)
+					printInstances(cfg)
+					os.Exit(1)
+				}
+				instances[name] = instance
+			}
+		}
+
+		if *listen == "" {
+			*listen = cfg.Exporter.Listen
+		}
+		resolvePasswords(instances)
+		fmt.Printf("Serving metrics for %d instance(s) on %s/metrics\n", len(instances), *listen)
+		if err := monitor.StartExporter(instances, *listen); err != nil {
+			fmt.Fprintf(os.Stderr, "dbtop: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Record snapshots of an instance to a file
+	if len(args) > 0 && args[0] == "record" {
+		if len(args) != 2 || *output == "" {
+			flags.Usage()
+			os.Exit(2)
+		}
+		instance, exists := cfg.Instances[args[1]]
+		if !exists {
+			fmt.Printf("Instance '%s' not found in configuration\n", args[1])
+			printInstances(cfg)
+			os.Exit(1)
+		}
+
+		resolvePassword(args[1], &instance)
+		fmt.Fprintf(os.Stderr, "Recording %s to %s (Ctrl+C to stop)\n", args[1], *output)
+		if err := monitor.StartRecord(args[1], instance, *output); err != nil {
+			fmt.Fprintf(os.Stderr, "dbtop: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Show the overview dashboard for several instances
+	if *all || len(args) > 1 || (len(args) == 1 && isGlob(args[0])) {
+		if *format != "ui" {
+			fmt.Fprintln(os.Stderr, "The overview only supports --format ui")
+			os.Exit(2)
+		}
+
+		instances := cfg.Instances
+		if !*all {
+			instances, err = matchInstances(cfg, args)
+			if err != nil {
+				fmt.Println(err)
+				printInstances(cfg)
+				os.Exit(1)
+			}
+		}
+
+		resolvePasswords(instances)
+		if err := monitor.StartOverview(instances, cfg.Alerts); err != nil {
+			fmt.Fprintf(os.Stderr, "dbtop: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Determine which database instance to monitor
 	var instanceName string
-	if len(os.Args) > 1 {
-		instanceName = os.Args[1]
+	if len(args) > 0 {
+		instanceName = args[0]
 	} else {
 		// If no instance specified and only one exists, use it as default
 		if len(cfg.Instances) == 1 {
@@ -37,10 +166,7 @@ func main() {
 			}
 		} else {
 			fmt.Println("Usage: dbtop [instance_name]")
-			fmt.Println("Available instances:")
-			for name := range cfg.Instances {
-				fmt.Printf("  - %s\n", name)
-			}
+			printInstances(cfg)
 			os.Exit(1)
 		}
 	}
@@ -49,14 +175,107 @@ func main() {
 	instance, exists := cfg.Instances[instanceName]
 	if !exists {
 		fmt.Printf("Instance '%s' not found in configuration\n", instanceName)
-		fmt.Println("Available instances:")
-		for name := range cfg.Instances {
-			fmt.Printf("  - %s\n", name)
-		}
+		printInstances(cfg)
 		os.Exit(1)
 	}
+	resolvePassword(instanceName, &instance)
+
+	// Stream snapshots without the terminal UI
+	if *format == "json" {
+		if err := monitor.StartJSON(instanceName, instance, os.Stdout, *once); err != nil {
+			fmt.Fprintf(os.Stderr, "dbtop: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Start monitoring
 	fmt.Printf("Starting monitoring for instance: %s (%s)\n", instanceName, instance.Type)
-	monitor.Start(instanceName, instance)
+	if err := monitor.Start(instanceName, instance, cfg.Alerts); err != nil {
+		fmt.Fprintf(os.Stderr, "dbtop: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// parseArgs parses flags that may appear before or after positional
+// arguments (e.g. "dbtop prod --once") and returns the positional arguments.
+// Everything after "--" is positional.
+func parseArgs(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		flags.Parse(args)
+		rest := flags.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...)
+		}
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// flagSet reports whether the named flag was given on the command line
+func flagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// resolvePasswords runs the password sources of the instances once, before
+// any UI takes over the terminal, and exits if one of them fails
+func resolvePasswords(instances map[string]config.DatabaseInstance) {
+	if err := config.ResolvePasswords(instances); err != nil {
+		fmt.Fprintf(os.Stderr, "dbtop: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// resolvePassword is resolvePasswords for a single instance
+func resolvePassword(name string, instance *config.DatabaseInstance) {
+	if err := instance.ResolvePassword(); err != nil {
+		fmt.Fprintf(os.Stderr, "dbtop: instance %s: failed to get password: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// printInstances lists the configured instance names
+func printInstances(cfg *config.Config) {
+	fmt.Println("Available instances:")
+	for name := range cfg.Instances {
+		fmt.Printf("  - %s\n", name)
+	}
+}
+
+// isGlob reports whether an instance argument is a glob pattern
+func isGlob(arg string) bool {
+	return strings.ContainsAny(arg, "*?[")
+}
+
+// matchInstances returns the instances matching the given names or glob
+// patterns. Every argument has to match at least one instance.
+func matchInstances(cfg *config.Config, patterns []string) (map[string]config.DatabaseInstance, error) {
+	instances := make(map[string]config.DatabaseInstance)
+	for _, pattern := range patterns {
+		matched := false
+		for name, instance := range cfg.Instances {
+			ok, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid instance pattern '%s': %v", pattern, err)
+			}
+			if ok {
+				instances[name] = instance
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("Instance '%s' not found in configuration", pattern)
+		}
+	}
+	return instances, nil
 }
@@ -0,0 +1,28 @@
+package monitor
+
+import (
+	"fmt"
+
+	"dbtop/alerts"
+	"dbtop/config"
+	"dbtop/ui"
+)
+
+// newDispatcher creates the dispatcher that sends alerts to the configured
+// notifiers. Notifier failures go to the error log.
+func newDispatcher(alertsConfig config.AlertsConfig, errorLog *ui.ErrorLog) (*alerts.Dispatcher, error) {
+	notifiers, err := alerts.NewNotifiers(alertsConfig.Notifiers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up alerts: %w", err)
+	}
+	return alerts.NewDispatcher(notifiers, errorLog.Add), nil
+}
+
+// newEvaluator creates the evaluator for the alert rules of an instance
+func newEvaluator(instanceName string, alertsConfig config.AlertsConfig, dispatcher *alerts.Dispatcher) (*alerts.Evaluator, error) {
+	evaluator, err := alerts.NewEvaluator(instanceName, alertsConfig.RulesFor(instanceName), dispatcher.Send)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up alerts: %w", err)
+	}
+	return evaluator, nil
+}
@@ -0,0 +1,84 @@
+package drivers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"dbtop/monitor/stats"
+)
+
+// mysqlStatements returns all statement digests from performance_schema,
+// shared by MySQL and MariaDB. The sampler ranks them by their time since
+// the previous refresh, so a digest that only just became busy is not cut
+// off by its all-time total. When performance_schema or digest collection
+// is disabled, it returns a message explaining how to enable it instead.
+func mysqlStatements(ctx context.Context, db *sql.DB, database string) ([]stats.Statement, string) {
+	var enabled bool
+	if err := db.QueryRowContext(ctx, "SELECT @@performance_schema").Scan(&enabled); err != nil {
+		return nil, fmt.Sprintf("failed to check performance_schema: %v", err)
+	}
+	if !enabled {
+		return nil, "performance_schema is disabled; set performance_schema = ON in the server configuration and restart the server"
+	}
+
+	var consumer string
+	err := db.QueryRowContext(ctx, "SELECT ENABLED FROM performance_schema.setup_consumers WHERE NAME = 'statements_digest'").Scan(&consumer)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Sprintf("failed to check the statements_digest consumer: %v", err)
+	}
+	if consumer == "NO" {
+		return nil, "statement digests are disabled; run UPDATE performance_schema.setup_consumers SET ENABLED = 'YES' WHERE NAME = 'statements_digest'"
+	}
+
+	// Timers are in picoseconds
+	query := `
+		SELECT
+			DIGEST,
+			SCHEMA_NAME,
+			DIGEST_TEXT,
+			COUNT_STAR,
+			SUM_TIMER_WAIT / 1000000000,
+			SUM_ROWS_SENT,
+			SUM_ROWS_EXAMINED,
+			SUM_NO_INDEX_USED
+		FROM performance_schema.events_statements_summary_by_digest
+	`
+
+	var rows *sql.Rows
+	if database != "" {
+		rows, err = db.QueryContext(ctx, query+" WHERE SCHEMA_NAME = ?", database)
+	} else {
+		rows, err = db.QueryContext(ctx, query)
+	}
+	if err != nil {
+		return nil, fmt.Sprintf("failed to read statement digests: %v", err)
+	}
+	defer rows.Close()
+
+	var statements []stats.Statement
+	for rows.Next() {
+		var statement stats.Statement
+		var digest, schema, text sql.NullString
+
+		if err := rows.Scan(&digest, &schema, &text,
+			&statement.Total.Calls, &statement.Total.Time, &statement.Total.Rows,
+			&statement.Total.RowsExamined, &statement.Total.NoIndexUsed); err != nil {
+			return nil, fmt.Sprintf("failed to read statement digests: %v", err)
+		}
+		statement.ID = schema.String + "/" + digest.String
+		statement.Database = schema.String
+		statement.Query = text.String
+		if !digest.Valid {
+			// Statements that did not fit in the digest table are counted
+			// in a single row without a digest
+			statement.Query = "(other statements)"
+		}
+
+		statements = append(statements, statement)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Sprintf("failed to read statement digests: %v", err)
+	}
+	return statements, ""
+}
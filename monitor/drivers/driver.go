@@ -1,6 +1,7 @@
 package drivers
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -8,10 +9,100 @@ import (
 	"dbtop/monitor/stats"
 )
 
-// Driver defines the interface for database drivers
+// Driver defines the interface for database drivers. The context passed to
+// each method bounds every query it runs.
 type Driver interface {
-	Connect(instance config.DatabaseInstance) (*sql.DB, error)
-	GetStats(db *sql.DB, database string) (*stats.DatabaseStats, error)
+	// Connect opens a connection to the instance and detects its server
+	Connect(ctx context.Context, instance config.DatabaseInstance) (*Conn, error)
+	// ServerInfo queries the flavor, version, and edition of the server
+	ServerInfo(ctx context.Context, db *sql.DB) (stats.ServerInfo, error)
+	// Capabilities returns the optional features the server supports
+	Capabilities(server stats.ServerInfo) stats.Capabilities
+	// Collect takes a snapshot of the server, skipping the features it
+	// does not support
+	Collect(ctx context.Context, conn *Conn, database string) (*stats.DatabaseStats, error)
+	// KillProcess terminates the connection of the given process
+	KillProcess(ctx context.Context, conn *Conn, process stats.ProcessInfo) error
+	// CancelQuery aborts the statement the process is running but keeps
+	// its connection open
+	CancelQuery(ctx context.Context, conn *Conn, process stats.ProcessInfo) error
+	// Explain returns the execution plan of the statement the process is
+	// running
+	Explain(ctx context.Context, conn *Conn, process stats.ProcessInfo) (*stats.QueryPlan, error)
+}
+
+// Conn is an open connection to a monitored server
+type Conn struct {
+	DB           *sql.DB
+	Server       stats.ServerInfo
+	Capabilities stats.Capabilities
+
+	// openDatabase opens a handle to another database on the server, for
+	// drivers that collect some statistics database by database. It is nil
+	// when the instance is limited to one database.
+	openDatabase func(name string) (*sql.DB, error)
+	databases    *config.DatabaseFilter // which databases openDatabase is used for
+	handles      map[string]*sql.DB     // handles opened by openDatabase, by name
+}
+
+// Close closes the database handle and the handles to other databases
+func (c *Conn) Close() error {
+	for name := range c.handles {
+		c.closeDatabase(name)
+	}
+	return c.DB.Close()
+}
+
+// database returns a handle to another database on the server. Handles
+// are kept until the connection is closed, so that collecting does not
+// connect to every database each time.
+func (c *Conn) database(name string) (*sql.DB, error) {
+	if db, ok := c.handles[name]; ok {
+		return db, nil
+	}
+	db, err := c.openDatabase(name)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if c.handles == nil {
+		c.handles = make(map[string]*sql.DB)
+	}
+	c.handles[name] = db
+	return db, nil
+}
+
+// closeDatabase closes the handle to another database, e.g. one that was
+// dropped
+func (c *Conn) closeDatabase(name string) {
+	if db, ok := c.handles[name]; ok {
+		db.Close()
+		delete(c.handles, name)
+	}
+}
+
+// newConn wraps an open database handle and detects its server. When the
+// version cannot be read, e.g. for lack of privileges, the server is
+// treated as a recent one of the given flavor.
+func newConn(ctx context.Context, d Driver, db *sql.DB, flavor string) *Conn {
+	server, err := d.ServerInfo(ctx, db)
+	if err != nil {
+		server = stats.ServerInfo{Flavor: flavor}
+	}
+	return &Conn{DB: db, Server: server, Capabilities: d.Capabilities(server)}
+}
+
+// optional records the failure of an optional part of a snapshot, such as
+// the lock waits or the replication status. These views often need
+// privileges the monitoring user lacks, so instead of failing the snapshot
+// the error is kept as a warning and the part is left empty. It reports
+// whether err is nil.
+func optional(result *stats.DatabaseStats, what string, err error) bool {
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("failed to get %s: %v", what, err))
+		return false
+	}
+	return true
 }
 
 var drivers = make(map[string]Driver)
@@ -0,0 +1,70 @@
+package drivers
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"dbtop/monitor/stats"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newMock returns a database whose queries are checked against the
+// expectations registered on the mock
+func newMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sql mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, mock
+}
+
+// recentConn wraps a mock database in a connection to a server that
+// supports every feature
+func recentConn(db *sql.DB) *Conn {
+	return &Conn{DB: db, Capabilities: stats.AllCapabilities}
+}
+
+// fixture returns the rows recorded from a server in testdata/name. The
+// first line of the CSV file holds the column names; NULL stands for a
+// null value.
+func fixture(t *testing.T, name string) *sqlmock.Rows {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	header, body, _ := strings.Cut(string(data), "\n")
+	return sqlmock.NewRows(strings.Split(header, ",")).FromCSVString(body)
+}
+
+// checkStats compares a snapshot with the expected one, ignoring the
+// collection timestamp
+func checkStats(t *testing.T, got, want *stats.DatabaseStats) {
+	t.Helper()
+	if got.Timestamp.IsZero() {
+		t.Error("Timestamp is not set")
+	}
+	copied := *got
+	copied.Timestamp = want.Timestamp
+	if !reflect.DeepEqual(&copied, want) {
+		t.Errorf("unexpected stats\n got: %+v\nwant: %+v", &copied, want)
+	}
+}
+
+func TestGetDriver(t *testing.T) {
+	for _, name := range []string{"mysql", "mariadb", "postgres", "postgresql"} {
+		if _, err := GetDriver(name); err != nil {
+			t.Errorf("GetDriver(%q) failed: %v", name, err)
+		}
+	}
+	if _, err := GetDriver("sybase"); err == nil {
+		t.Error("GetDriver(\"sybase\") succeeded, want error")
+	}
+}
@@ -0,0 +1,109 @@
+package drivers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"dbtop/monitor/stats"
+)
+
+// jsonPlan converts a JSON execution plan into a tree, keeping the key
+// order of the document. Objects become nodes named after their key, scalar
+// values become "key: value" leaves, and the objects of an array are merged
+// into the array's node so that lists like MySQL's nested_loop read as a
+// sequence of steps.
+func jsonPlan(document string) ([]*stats.PlanNode, error) {
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+
+	root := &stats.PlanNode{}
+	if _, _, err := decodeJSON(decoder, root); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %w", err)
+	}
+	return root.Children, nil
+}
+
+// decodeJSON reads the next value from the decoder. Scalars are returned as
+// text, while the members of objects and the elements of arrays are attached
+// to node.
+func decodeJSON(decoder *json.Decoder, node *stats.PlanNode) (string, bool, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return "", false, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return "", false, err
+			}
+			child := &stats.PlanNode{Label: fmt.Sprint(key)}
+			scalar, isScalar, err := decodeJSON(decoder, child)
+			if err != nil {
+				return "", false, err
+			}
+			if isScalar {
+				child.Label += ": " + scalar
+			}
+			node.Children = append(node.Children, child)
+		}
+	case json.Delim('['):
+		for decoder.More() {
+			scalar, isScalar, err := decodeJSON(decoder, node)
+			if err != nil {
+				return "", false, err
+			}
+			if isScalar {
+				node.Children = append(node.Children, &stats.PlanNode{Label: scalar})
+			}
+		}
+	default:
+		if token == nil {
+			return "null", true, nil
+		}
+		return fmt.Sprint(token), true, nil
+	}
+
+	// Consume the closing delimiter
+	if _, err := decoder.Token(); err != nil {
+		return "", false, err
+	}
+	return "", false, nil
+}
+
+// tabularPlan turns the rows of a classic tabular EXPLAIN into one node per
+// row, listing the non-empty columns
+func tabularPlan(rows *sql.Rows) ([]*stats.PlanNode, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []*stats.PlanNode
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		var parts []string
+		for i, value := range values {
+			if value.Valid && value.String != "" {
+				parts = append(parts, columns[i]+"="+value.String)
+			}
+		}
+		nodes = append(nodes, &stats.PlanNode{Label: strings.Join(parts, " ")})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
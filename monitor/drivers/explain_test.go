@@ -0,0 +1,51 @@
+package drivers
+
+import (
+	"reflect"
+	"testing"
+
+	"dbtop/monitor/stats"
+)
+
+func TestJSONPlan(t *testing.T) {
+	document := `{
+		"query_block": {
+			"select_id": 1,
+			"nested_loop": [
+				{"table": {"table_name": "orders", "access_type": "ALL"}},
+				{"table": {"table_name": "items", "used_columns": ["id", "qty"]}}
+			]
+		}
+	}`
+
+	want := []*stats.PlanNode{
+		{Label: "query_block", Children: []*stats.PlanNode{
+			{Label: "select_id: 1"},
+			{Label: "nested_loop", Children: []*stats.PlanNode{
+				{Label: "table", Children: []*stats.PlanNode{
+					{Label: "table_name: orders"},
+					{Label: "access_type: ALL"},
+				}},
+				{Label: "table", Children: []*stats.PlanNode{
+					{Label: "table_name: items"},
+					{Label: "used_columns", Children: []*stats.PlanNode{
+						{Label: "id"},
+						{Label: "qty"},
+					}},
+				}},
+			}},
+		}},
+	}
+
+	got, err := jsonPlan(document)
+	if err != nil {
+		t.Fatalf("jsonPlan failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected plan tree: %+v", got)
+	}
+
+	if _, err := jsonPlan(`{"query_block": `); err == nil {
+		t.Error("jsonPlan succeeded on truncated input, want error")
+	}
+}
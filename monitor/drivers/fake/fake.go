@@ -0,0 +1,169 @@
+// Package fake provides a scripted database driver for tests. It returns a
+// predefined sequence of statistics instead of querying a server and
+// records the process actions it is asked to perform.
+package fake
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"dbtop/config"
+	"dbtop/monitor/drivers"
+	"dbtop/monitor/stats"
+)
+
+// Driver is a drivers.Driver that replays scripted statistics
+type Driver struct {
+	mu     sync.Mutex
+	script []*stats.DatabaseStats
+	next   int
+
+	// Server is returned by ServerInfo, with the flavor defaulting to
+	// "fake"
+	Server stats.ServerInfo
+	// Unsupported lists the capabilities the server lacks
+	Unsupported stats.Capabilities
+
+	// ConnectErr, when set, is returned by Connect
+	ConnectErr error
+	// StatsErr, when set, is returned by Collect
+	StatsErr error
+	// PingErr, when set, is returned when pinging a connection, which
+	// makes the connection look lost
+	PingErr error
+	// Plan is returned by Explain
+	Plan *stats.QueryPlan
+
+	// Killed and Cancelled record the processes passed to KillProcess and
+	// CancelQuery
+	Killed    []stats.ProcessInfo
+	Cancelled []stats.ProcessInfo
+}
+
+// New creates a driver that returns the given snapshots in order and keeps
+// repeating the last one when the script runs out
+func New(script ...*stats.DatabaseStats) *Driver {
+	return &Driver{script: script}
+}
+
+// Register creates a scripted driver and registers it under name
+func Register(name string, script ...*stats.DatabaseStats) *Driver {
+	d := New(script...)
+	drivers.RegisterDriver(name, d)
+	return d
+}
+
+func (d *Driver) Connect(ctx context.Context, instance config.DatabaseInstance) (*drivers.Conn, error) {
+	d.mu.Lock()
+	err := d.ConnectErr
+	d.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	db := sql.OpenDB(connector{d})
+	server, _ := d.ServerInfo(ctx, db)
+	return &drivers.Conn{DB: db, Server: server, Capabilities: d.Capabilities(server)}, nil
+}
+
+func (d *Driver) ServerInfo(ctx context.Context, db *sql.DB) (stats.ServerInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	server := d.Server
+	if server.Flavor == "" {
+		server.Flavor = "fake"
+	}
+	return server, nil
+}
+
+func (d *Driver) Capabilities(server stats.ServerInfo) stats.Capabilities {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return stats.AllCapabilities &^ d.Unsupported
+}
+
+func (d *Driver) Collect(ctx context.Context, conn *drivers.Conn, database string) (*stats.DatabaseStats, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.StatsErr != nil {
+		return nil, d.StatsErr
+	}
+	if len(d.script) == 0 {
+		return &stats.DatabaseStats{Timestamp: time.Now()}, nil
+	}
+
+	index := min(d.next, len(d.script)-1)
+	d.next++
+
+	// Hand out a copy so callers can modify it, e.g. to fill in rates
+	snapshot := *d.script[index]
+	if snapshot.Timestamp.IsZero() {
+		snapshot.Timestamp = time.Now()
+	}
+	if database != "" {
+		var processes []stats.ProcessInfo
+		for _, process := range snapshot.Processes {
+			if process.Database == database {
+				processes = append(processes, process)
+			}
+		}
+		snapshot.Processes = processes
+	}
+	return &snapshot, nil
+}
+
+func (d *Driver) KillProcess(ctx context.Context, conn *drivers.Conn, process stats.ProcessInfo) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Killed = append(d.Killed, process)
+	return nil
+}
+
+func (d *Driver) CancelQuery(ctx context.Context, conn *drivers.Conn, process stats.ProcessInfo) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Cancelled = append(d.Cancelled, process)
+	return nil
+}
+
+func (d *Driver) Explain(ctx context.Context, conn *drivers.Conn, process stats.ProcessInfo) (*stats.QueryPlan, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.Plan == nil {
+		return nil, fmt.Errorf("no plan for process %d", process.ID)
+	}
+	return d.Plan, nil
+}
+
+// errNoQueries is returned when something tries to query the fake database
+var errNoQueries = errors.New("fake database does not run queries")
+
+// connector opens connections to a database that accepts no statements,
+// which lets Connect return a usable *sql.DB without a server
+type connector struct{ d *Driver }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return conn{c.d}, nil }
+func (c connector) Driver() driver.Driver                        { return sqlDriver{c.d} }
+
+type sqlDriver struct{ d *Driver }
+
+func (s sqlDriver) Open(string) (driver.Conn, error) { return conn{s.d}, nil }
+
+type conn struct{ d *Driver }
+
+func (conn) Prepare(string) (driver.Stmt, error) { return nil, errNoQueries }
+func (conn) Close() error                        { return nil }
+func (conn) Begin() (driver.Tx, error)           { return nil, errNoQueries }
+
+// Ping returns the driver's PingErr
+func (c conn) Ping(context.Context) error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	return c.d.PingErr
+}
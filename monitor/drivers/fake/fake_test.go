@@ -0,0 +1,92 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"dbtop/config"
+	"dbtop/monitor/drivers"
+	"dbtop/monitor/stats"
+)
+
+func TestScriptedStats(t *testing.T) {
+	d := Register("fake-script",
+		&stats.DatabaseStats{ActiveConnections: 1},
+		&stats.DatabaseStats{
+			ActiveConnections: 2,
+			Processes: []stats.ProcessInfo{
+				{ID: 1, Database: "shop"},
+				{ID: 2, Database: "crm"},
+			},
+		},
+	)
+
+	registered, err := drivers.GetDriver("fake-script")
+	if err != nil {
+		t.Fatalf("GetDriver failed: %v", err)
+	}
+	conn, err := registered.Connect(context.Background(), config.DatabaseInstance{Type: "fake-script"})
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer conn.Close()
+
+	for i, want := range []int64{1, 2, 2} {
+		got, err := d.Collect(context.Background(), conn, "shop")
+		if err != nil {
+			t.Fatalf("Collect #%d failed: %v", i, err)
+		}
+		if got.ActiveConnections != want {
+			t.Errorf("Collect #%d: ActiveConnections = %d, want %d", i, got.ActiveConnections, want)
+		}
+		if got.Timestamp.IsZero() {
+			t.Errorf("Collect #%d: Timestamp is not set", i)
+		}
+		if want == 2 && (len(got.Processes) != 1 || got.Processes[0].ID != 1) {
+			t.Errorf("Collect #%d: processes not filtered by database: %+v", i, got.Processes)
+		}
+	}
+}
+
+func TestErrorsAndActions(t *testing.T) {
+	d := New()
+	d.ConnectErr = errors.New("refused")
+	if _, err := d.Connect(context.Background(), config.DatabaseInstance{}); err == nil {
+		t.Error("Connect succeeded, want error")
+	}
+
+	d.StatsErr = errors.New("timeout")
+	if _, err := d.Collect(context.Background(), nil, ""); err == nil {
+		t.Error("Collect succeeded, want error")
+	}
+
+	process := stats.ProcessInfo{ID: 9}
+	d.KillProcess(context.Background(), nil, process)
+	d.CancelQuery(context.Background(), nil, process)
+	if len(d.Killed) != 1 || len(d.Cancelled) != 1 {
+		t.Errorf("actions not recorded: killed %v, cancelled %v", d.Killed, d.Cancelled)
+	}
+	if _, err := d.Explain(context.Background(), nil, process); err == nil {
+		t.Error("Explain succeeded without a plan, want error")
+	}
+}
+
+func TestServerInfo(t *testing.T) {
+	d := New()
+	d.Server = stats.ServerInfo{Version: "5.6.51"}
+	d.Unsupported = stats.CapExplain | stats.CapLocks
+
+	conn, err := d.Connect(context.Background(), config.DatabaseInstance{})
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer conn.Close()
+
+	if got := conn.Server.String(); got != "fake 5.6.51" {
+		t.Errorf("Server = %q, want %q", got, "fake 5.6.51")
+	}
+	if conn.Capabilities.Has(stats.CapExplain) || conn.Capabilities.Has(stats.CapLocks) || !conn.Capabilities.Has(stats.CapKill) {
+		t.Errorf("Capabilities = %s, want all but explain and locks", conn.Capabilities)
+	}
+}
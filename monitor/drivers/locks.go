@@ -0,0 +1,39 @@
+package drivers
+
+import (
+	"database/sql"
+
+	"dbtop/monitor/stats"
+)
+
+// scanLockWaits reads lock waits from rows with the columns waiting id,
+// blocking id, wait time in seconds, lock type, and locked object
+func scanLockWaits(rows *sql.Rows) ([]stats.LockWait, error) {
+	defer rows.Close()
+
+	var locks []stats.LockWait
+	for rows.Next() {
+		var lock stats.LockWait
+		var waitTime sql.NullInt64
+		var lockType, object sql.NullString
+
+		if err := rows.Scan(&lock.WaitingID, &lock.BlockingID, &waitTime, &lockType, &object); err != nil {
+			return nil, err
+		}
+		lock.WaitTime = waitTime.Int64
+		lock.LockType = lockType.String
+		lock.Object = object.String
+
+		locks = append(locks, lock)
+	}
+	return locks, rows.Err()
+}
+
+// lockedSessions returns the number of distinct sessions waiting for a lock
+func lockedSessions(locks []stats.LockWait) int64 {
+	waiting := make(map[int64]bool)
+	for _, lock := range locks {
+		waiting[lock.WaitingID] = true
+	}
+	return int64(len(waiting))
+}
@@ -1,6 +1,7 @@
 package drivers
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -17,7 +18,7 @@ func init() {
 	RegisterDriver("mariadb", &mariadbDriver{})
 }
 
-func (d *mariadbDriver) Connect(instance config.DatabaseInstance) (*sql.DB, error) {
+func (d *mariadbDriver) Connect(ctx context.Context, instance config.DatabaseInstance) (*Conn, error) {
 	dsn := instance.GetDSN()
 	if dsn == "" {
 		// Handle different authentication scenarios
@@ -42,15 +43,15 @@ func (d *mariadbDriver) Connect(instance config.DatabaseInstance) (*sql.DB, erro
 						continue
 					}
 
-					if err := db.Ping(); err == nil {
+					if err := db.PingContext(ctx); err == nil {
 						// If we need to switch to a specific database, do it after connection
 						if instance.Database != "" {
-							if _, err := db.Exec("USE " + instance.Database); err != nil {
+							if _, err := db.ExecContext(ctx, "USE "+instance.Database); err != nil {
 								db.Close()
 								continue
 							}
 						}
-						return db, nil
+						return newConn(ctx, d, db, "mariadb"), nil
 					}
 					db.Close()
 				}
@@ -70,33 +71,54 @@ func (d *mariadbDriver) Connect(instance config.DatabaseInstance) (*sql.DB, erro
 		}
 	}
 
-	db, err := sql.Open("mysql", dsn)
+	dsn, err := mysqlTLS(instance, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openMySQL(ctx, instance, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
 
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	// If we connected without database but need to use one, switch to it
 	if instance.Database != "" && dsn[len(dsn)-1] == '?' {
-		if _, err := db.Exec("USE " + instance.Database); err != nil {
+		if _, err := db.ExecContext(ctx, "USE "+instance.Database); err != nil {
 			db.Close()
 			return nil, fmt.Errorf("failed to switch to database %s: %w", instance.Database, err)
 		}
 	}
 
-	return db, nil
+	return newConn(ctx, d, db, "mariadb"), nil
 }
 
-func (d *mariadbDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseStats, error) {
+func (d *mariadbDriver) ServerInfo(ctx context.Context, db *sql.DB) (stats.ServerInfo, error) {
+	return mysqlServerInfo(ctx, db)
+}
+
+// Capabilities enables SHOW EXPLAIN, performance_schema digests, and
+// multi-source replication status from MariaDB 10.0
+func (d *mariadbDriver) Capabilities(server stats.ServerInfo) stats.Capabilities {
+	capabilities := stats.CapKill | stats.CapCancel | stats.CapLocks | stats.CapTables
+	if server.AtLeast(10, 0) {
+		capabilities |= stats.CapExplain | stats.CapDigests | stats.CapReplication
+	}
+	return capabilities
+}
+
+func (d *mariadbDriver) Collect(ctx context.Context, conn *Conn, database string) (*stats.DatabaseStats, error) {
+	db := conn.DB
 	result := &stats.DatabaseStats{
 		Timestamp: time.Now(),
 	}
 
 	// Get status variables
-	rows, err := db.Query("SHOW STATUS")
+	rows, err := db.QueryContext(ctx, "SHOW GLOBAL STATUS")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get status variables: %w", err)
 	}
@@ -125,46 +147,49 @@ func (d *mariadbDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSt
 		}
 	}
 
-	// Get process information
-	processQuery := "SHOW PROCESSLIST"
+	result.Counters = stats.Counters{
+		Queries:      statusInt(statusVars, "Questions"),
+		Selects:      statusInt(statusVars, "Com_select"),
+		Inserts:      statusInt(statusVars, "Com_insert"),
+		Updates:      statusInt(statusVars, "Com_update"),
+		Deletes:      statusInt(statusVars, "Com_delete"),
+		Commits:      statusInt(statusVars, "Com_commit"),
+		Rollbacks:    statusInt(statusVars, "Com_rollback"),
+		SlowQueries:  statusInt(statusVars, "Slow_queries"),
+		RowsRead:     statusInt(statusVars, "Innodb_rows_read"),
+		RowsInserted: statusInt(statusVars, "Innodb_rows_inserted"),
+		RowsUpdated:  statusInt(statusVars, "Innodb_rows_updated"),
+		RowsDeleted:  statusInt(statusVars, "Innodb_rows_deleted"),
+	}
+	result.SlowQueries = result.Counters.SlowQueries
 
-	processRows, err := db.Query(processQuery)
+	// Get process information
+	processes, err := mysqlProcesses(ctx, conn, database)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get process information: %w", err)
+		return nil, err
 	}
-	defer processRows.Close()
-
-	for processRows.Next() {
-		var process stats.ProcessInfo
-		var timeStr string
-		var state sql.NullString
-		var info sql.NullString
-
-		err := processRows.Scan(&process.ID, &process.User, &process.Host, &process.Database, &process.Command, &timeStr, &state, &info)
-		if err != nil {
-			continue
-		}
+	result.Processes = processes
 
-		// Filter by database if specified
-		if database != "" && process.Database != database {
-			continue
-		}
-
-		if state.Valid {
-			process.State = state.String
-		}
-
-		if info.Valid {
-			process.Info = info.String
+	// Get lock waits
+	if conn.Capabilities.Has(stats.CapLocks) {
+		if locks, err := d.getLockWaits(ctx, db, database); optional(result, "lock waits", err) {
+			result.Locks = locks
+			result.Threads.Locked = lockedSessions(locks)
 		}
+	}
 
-		if timeStr != "" {
-			if _, err := fmt.Sscanf(timeStr, "%d", &process.Time); err != nil {
-				process.Time = 0
-			}
+	// Get replication status
+	if conn.Capabilities.Has(stats.CapReplication) {
+		if replication, err := d.getReplication(ctx, conn); optional(result, "replication status", err) {
+			result.Replication = replication
 		}
+	}
 
-		result.Processes = append(result.Processes, process)
+	// Get the top statement digests from performance_schema, or the reason
+	// they are unavailable
+	if conn.Capabilities.Has(stats.CapDigests) {
+		result.Statements, result.StatementsMessage = mysqlStatements(ctx, db, database)
+		result.StatementsSource = "performance_schema"
 	}
 
 	// Get table information
@@ -179,7 +204,7 @@ func (d *mariadbDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSt
 	if database != "" {
 		tableQuery += " WHERE table_schema = ?"
 		tableQuery += " ORDER BY (data_length + index_length) DESC LIMIT 10"
-		tableRows, err := db.Query(tableQuery, database)
+		tableRows, err := db.QueryContext(ctx, tableQuery, database)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get table information: %w", err)
 		}
@@ -187,13 +212,14 @@ func (d *mariadbDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSt
 
 		for tableRows.Next() {
 			var table stats.TableInfo
-			var dataLength, indexLength sql.NullInt64
+			var tableRowCount, dataLength, indexLength sql.NullInt64
 
-			err := tableRows.Scan(&table.Name, &table.Rows, &dataLength, &indexLength)
+			err := tableRows.Scan(&table.Name, &tableRowCount, &dataLength, &indexLength)
 			if err != nil {
 				continue
 			}
 
+			table.Rows = tableRowCount.Int64
 			if dataLength.Valid {
 				table.DataSize = dataLength.Int64
 			}
@@ -204,9 +230,18 @@ func (d *mariadbDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSt
 			result.Tables = append(result.Tables, table)
 		}
 	} else {
-		// Show tables from all databases
-		tableQuery += " ORDER BY (data_length + index_length) DESC LIMIT 20"
-		tableRows, err := db.Query(tableQuery)
+		// Show tables from all databases, qualified with their schema
+		tableQuery = `
+			SELECT 
+				table_schema,
+				table_name,
+				table_rows,
+				data_length,
+				index_length
+			FROM information_schema.tables 
+			ORDER BY (data_length + index_length) DESC LIMIT 20
+		`
+		tableRows, err := db.QueryContext(ctx, tableQuery)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get table information: %w", err)
 		}
@@ -215,14 +250,15 @@ func (d *mariadbDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSt
 		for tableRows.Next() {
 			var table stats.TableInfo
 			var schemaName string
-			var dataLength, indexLength sql.NullInt64
+			var tableRowCount, dataLength, indexLength sql.NullInt64
 
-			err := tableRows.Scan(&schemaName, &table.Name, &table.Rows, &dataLength, &indexLength)
+			err := tableRows.Scan(&schemaName, &table.Name, &tableRowCount, &dataLength, &indexLength)
 			if err != nil {
 				continue
 			}
 
 			table.Name = schemaName + "." + table.Name
+			table.Rows = tableRowCount.Int64
 			if dataLength.Valid {
 				table.DataSize = dataLength.Int64
 			}
@@ -236,3 +272,79 @@ func (d *mariadbDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSt
 
 	return result, nil
 }
+
+func (d *mariadbDriver) KillProcess(ctx context.Context, conn *Conn, process stats.ProcessInfo) error {
+	if _, err := conn.DB.ExecContext(ctx, fmt.Sprintf("KILL %d", process.ID)); err != nil {
+		return fmt.Errorf("failed to kill connection %d: %w", process.ID, err)
+	}
+	return nil
+}
+
+func (d *mariadbDriver) CancelQuery(ctx context.Context, conn *Conn, process stats.ProcessInfo) error {
+	if _, err := conn.DB.ExecContext(ctx, fmt.Sprintf("KILL QUERY %d", process.ID)); err != nil {
+		return fmt.Errorf("failed to cancel query of connection %d: %w", process.ID, err)
+	}
+	return nil
+}
+
+func (d *mariadbDriver) Explain(ctx context.Context, conn *Conn, process stats.ProcessInfo) (*stats.QueryPlan, error) {
+	// JSON output of SHOW EXPLAIN needs MariaDB 10.9; older servers only
+	// have the tabular form
+	var document string
+	err := conn.DB.QueryRowContext(ctx, fmt.Sprintf("SHOW EXPLAIN FORMAT=JSON FOR %d", process.ID)).Scan(&document)
+	if err == nil {
+		nodes, err := jsonPlan(document)
+		if err != nil {
+			return nil, err
+		}
+		return &stats.QueryPlan{Nodes: nodes}, nil
+	}
+
+	rows, err := conn.DB.QueryContext(ctx, fmt.Sprintf("SHOW EXPLAIN FOR %d", process.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to explain connection %d: %w", process.ID, err)
+	}
+	defer rows.Close()
+
+	nodes, err := tabularPlan(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan of connection %d: %w", process.ID, err)
+	}
+	return &stats.QueryPlan{Nodes: nodes}, nil
+}
+
+// getLockWaits returns InnoDB lock waits from information_schema
+func (d *mariadbDriver) getLockWaits(ctx context.Context, db *sql.DB, database string) ([]stats.LockWait, error) {
+	query := `
+		SELECT
+			r.trx_mysql_thread_id,
+			b.trx_mysql_thread_id,
+			TIMESTAMPDIFF(SECOND, r.trx_wait_started, NOW()),
+			l.lock_mode,
+			l.lock_table
+		FROM information_schema.INNODB_LOCK_WAITS w
+		JOIN information_schema.INNODB_TRX r ON r.trx_id = w.requesting_trx_id
+		JOIN information_schema.INNODB_TRX b ON b.trx_id = w.blocking_trx_id
+		LEFT JOIN information_schema.INNODB_LOCKS l ON l.lock_id = w.requested_lock_id
+	`
+	var rows *sql.Rows
+	var err error
+	if database != "" {
+		// lock_table is quoted as `schema`.`table`
+		rows, err = db.QueryContext(ctx, query+" WHERE l.lock_table LIKE CONCAT('`', ?, '`.%')", database)
+	} else {
+		rows, err = db.QueryContext(ctx, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scanLockWaits(rows)
+}
+
+// getReplication returns the status of every replication connection, using
+// SHOW ALL REPLICAS STATUS on MariaDB 10.5.1 and later and SHOW ALL SLAVES
+// STATUS before
+func (d *mariadbDriver) getReplication(ctx context.Context, conn *Conn) (*stats.Replication, error) {
+	queries := replicaStatusQueries(conn.Server, "SHOW ALL REPLICAS STATUS", "SHOW ALL SLAVES STATUS", 10, 5, 1)
+	return mysqlReplication(ctx, conn.DB, queries...)
+}
@@ -0,0 +1,67 @@
+package drivers
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"dbtop/monitor/stats"
+)
+
+func TestMariaDBCollect(t *testing.T) {
+	testMySQLFamilyCollect(t, &mariadbDriver{})
+}
+
+func TestMariaDBReplicationVariants(t *testing.T) {
+	tests := []struct {
+		version string
+		query   string
+		fixture string
+		want    *stats.Replication
+	}{
+		{
+			version: "10.4.32",
+			query:   "SHOW ALL SLAVES STATUS",
+			fixture: "mariadb/10.4/all_slaves_status.csv",
+			want: &stats.Replication{
+				Role: "replica", Lag: 5, LagKnown: true,
+				Channels: []stats.ReplicationChannel{{
+					Source: "db1.internal:3306", IOState: "Yes", SQLState: "Yes", Lag: 5, LagKnown: true,
+					ReceivedGTID: "0-1-1200", ExecutedGTID: "0-1-1195",
+				}},
+			},
+		},
+		{
+			version: "10.6.16",
+			query:   "SHOW ALL REPLICAS STATUS",
+			fixture: "mariadb/10.6/all_replicas_status.csv",
+			want: &stats.Replication{
+				Role: "replica", LagKnown: true,
+				Channels: []stats.ReplicationChannel{{
+					Name: "east", Source: "db1.internal:3306", IOState: "Yes", SQLState: "Yes", LagKnown: true,
+					ReceivedGTID: "0-1-800", ExecutedGTID: "0-1-800",
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			db, mock := newMock(t)
+			mock.ExpectQuery(regexp.QuoteMeta(tt.query)).WillReturnRows(fixture(t, tt.fixture))
+			conn := &Conn{DB: db, Server: stats.ServerInfo{Flavor: "mariadb", Version: tt.version}}
+
+			got, err := (&mariadbDriver{}).getReplication(context.Background(), conn)
+			if err != nil {
+				t.Fatalf("getReplication failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected replication\n got: %+v\nwant: %+v", got, tt.want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package drivers
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"dbtop/config"
@@ -17,7 +19,7 @@ func init() {
 	RegisterDriver("mysql", &mysqlDriver{})
 }
 
-func (d *mysqlDriver) Connect(instance config.DatabaseInstance) (*sql.DB, error) {
+func (d *mysqlDriver) Connect(ctx context.Context, instance config.DatabaseInstance) (*Conn, error) {
 	dsn := instance.GetDSN()
 	if dsn == "" {
 		// Handle different authentication scenarios
@@ -42,15 +44,15 @@ func (d *mysqlDriver) Connect(instance config.DatabaseInstance) (*sql.DB, error)
 						continue
 					}
 
-					if err := db.Ping(); err == nil {
+					if err := db.PingContext(ctx); err == nil {
 						// If we need to switch to a specific database, do it after connection
 						if instance.Database != "" {
-							if _, err := db.Exec("USE " + instance.Database); err != nil {
+							if _, err := db.ExecContext(ctx, "USE "+instance.Database); err != nil {
 								db.Close()
 								continue
 							}
 						}
-						return db, nil
+						return newConn(ctx, d, db, "mysql"), nil
 					}
 					db.Close()
 				}
@@ -70,33 +72,57 @@ func (d *mysqlDriver) Connect(instance config.DatabaseInstance) (*sql.DB, error)
 		}
 	}
 
-	db, err := sql.Open("mysql", dsn)
+	dsn, err := mysqlTLS(instance, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openMySQL(ctx, instance, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
 
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	// If we connected without database but need to use one, switch to it
 	if instance.Database != "" && dsn[len(dsn)-1] == '?' {
-		if _, err := db.Exec("USE " + instance.Database); err != nil {
+		if _, err := db.ExecContext(ctx, "USE "+instance.Database); err != nil {
 			db.Close()
 			return nil, fmt.Errorf("failed to switch to database %s: %w", instance.Database, err)
 		}
 	}
 
-	return db, nil
+	return newConn(ctx, d, db, "mysql"), nil
+}
+
+func (d *mysqlDriver) ServerInfo(ctx context.Context, db *sql.DB) (stats.ServerInfo, error) {
+	return mysqlServerInfo(ctx, db)
 }
 
-func (d *mysqlDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseStats, error) {
+// Capabilities enables EXPLAIN FOR CONNECTION and the sys schema lock
+// waits from MySQL 5.7, and statement digests from 5.6
+func (d *mysqlDriver) Capabilities(server stats.ServerInfo) stats.Capabilities {
+	capabilities := stats.CapKill | stats.CapCancel | stats.CapReplication | stats.CapTables
+	if server.AtLeast(5, 6) {
+		capabilities |= stats.CapDigests
+	}
+	if server.AtLeast(5, 7) {
+		capabilities |= stats.CapExplain | stats.CapLocks
+	}
+	return capabilities
+}
+
+func (d *mysqlDriver) Collect(ctx context.Context, conn *Conn, database string) (*stats.DatabaseStats, error) {
+	db := conn.DB
 	result := &stats.DatabaseStats{
 		Timestamp: time.Now(),
 	}
 
 	// Get status variables
-	rows, err := db.Query("SHOW STATUS")
+	rows, err := db.QueryContext(ctx, "SHOW GLOBAL STATUS")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get status variables: %w", err)
 	}
@@ -125,50 +151,49 @@ func (d *mysqlDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseStat
 		}
 	}
 
-	// Get process information
-	processQuery := "SHOW PROCESSLIST"
-	if database != "" {
-		// Note: MySQL doesn't support filtering SHOW PROCESSLIST by database
-		// We'll get all processes and filter in Go
+	result.Counters = stats.Counters{
+		Queries:      statusInt(statusVars, "Questions"),
+		Selects:      statusInt(statusVars, "Com_select"),
+		Inserts:      statusInt(statusVars, "Com_insert"),
+		Updates:      statusInt(statusVars, "Com_update"),
+		Deletes:      statusInt(statusVars, "Com_delete"),
+		Commits:      statusInt(statusVars, "Com_commit"),
+		Rollbacks:    statusInt(statusVars, "Com_rollback"),
+		SlowQueries:  statusInt(statusVars, "Slow_queries"),
+		RowsRead:     statusInt(statusVars, "Innodb_rows_read"),
+		RowsInserted: statusInt(statusVars, "Innodb_rows_inserted"),
+		RowsUpdated:  statusInt(statusVars, "Innodb_rows_updated"),
+		RowsDeleted:  statusInt(statusVars, "Innodb_rows_deleted"),
 	}
+	result.SlowQueries = result.Counters.SlowQueries
 
-	processRows, err := db.Query(processQuery)
+	// Get process information
+	processes, err := mysqlProcesses(ctx, conn, database)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get process information: %w", err)
+		return nil, err
 	}
-	defer processRows.Close()
-
-	for processRows.Next() {
-		var process stats.ProcessInfo
-		var timeStr string
-		var state sql.NullString
-		var info sql.NullString
+	result.Processes = processes
 
-		err := processRows.Scan(&process.ID, &process.User, &process.Host, &process.Database, &process.Command, &timeStr, &state, &info)
-		if err != nil {
-			continue
-		}
-
-		// Filter by database if specified
-		if database != "" && process.Database != database {
-			continue
-		}
-
-		if state.Valid {
-			process.State = state.String
-		}
-
-		if info.Valid {
-			process.Info = info.String
+	// Get lock waits
+	if conn.Capabilities.Has(stats.CapLocks) {
+		if locks, err := d.getLockWaits(ctx, conn, database); optional(result, "lock waits", err) {
+			result.Locks = locks
+			result.Threads.Locked = lockedSessions(locks)
 		}
+	}
 
-		if timeStr != "" {
-			if _, err := fmt.Sscanf(timeStr, "%d", &process.Time); err != nil {
-				process.Time = 0
-			}
+	// Get replication status
+	if conn.Capabilities.Has(stats.CapReplication) {
+		if replication, err := d.getReplication(ctx, conn); optional(result, "replication status", err) {
+			result.Replication = replication
 		}
+	}
 
-		result.Processes = append(result.Processes, process)
+	// Get the top statement digests from performance_schema, or the reason
+	// they are unavailable
+	if conn.Capabilities.Has(stats.CapDigests) {
+		result.Statements, result.StatementsMessage = mysqlStatements(ctx, db, database)
+		result.StatementsSource = "performance_schema"
 	}
 
 	// Get table information
@@ -183,7 +208,7 @@ func (d *mysqlDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseStat
 	if database != "" {
 		tableQuery += " WHERE table_schema = ?"
 		tableQuery += " ORDER BY (data_length + index_length) DESC LIMIT 10"
-		tableRows, err := db.Query(tableQuery, database)
+		tableRows, err := db.QueryContext(ctx, tableQuery, database)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get table information: %w", err)
 		}
@@ -191,13 +216,14 @@ func (d *mysqlDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseStat
 
 		for tableRows.Next() {
 			var table stats.TableInfo
-			var dataLength, indexLength sql.NullInt64
+			var tableRowCount, dataLength, indexLength sql.NullInt64
 
-			err := tableRows.Scan(&table.Name, &table.Rows, &dataLength, &indexLength)
+			err := tableRows.Scan(&table.Name, &tableRowCount, &dataLength, &indexLength)
 			if err != nil {
 				continue
 			}
 
+			table.Rows = tableRowCount.Int64
 			if dataLength.Valid {
 				table.DataSize = dataLength.Int64
 			}
@@ -208,9 +234,18 @@ func (d *mysqlDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseStat
 			result.Tables = append(result.Tables, table)
 		}
 	} else {
-		// Show tables from all databases
-		tableQuery += " ORDER BY (data_length + index_length) DESC LIMIT 20"
-		tableRows, err := db.Query(tableQuery)
+		// Show tables from all databases, qualified with their schema
+		tableQuery = `
+			SELECT 
+				table_schema,
+				table_name,
+				table_rows,
+				data_length,
+				index_length
+			FROM information_schema.tables 
+			ORDER BY (data_length + index_length) DESC LIMIT 20
+		`
+		tableRows, err := db.QueryContext(ctx, tableQuery)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get table information: %w", err)
 		}
@@ -219,14 +254,15 @@ func (d *mysqlDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseStat
 		for tableRows.Next() {
 			var table stats.TableInfo
 			var schemaName string
-			var dataLength, indexLength sql.NullInt64
+			var tableRowCount, dataLength, indexLength sql.NullInt64
 
-			err := tableRows.Scan(&schemaName, &table.Name, &table.Rows, &dataLength, &indexLength)
+			err := tableRows.Scan(&schemaName, &table.Name, &tableRowCount, &dataLength, &indexLength)
 			if err != nil {
 				continue
 			}
 
 			table.Name = schemaName + "." + table.Name
+			table.Rows = tableRowCount.Int64
 			if dataLength.Valid {
 				table.DataSize = dataLength.Int64
 			}
@@ -240,3 +276,183 @@ func (d *mysqlDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseStat
 
 	return result, nil
 }
+
+func (d *mysqlDriver) KillProcess(ctx context.Context, conn *Conn, process stats.ProcessInfo) error {
+	if _, err := conn.DB.ExecContext(ctx, fmt.Sprintf("KILL %d", process.ID)); err != nil {
+		return fmt.Errorf("failed to kill connection %d: %w", process.ID, err)
+	}
+	return nil
+}
+
+func (d *mysqlDriver) CancelQuery(ctx context.Context, conn *Conn, process stats.ProcessInfo) error {
+	if _, err := conn.DB.ExecContext(ctx, fmt.Sprintf("KILL QUERY %d", process.ID)); err != nil {
+		return fmt.Errorf("failed to cancel query of connection %d: %w", process.ID, err)
+	}
+	return nil
+}
+
+func (d *mysqlDriver) Explain(ctx context.Context, conn *Conn, process stats.ProcessInfo) (*stats.QueryPlan, error) {
+	var document string
+	err := conn.DB.QueryRowContext(ctx, fmt.Sprintf("EXPLAIN FORMAT=JSON FOR CONNECTION %d", process.ID)).Scan(&document)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("connection %d is not running a statement", process.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to explain connection %d: %w", process.ID, err)
+	}
+
+	nodes, err := jsonPlan(document)
+	if err != nil {
+		return nil, err
+	}
+	return &stats.QueryPlan{Nodes: nodes}, nil
+}
+
+// statusInt returns a numeric status variable, or zero when it is missing
+// or not a number
+func statusInt(statusVars map[string]string, name string) int64 {
+	var value int64
+	if _, err := fmt.Sscanf(statusVars[name], "%d", &value); err != nil {
+		return 0
+	}
+	return value
+}
+
+// mysqlServerInfo detects MySQL, Percona Server, and MariaDB from the
+// version string and comment, e.g. "8.0.36-28" and "Percona Server (GPL),
+// Release 28, Revision 47601f19"
+func mysqlServerInfo(ctx context.Context, db *sql.DB) (stats.ServerInfo, error) {
+	var version, comment string
+	if err := db.QueryRowContext(ctx, "SELECT VERSION(), @@version_comment").Scan(&version, &comment); err != nil {
+		return stats.ServerInfo{}, fmt.Errorf("failed to get server version: %w", err)
+	}
+
+	server := stats.ServerInfo{Flavor: "mysql", Edition: comment}
+	switch {
+	case strings.Contains(strings.ToLower(version), "mariadb"):
+		server.Flavor = "mariadb"
+	case strings.Contains(strings.ToLower(comment), "percona"):
+		server.Flavor = "percona"
+	}
+	server.Version, _, _ = strings.Cut(version, "-")
+	return server, nil
+}
+
+// mysqlProcesses returns the processes connected to the server, or to
+// database if set. MySQL 8.0.22 and later read performance_schema.processlist,
+// which unlike SHOW PROCESSLIST does not hold a global mutex. The table
+// is empty when performance_schema is disabled, and since it always lists
+// dbtop's own connection, that case falls back to SHOW FULL PROCESSLIST.
+// Without FULL the query text is cut off at 100 characters.
+func mysqlProcesses(ctx context.Context, conn *Conn, database string) ([]stats.ProcessInfo, error) {
+	if conn.Server.Flavor != "mariadb" && conn.Server.AtLeast(8, 0, 22) {
+		rows, err := conn.DB.QueryContext(ctx, `
+			SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO
+			FROM performance_schema.processlist
+		`)
+		if err == nil {
+			processes, found, err := scanProcessList(rows, database)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get process information: %w", err)
+			}
+			if found {
+				return processes, nil
+			}
+		}
+	}
+
+	rows, err := conn.DB.QueryContext(ctx, "SHOW FULL PROCESSLIST")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get process information: %w", err)
+	}
+	processes, _, err := scanProcessList(rows, database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get process information: %w", err)
+	}
+	return processes, nil
+}
+
+// scanProcessList reads the rows of a process list query and keeps the
+// processes connected to database if set. found reports whether there
+// were any rows before filtering.
+func scanProcessList(rows *sql.Rows, database string) (processes []stats.ProcessInfo, found bool, err error) {
+	defer rows.Close()
+
+	for rows.Next() {
+		found = true
+
+		var process stats.ProcessInfo
+		var timeStr string
+		var processDB sql.NullString
+		var state sql.NullString
+		var info sql.NullString
+
+		err := rows.Scan(&process.ID, &process.User, &process.Host, &processDB, &process.Command, &timeStr, &state, &info)
+		if err != nil {
+			continue
+		}
+		process.Database = processDB.String
+
+		// Filter by database if specified
+		if database != "" && process.Database != database {
+			continue
+		}
+
+		if state.Valid {
+			process.State = state.String
+		}
+
+		if info.Valid {
+			process.Info = info.String
+		}
+
+		if timeStr != "" {
+			if _, err := fmt.Sscanf(timeStr, "%d", &process.Time); err != nil {
+				process.Time = 0
+			}
+		}
+
+		processes = append(processes, process)
+	}
+	return processes, found, rows.Err()
+}
+
+// mysqlLikeEscaper escapes the wildcards of a LIKE pattern
+var mysqlLikeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// getLockWaits returns InnoDB lock waits from the sys schema, which is
+// built on performance_schema.data_lock_waits in MySQL 8.0. The 5.7 view
+// has no locked_table_schema, so the database is matched against the
+// quoted locked_table instead.
+func (d *mysqlDriver) getLockWaits(ctx context.Context, conn *Conn, database string) ([]stats.LockWait, error) {
+	query := `
+		SELECT
+			waiting_pid,
+			blocking_pid,
+			wait_age_secs,
+			locked_type,
+			locked_table
+		FROM sys.innodb_lock_waits
+	`
+	var rows *sql.Rows
+	var err error
+	switch {
+	case database == "":
+		rows, err = conn.DB.QueryContext(ctx, query)
+	case conn.Server.AtLeast(8):
+		rows, err = conn.DB.QueryContext(ctx, query+" WHERE locked_table_schema = ?", database)
+	default:
+		rows, err = conn.DB.QueryContext(ctx, query+" WHERE locked_table LIKE CONCAT('`', ?, '`.%')", mysqlLikeEscaper.Replace(database))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scanLockWaits(rows)
+}
+
+// getReplication returns the replica status, using SHOW REPLICA STATUS on
+// MySQL 8.0.22 and later and SHOW SLAVE STATUS before
+func (d *mysqlDriver) getReplication(ctx context.Context, conn *Conn) (*stats.Replication, error) {
+	queries := replicaStatusQueries(conn.Server, "SHOW REPLICA STATUS", "SHOW SLAVE STATUS", 8, 0, 22)
+	return mysqlReplication(ctx, conn.DB, queries...)
+}
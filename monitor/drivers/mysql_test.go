@@ -0,0 +1,400 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"dbtop/monitor/stats"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// testMySQLFamilyCollect runs the Collect cases shared by the MySQL and
+// MariaDB drivers
+func testMySQLFamilyCollect(t *testing.T, driver Driver) {
+	processColumns := []string{"Id", "User", "Host", "db", "Command", "Time", "State", "Info"}
+	digestColumns := []string{"DIGEST", "SCHEMA_NAME", "DIGEST_TEXT", "COUNT_STAR", "SUM_TIMER_WAIT", "SUM_ROWS_SENT", "SUM_ROWS_EXAMINED", "SUM_NO_INDEX_USED"}
+	lockColumns := []string{"waiting_pid", "blocking_pid", "wait_age_secs", "locked_type", "locked_table"}
+	replicaColumns := []string{
+		"Channel_Name", "Source_Host", "Source_Port", "Replica_IO_Running", "Replica_SQL_Running",
+		"Seconds_Behind_Source", "Retrieved_Gtid_Set", "Executed_Gtid_Set", "Last_IO_Error", "Last_SQL_Error",
+	}
+
+	tests := []struct {
+		name     string
+		database string
+		expect   func(mock sqlmock.Sqlmock)
+		want     *stats.DatabaseStats
+	}{
+		{
+			name: "all databases",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SHOW GLOBAL STATUS")).WillReturnRows(
+					sqlmock.NewRows([]string{"Variable_name", "Value"}).
+						AddRow("Threads_connected", "12").
+						AddRow("Uptime", "3600").
+						AddRow("Questions", "1000").
+						AddRow("Com_select", "600").
+						AddRow("Slow_queries", "3").
+						AddRow("Innodb_rows_read", "not a number"))
+				mock.ExpectQuery(regexp.QuoteMeta("SHOW FULL PROCESSLIST")).WillReturnRows(
+					sqlmock.NewRows(processColumns).
+						AddRow(1, "app", "10.0.0.1:5000", "shop", "Query", "7", "executing", "SELECT 1").
+						AddRow(2, "event_scheduler", "localhost", nil, "Daemon", "3600", nil, nil))
+				mock.ExpectQuery(`(?i)innodb_lock_waits`).WillReturnRows(
+					sqlmock.NewRows(lockColumns).
+						AddRow(1, 5, 12, "RECORD", "`shop`.`orders`").
+						AddRow(1, 6, 12, "RECORD", "`shop`.`orders`").
+						AddRow(7, 1, nil, nil, nil))
+				mock.ExpectQuery(`SHOW (ALL )?REPLICAS? STATUS`).WillReturnRows(
+					sqlmock.NewRows(replicaColumns).
+						AddRow("", "db1", "3306", "Yes", "Yes", "4", "uuid:1-100", "uuid:1-98", "", "").
+						AddRow("reports", "db2", "3306", "Connecting", "No", nil, "", "", "error connecting to source", ""))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT @@performance_schema")).
+					WillReturnRows(sqlmock.NewRows([]string{"@@performance_schema"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("WHERE NAME = 'statements_digest'")).
+					WillReturnRows(sqlmock.NewRows([]string{"ENABLED"}).AddRow("YES"))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM performance_schema.events_statements_summary_by_digest")).
+					WillReturnRows(sqlmock.NewRows(digestColumns).
+						AddRow("3c5f", "shop", "SELECT * FROM `orders` WHERE `id` = ?", 500, "1250.5000", 500, 500, 0).
+						AddRow(nil, nil, nil, 20, "3.0000", 20, 4000, 20))
+				mock.ExpectQuery(`SELECT\s+table_schema,\s+table_name`).WillReturnRows(
+					sqlmock.NewRows([]string{"table_schema", "table_name", "table_rows", "data_length", "index_length"}).
+						AddRow("shop", "orders", 100, 16384, 8192).
+						AddRow("shop", "order_view", nil, nil, nil))
+			},
+			want: &stats.DatabaseStats{
+				ActiveConnections: 12,
+				SlowQueries:       3,
+				Uptime:            time.Hour,
+				Counters:          stats.Counters{Queries: 1000, Selects: 600, SlowQueries: 3},
+				Processes: []stats.ProcessInfo{
+					{ID: 1, User: "app", Host: "10.0.0.1:5000", Database: "shop", Command: "Query", Time: 7, State: "executing", Info: "SELECT 1"},
+					{ID: 2, User: "event_scheduler", Host: "localhost", Command: "Daemon", Time: 3600},
+				},
+				Threads: stats.ThreadStats{Locked: 2},
+				Locks: []stats.LockWait{
+					{WaitingID: 1, BlockingID: 5, WaitTime: 12, LockType: "RECORD", Object: "`shop`.`orders`"},
+					{WaitingID: 1, BlockingID: 6, WaitTime: 12, LockType: "RECORD", Object: "`shop`.`orders`"},
+					{WaitingID: 7, BlockingID: 1},
+				},
+				Replication: &stats.Replication{
+					Role:     "replica",
+					Lag:      4,
+					LagKnown: true,
+					Channels: []stats.ReplicationChannel{
+						{Source: "db1:3306", IOState: "Yes", SQLState: "Yes", Lag: 4, LagKnown: true, ReceivedGTID: "uuid:1-100", ExecutedGTID: "uuid:1-98"},
+						{Name: "reports", Source: "db2:3306", IOState: "Connecting", SQLState: "No", LastError: "error connecting to source"},
+					},
+				},
+				StatementsSource: "performance_schema",
+				Statements: []stats.Statement{
+					{
+						ID: "shop/3c5f", Database: "shop", Query: "SELECT * FROM `orders` WHERE `id` = ?",
+						Total: stats.StatementCounters{Calls: 500, Time: 1250.5, Rows: 500, RowsExamined: 500},
+					},
+					{
+						ID: "/", Query: "(other statements)",
+						Total: stats.StatementCounters{Calls: 20, Time: 3, Rows: 20, RowsExamined: 4000, NoIndexUsed: 20},
+					},
+				},
+				Tables: []stats.TableInfo{
+					{Name: "shop.orders", Rows: 100, DataSize: 16384, IndexSize: 8192},
+					{Name: "shop.order_view"},
+				},
+			},
+		},
+		{
+			name:     "single database",
+			database: "shop",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SHOW GLOBAL STATUS")).WillReturnRows(
+					sqlmock.NewRows([]string{"Variable_name", "Value"}))
+				mock.ExpectQuery(regexp.QuoteMeta("SHOW FULL PROCESSLIST")).WillReturnRows(
+					sqlmock.NewRows(processColumns).
+						AddRow(1, "app", "10.0.0.1:5000", "shop", "Sleep", "1", "", nil).
+						AddRow(2, "app", "10.0.0.2:5000", "crm", "Sleep", "1", "", nil).
+						AddRow(3, "root", "localhost", nil, "Query", "0", "init", "SHOW FULL PROCESSLIST"))
+				mock.ExpectQuery(`(?i)innodb_lock_waits`).
+					WithArgs("shop").
+					WillReturnError(errors.New("SELECT command denied to user 'monitor'@'%'"))
+				mock.ExpectQuery(`SHOW (ALL )?REPLICAS? STATUS`).WillReturnError(errors.New("syntax error"))
+				mock.ExpectQuery(`SHOW (ALL )?SLAVES? STATUS`).WillReturnRows(
+					sqlmock.NewRows([]string{"Slave_IO_Running", "Slave_SQL_Running", "Seconds_Behind_Master"}))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT @@performance_schema")).
+					WillReturnRows(sqlmock.NewRows([]string{"@@performance_schema"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta("WHERE table_schema = ?")).
+					WithArgs("shop").
+					WillReturnRows(sqlmock.NewRows([]string{"table_name", "table_rows", "data_length", "index_length"}).
+						AddRow("orders", nil, 16384, nil))
+			},
+			want: &stats.DatabaseStats{
+				Processes: []stats.ProcessInfo{
+					{ID: 1, User: "app", Host: "10.0.0.1:5000", Database: "shop", Command: "Sleep", Time: 1},
+				},
+				StatementsSource:  "performance_schema",
+				StatementsMessage: "performance_schema is disabled; set performance_schema = ON in the server configuration and restart the server",
+				Tables: []stats.TableInfo{
+					{Name: "orders", DataSize: 16384},
+				},
+				Warnings: []string{"failed to get lock waits: SELECT command denied to user 'monitor'@'%'"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMock(t)
+			tt.expect(mock)
+
+			got, err := driver.Collect(context.Background(), recentConn(db), tt.database)
+			if err != nil {
+				t.Fatalf("Collect failed: %v", err)
+			}
+			checkStats(t, got, tt.want)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestMySQLCollect(t *testing.T) {
+	testMySQLFamilyCollect(t, &mysqlDriver{})
+}
+
+func TestMySQLProcessActions(t *testing.T) {
+	db, mock := newMock(t)
+	driver := &mysqlDriver{}
+	process := stats.ProcessInfo{ID: 42}
+
+	mock.ExpectExec(regexp.QuoteMeta("KILL 42")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("KILL QUERY 42")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := driver.KillProcess(context.Background(), recentConn(db), process); err != nil {
+		t.Errorf("KillProcess failed: %v", err)
+	}
+	if err := driver.CancelQuery(context.Background(), recentConn(db), process); err != nil {
+		t.Errorf("CancelQuery failed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMySQLServerInfo(t *testing.T) {
+	tests := []struct {
+		version, comment string
+		want             stats.ServerInfo
+	}{
+		{"8.0.36", "MySQL Community Server - GPL", stats.ServerInfo{Flavor: "mysql", Version: "8.0.36", Edition: "MySQL Community Server - GPL"}},
+		{"8.0.36-28", "Percona Server (GPL), Release 28", stats.ServerInfo{Flavor: "percona", Version: "8.0.36", Edition: "Percona Server (GPL), Release 28"}},
+		{"10.11.6-MariaDB-0+deb12u1", "Debian 12", stats.ServerInfo{Flavor: "mariadb", Version: "10.11.6", Edition: "Debian 12"}},
+	}
+	for _, tt := range tests {
+		db, mock := newMock(t)
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT VERSION(), @@version_comment")).
+			WillReturnRows(sqlmock.NewRows([]string{"VERSION()", "@@version_comment"}).AddRow(tt.version, tt.comment))
+
+		got, err := (&mysqlDriver{}).ServerInfo(context.Background(), db)
+		if err != nil {
+			t.Fatalf("ServerInfo failed: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("ServerInfo for %q = %+v, want %+v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestMySQLCapabilities(t *testing.T) {
+	driver := &mysqlDriver{}
+	tests := []struct {
+		version string
+		want    stats.Capabilities
+	}{
+		{"5.5.62", stats.CapKill | stats.CapCancel | stats.CapReplication | stats.CapTables},
+		{"5.6.51", stats.CapKill | stats.CapCancel | stats.CapReplication | stats.CapTables | stats.CapDigests},
+		{"8.0.36", stats.AllCapabilities},
+		{"", stats.AllCapabilities},
+	}
+	for _, tt := range tests {
+		if got := driver.Capabilities(stats.ServerInfo{Flavor: "mysql", Version: tt.version}); got != tt.want {
+			t.Errorf("Capabilities for %q = %s, want %s", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestMySQLCollectSkipsUnsupported(t *testing.T) {
+	// Only the status, process list, and table queries run against a
+	// server without lock waits, replication, or digests
+	db, mock := newMock(t)
+	mock.ExpectQuery(regexp.QuoteMeta("SHOW GLOBAL STATUS")).
+		WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}))
+	mock.ExpectQuery(regexp.QuoteMeta("SHOW FULL PROCESSLIST")).
+		WillReturnRows(sqlmock.NewRows([]string{"Id", "User", "Host", "db", "Command", "Time", "State", "Info"}))
+	mock.ExpectQuery(`SELECT\s+table_schema,\s+table_name`).
+		WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name", "table_rows", "data_length", "index_length"}))
+
+	conn := &Conn{DB: db, Capabilities: stats.CapKill | stats.CapTables}
+	got, err := (&mysqlDriver{}).Collect(context.Background(), conn, "")
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	checkStats(t, got, &stats.DatabaseStats{})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMySQLQueryVariants(t *testing.T) {
+	processes57 := []stats.ProcessInfo{
+		{ID: 4, User: "system user", Command: "Connect", Time: 86400, State: "Slave has read all relay log; waiting for more updates"},
+		{ID: 17, User: "app", Host: "10.0.0.12:51022", Database: "shop", Command: "Query", Time: 3, State: "Sending data", Info: "SELECT * FROM orders WHERE status = 'open'"},
+		// Longer than the 100 characters SHOW PROCESSLIST keeps without FULL
+		{ID: 18, User: "app", Host: "10.0.0.13:51040", Database: "shop", Command: "Query", Time: 1, State: "Sending data", Info: "SELECT o.id, o.status, c.name, c.email FROM orders o JOIN customers c ON c.id = o.customer_id WHERE o.status = 'open' ORDER BY o.created_at"},
+		{ID: 21, User: "dbtop", Host: "localhost", Command: "Query", State: "starting", Info: "SHOW FULL PROCESSLIST"},
+	}
+	processes80 := []stats.ProcessInfo{
+		{ID: 5, User: "event_scheduler", Host: "localhost", Command: "Daemon", Time: 172800, State: "Waiting on empty queue"},
+		{ID: 33, User: "app", Host: "10.0.0.12:51090", Database: "shop", Command: "Query", Time: 1, State: "executing", Info: "SELECT COUNT(*) FROM order_items"},
+		{ID: 40, User: "dbtop", Host: "localhost", Command: "Query", State: "executing", Info: "SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO FROM performance_schema.processlist"},
+	}
+	replication57 := &stats.Replication{
+		Role: "replica", Lag: 2, LagKnown: true,
+		Channels: []stats.ReplicationChannel{{
+			Source: "db1.internal:3306", IOState: "Yes", SQLState: "Yes", Lag: 2, LagKnown: true,
+			ReceivedGTID: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5000", ExecutedGTID: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-4998",
+		}},
+	}
+	replication80 := &stats.Replication{
+		Role: "replica", LagKnown: true,
+		Channels: []stats.ReplicationChannel{
+			{
+				Source: "db1.internal:3306", IOState: "Yes", SQLState: "Yes", LagKnown: true,
+				ReceivedGTID: "8a94f357-aab4-11df-86ab-c80aa9429562:1-920", ExecutedGTID: "8a94f357-aab4-11df-86ab-c80aa9429562:1-920",
+			},
+			{
+				Name: "reports", Source: "db2.internal:3306", IOState: "No", SQLState: "No",
+				LastError: "error connecting to source 'repl@db2.internal:3306' - retry-time: 60 retries: 3",
+			},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		version         string
+		expect          func(mock sqlmock.Sqlmock)
+		wantProcesses   []stats.ProcessInfo
+		wantReplication *stats.Replication
+	}{
+		{
+			name:    "5.7",
+			version: "5.7.44",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SHOW FULL PROCESSLIST")).WillReturnRows(fixture(t, "mysql/5.7/processlist.csv"))
+				mock.ExpectQuery(regexp.QuoteMeta("SHOW SLAVE STATUS")).WillReturnRows(fixture(t, "mysql/5.7/slave_status.csv"))
+			},
+			wantProcesses:   processes57,
+			wantReplication: replication57,
+		},
+		{
+			name:    "8.0.22 and later",
+			version: "8.0.36",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM performance_schema.processlist")).WillReturnRows(fixture(t, "mysql/8.0/processlist.csv"))
+				mock.ExpectQuery(regexp.QuoteMeta("SHOW REPLICA STATUS")).WillReturnRows(fixture(t, "mysql/8.0/replica_status.csv"))
+			},
+			wantProcesses:   processes80,
+			wantReplication: replication80,
+		},
+		{
+			name:    "8.0 without performance_schema",
+			version: "8.0.36",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM performance_schema.processlist")).
+					WillReturnRows(sqlmock.NewRows([]string{"ID", "USER", "HOST", "DB", "COMMAND", "TIME", "STATE", "INFO"}))
+				mock.ExpectQuery(regexp.QuoteMeta("SHOW FULL PROCESSLIST")).WillReturnRows(fixture(t, "mysql/5.7/processlist.csv"))
+				mock.ExpectQuery(regexp.QuoteMeta("SHOW REPLICA STATUS")).WillReturnRows(fixture(t, "mysql/8.0/replica_status.csv"))
+			},
+			wantProcesses:   processes57,
+			wantReplication: replication80,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMock(t)
+			tt.expect(mock)
+			conn := &Conn{DB: db, Server: stats.ServerInfo{Flavor: "mysql", Version: tt.version}}
+
+			processes, err := mysqlProcesses(context.Background(), conn, "")
+			if err != nil {
+				t.Fatalf("mysqlProcesses failed: %v", err)
+			}
+			if !reflect.DeepEqual(processes, tt.wantProcesses) {
+				t.Errorf("unexpected processes\n got: %+v\nwant: %+v", processes, tt.wantProcesses)
+			}
+
+			replication, err := (&mysqlDriver{}).getReplication(context.Background(), conn)
+			if err != nil {
+				t.Fatalf("getReplication failed: %v", err)
+			}
+			if !reflect.DeepEqual(replication, tt.wantReplication) {
+				t.Errorf("unexpected replication\n got: %+v\nwant: %+v", replication, tt.wantReplication)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestMySQLLockWaitVariants(t *testing.T) {
+	tests := []struct {
+		version string
+		query   string
+		arg     string
+		want    []stats.LockWait
+	}{
+		{
+			version: "5.7.44",
+			query:   "WHERE locked_table LIKE CONCAT('`', ?, '`.%')",
+			arg:     `shop\_db`,
+			want:    []stats.LockWait{{WaitingID: 17, BlockingID: 21, WaitTime: 8, LockType: "RECORD", Object: "`shop_db`.`orders`"}},
+		},
+		{
+			version: "8.0.36",
+			query:   "WHERE locked_table_schema = ?",
+			arg:     "shop_db",
+			want:    []stats.LockWait{{WaitingID: 33, BlockingID: 40, WaitTime: 2, LockType: "RECORD", Object: "`shop_db`.`order_items`"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			db, mock := newMock(t)
+			dir := "mysql/" + tt.version[:3] + "/"
+			mock.ExpectQuery(regexp.QuoteMeta(tt.query)).
+				WithArgs(tt.arg).
+				WillReturnRows(fixture(t, dir+"innodb_lock_waits.csv"))
+
+			conn := &Conn{DB: db, Server: stats.ServerInfo{Flavor: "mysql", Version: tt.version}}
+			got, err := (&mysqlDriver{}).getLockWaits(context.Background(), conn, "shop_db")
+			if err != nil {
+				t.Fatalf("getLockWaits failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected lock waits\n got: %+v\nwant: %+v", got, tt.want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
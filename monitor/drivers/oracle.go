@@ -4,14 +4,18 @@
 package drivers
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"dbtop/config"
 	"dbtop/monitor/stats"
+	"dbtop/tunnel"
 
-	_ "github.com/godror/godror"
+	"github.com/godror/godror"
 )
 
 type oracleDriver struct{}
@@ -20,26 +24,108 @@ func init() {
 	RegisterDriver("oracle", &oracleDriver{})
 }
 
-func (d *oracleDriver) Connect(instance config.DatabaseInstance) (*sql.DB, error) {
+func (d *oracleDriver) Connect(ctx context.Context, instance config.DatabaseInstance) (*Conn, error) {
+	var t *tunnel.Tunnel
+	if instance.SSH != nil {
+		var err error
+		if t, err = forwardInstance(ctx, &instance); err != nil {
+			return nil, err
+		}
+	}
+
 	dsn := instance.GetDSN()
 	if dsn == "" {
 		dsn = fmt.Sprintf("%s/%s@%s:%d/%s",
 			instance.Username, instance.Password, instance.Host, instance.Port, instance.Database)
 	}
+	if instance.TLS != nil {
+		var err error
+		if dsn, err = oracleTLSDSN(instance, dsn); err != nil {
+			if t != nil {
+				t.Close()
+			}
+			return nil, err
+		}
+	}
 
-	db, err := sql.Open("godror", dsn)
+	db, err := openOracle(t, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
 
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return db, nil
+	return newConn(ctx, d, db, "oracle"), nil
+}
+
+// ServerInfo reads the version from product_component_version, which
+// every user can query
+func (d *oracleDriver) ServerInfo(ctx context.Context, db *sql.DB) (stats.ServerInfo, error) {
+	var product, version string
+	err := db.QueryRowContext(ctx, `
+		SELECT product, version
+		FROM product_component_version
+		WHERE product LIKE 'Oracle Database%'
+	`).Scan(&product, &version)
+	if err != nil {
+		return stats.ServerInfo{}, fmt.Errorf("failed to get server version: %w", err)
+	}
+
+	// The product names the edition, e.g. "Oracle Database 19c Enterprise
+	// Edition"
+	server := stats.ServerInfo{Flavor: "oracle", Version: version}
+	fields := strings.Fields(product)
+	for i := 1; i < len(fields); i++ {
+		if fields[i] == "Edition" {
+			server.Edition = fields[i-1]
+			break
+		}
+	}
+	return server, nil
+}
+
+// Capabilities enables ALTER SYSTEM CANCEL SQL from Oracle 18c. Oracle
+// has no statement digests.
+func (d *oracleDriver) Capabilities(server stats.ServerInfo) stats.Capabilities {
+	capabilities := stats.CapKill | stats.CapExplain | stats.CapReplication | stats.CapLocks | stats.CapTables
+	if server.AtLeast(18) {
+		capabilities |= stats.CapCancel
+	}
+	return capabilities
+}
+
+// oracleTLSDSN adds the TLS settings of an instance to the connect string
+// of a godror DSN, keeping its other parameters
+func oracleTLSDSN(instance config.DatabaseInstance, dsn string) (string, error) {
+	params, err := godror.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	if params.ConnectString, err = oracleTLS(instance, params.ConnectString); err != nil {
+		return "", err
+	}
+	return params.StringWithPassword(), nil
+}
+
+// openOracle opens a godror DSN. Through an SSH tunnel the instance
+// already points at the forwarded port.
+func openOracle(t *tunnel.Tunnel, dsn string) (*sql.DB, error) {
+	if t == nil {
+		return sql.Open("godror", dsn)
+	}
+	params, err := godror.ParseDSN(dsn)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return sql.OpenDB(tunnelConnector{godror.NewConnector(params), t}), nil
 }
 
-func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseStats, error) {
+func (d *oracleDriver) Collect(ctx context.Context, conn *Conn, database string) (*stats.DatabaseStats, error) {
+	db := conn.DB
 	result := &stats.DatabaseStats{
 		Timestamp: time.Now(),
 	}
@@ -53,12 +139,12 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 	`
 	if database != "" {
 		activeQuery += " AND schemaname = :1"
-		err := db.QueryRow(activeQuery, database).Scan(&activeConnections)
+		err := db.QueryRowContext(ctx, activeQuery, database).Scan(&activeConnections)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get active connections: %w", err)
 		}
 	} else {
-		err := db.QueryRow(activeQuery).Scan(&activeConnections)
+		err := db.QueryRowContext(ctx, activeQuery).Scan(&activeConnections)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get active connections: %w", err)
 		}
@@ -74,12 +160,12 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 	`
 	if database != "" {
 		totalQuery += " AND schemaname = :1"
-		err := db.QueryRow(totalQuery, database).Scan(&totalConnections)
+		err := db.QueryRowContext(ctx, totalQuery, database).Scan(&totalConnections)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get total connections: %w", err)
 		}
 	} else {
-		err := db.QueryRow(totalQuery).Scan(&totalConnections)
+		err := db.QueryRowContext(ctx, totalQuery).Scan(&totalConnections)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get total connections: %w", err)
 		}
@@ -88,11 +174,8 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 
 	// Get uptime
 	var uptimeSeconds int64
-	err := db.QueryRow(`
-		SELECT EXTRACT(DAY FROM (SYSDATE - STARTUP_TIME)) * 86400 +
-		       EXTRACT(HOUR FROM (SYSDATE - STARTUP_TIME)) * 3600 +
-		       EXTRACT(MINUTE FROM (SYSDATE - STARTUP_TIME)) * 60 +
-		       EXTRACT(SECOND FROM (SYSDATE - STARTUP_TIME))
+	err := db.QueryRowContext(ctx, `
+		SELECT ROUND((SYSDATE - startup_time) * 86400)
 		FROM v$instance
 	`).Scan(&uptimeSeconds)
 	if err != nil {
@@ -100,15 +183,44 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 	}
 	result.Uptime = time.Duration(uptimeSeconds) * time.Second
 
+	// Get cumulative activity counters
+	counterRows, err := db.QueryContext(ctx, `
+		SELECT name, value
+		FROM v$sysstat
+		WHERE name IN ('execute count', 'user commits', 'user rollbacks')
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get system statistics: %w", err)
+	}
+	defer counterRows.Close()
+
+	for counterRows.Next() {
+		var name string
+		var value int64
+		if err := counterRows.Scan(&name, &value); err != nil {
+			continue
+		}
+		switch name {
+		case "execute count":
+			result.Counters.Queries = value
+		case "user commits":
+			result.Counters.Commits = value
+		case "user rollbacks":
+			result.Counters.Rollbacks = value
+		}
+	}
+
 	// Get session information
 	sessionQuery := `
 		SELECT 
 			s.sid,
+			s.serial#,
 			s.username,
 			s.machine,
 			s.schemaname,
 			s.status,
 			s.logon_time,
+			s.sql_id,
 			q.sql_text
 		FROM v$session s
 		LEFT JOIN v$sql q ON s.sql_id = q.sql_id
@@ -117,14 +229,14 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 	if database != "" {
 		sessionQuery += " AND s.schemaname = :1"
 	}
-	sessionQuery += " ORDER BY s.logon_time DESC FETCH FIRST 50 ROWS ONLY"
+	sessionQuery = oracleTopN(conn.Server, sessionQuery+" ORDER BY s.logon_time DESC", 50)
 
 	var rows *sql.Rows
 	var err2 error
 	if database != "" {
-		rows, err2 = db.Query(sessionQuery, database)
+		rows, err2 = db.QueryContext(ctx, sessionQuery, database)
 	} else {
-		rows, err2 = db.Query(sessionQuery)
+		rows, err2 = db.QueryContext(ctx, sessionQuery)
 	}
 	if err2 != nil {
 		return nil, fmt.Errorf("failed to get session information: %w", err2)
@@ -134,9 +246,9 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 	for rows.Next() {
 		var process stats.ProcessInfo
 		var logonTime sql.NullTime
-		var sqlText sql.NullString
+		var sqlID, sqlText sql.NullString
 
-		err := rows.Scan(&process.ID, &process.User, &process.Host, &process.Database, &process.State, &logonTime, &sqlText)
+		err := rows.Scan(&process.ID, &process.Serial, &process.User, &process.Host, &process.Database, &process.State, &logonTime, &sqlID, &sqlText)
 		if err != nil {
 			continue
 		}
@@ -145,6 +257,10 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 			process.Time = int64(time.Since(logonTime.Time).Seconds())
 		}
 
+		if sqlID.Valid {
+			process.SQLID = sqlID.String
+		}
+
 		if sqlText.Valid {
 			process.Info = sqlText.String
 		}
@@ -152,6 +268,29 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 		result.Processes = append(result.Processes, process)
 	}
 
+	// Get lock waits
+	if conn.Capabilities.Has(stats.CapLocks) {
+		if locks, err := d.getLockWaits(ctx, db, database); optional(result, "lock waits", err) {
+			result.Locks = locks
+			result.Threads.Locked = lockedSessions(locks)
+		}
+	}
+
+	// Get replication status
+	if conn.Capabilities.Has(stats.CapReplication) {
+		if replication, err := d.getReplication(ctx, db); optional(result, "replication status", err) {
+			result.Replication = replication
+		}
+	}
+
+	// Get the wait events and sample the active sessions
+	if events, err := d.getWaitEvents(ctx, db); optional(result, "wait events", err) {
+		result.WaitEvents = events
+	}
+	if sessions, err := d.getActiveSessions(ctx, db, database); optional(result, "active sessions", err) {
+		result.ActiveSessions = sessions
+	}
+
 	// Get table information
 	tableQuery := `
 		SELECT 
@@ -173,7 +312,6 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 			GROUP BY table_name
 		) i ON t.table_name = i.table_name
 		ORDER BY (s.bytes + i.index_size) DESC
-		FETCH FIRST 10 ROWS ONLY
 	`
 	if database != "" {
 		// For Oracle, we need to connect to the specific schema
@@ -199,9 +337,9 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 			) i ON t.table_name = i.table_name
 			WHERE t.owner = :1
 			ORDER BY (s.bytes + i.index_size) DESC
-			FETCH FIRST 10 ROWS ONLY
 		`
-		tableRows, err := db.Query(tableQuery, database)
+		tableQuery = oracleTopN(conn.Server, tableQuery, 10)
+		tableRows, err := db.QueryContext(ctx, tableQuery, database)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get table information: %w", err)
 		}
@@ -209,13 +347,14 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 
 		for tableRows.Next() {
 			var table stats.TableInfo
-			var dataSize, indexSize sql.NullInt64
+			var numRows, dataSize, indexSize sql.NullInt64
 
-			err := tableRows.Scan(&table.Name, &table.Rows, &dataSize, &indexSize)
+			err := tableRows.Scan(&table.Name, &numRows, &dataSize, &indexSize)
 			if err != nil {
 				continue
 			}
 
+			table.Rows = numRows.Int64
 			if dataSize.Valid {
 				table.DataSize = dataSize.Int64
 			}
@@ -247,9 +386,9 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 				GROUP BY owner, table_name
 			) i ON t.owner = i.owner AND t.table_name = i.table_name
 			ORDER BY (s.bytes + i.index_size) DESC
-			FETCH FIRST 20 ROWS ONLY
 		`
-		tableRows, err := db.Query(tableQuery)
+		tableQuery = oracleTopN(conn.Server, tableQuery, 20)
+		tableRows, err := db.QueryContext(ctx, tableQuery)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get table information: %w", err)
 		}
@@ -257,13 +396,14 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 
 		for tableRows.Next() {
 			var table stats.TableInfo
-			var dataSize, indexSize sql.NullInt64
+			var numRows, dataSize, indexSize sql.NullInt64
 
-			err := tableRows.Scan(&table.Name, &table.Rows, &dataSize, &indexSize)
+			err := tableRows.Scan(&table.Name, &numRows, &dataSize, &indexSize)
 			if err != nil {
 				continue
 			}
 
+			table.Rows = numRows.Int64
 			if dataSize.Valid {
 				table.DataSize = dataSize.Int64
 			}
@@ -277,3 +417,222 @@ func (d *oracleDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseSta
 
 	return result, nil
 }
+
+func (d *oracleDriver) KillProcess(ctx context.Context, conn *Conn, process stats.ProcessInfo) error {
+	// ALTER SYSTEM does not accept bind variables; both values are numbers
+	query := fmt.Sprintf("ALTER SYSTEM KILL SESSION '%d,%d' IMMEDIATE", process.ID, process.Serial)
+	if _, err := conn.DB.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to kill session %d,%d: %w", process.ID, process.Serial, err)
+	}
+	return nil
+}
+
+func (d *oracleDriver) CancelQuery(ctx context.Context, conn *Conn, process stats.ProcessInfo) error {
+	query := fmt.Sprintf("ALTER SYSTEM CANCEL SQL '%d,%d'", process.ID, process.Serial)
+	if _, err := conn.DB.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to cancel SQL of session %d,%d: %w", process.ID, process.Serial, err)
+	}
+	return nil
+}
+
+func (d *oracleDriver) Explain(ctx context.Context, conn *Conn, process stats.ProcessInfo) (*stats.QueryPlan, error) {
+	if process.SQLID == "" {
+		return nil, fmt.Errorf("session %d is not running a statement", process.ID)
+	}
+
+	rows, err := conn.DB.QueryContext(ctx, `
+		SELECT plan_table_output
+		FROM TABLE(DBMS_XPLAN.DISPLAY_CURSOR(:1, NULL, 'TYPICAL'))
+	`, process.SQLID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to explain sql_id %s: %w", process.SQLID, err)
+	}
+	defer rows.Close()
+
+	plan := &stats.QueryPlan{}
+	for rows.Next() {
+		var line sql.NullString
+		if err := rows.Scan(&line); err != nil {
+			return nil, fmt.Errorf("failed to read plan of sql_id %s: %w", process.SQLID, err)
+		}
+		plan.Text = append(plan.Text, line.String)
+	}
+	return plan, rows.Err()
+}
+
+// oracleTopN limits an ordered query to its first n rows. The row limiting
+// clause needs 12c; older servers filter on ROWNUM around the query.
+func oracleTopN(server stats.ServerInfo, query string, n int) string {
+	if server.AtLeast(12) {
+		return fmt.Sprintf("%s FETCH FIRST %d ROWS ONLY", query, n)
+	}
+	return fmt.Sprintf("SELECT * FROM (%s) WHERE ROWNUM <= %d", query, n)
+}
+
+// getLockWaits returns the sessions with a blocking session in v$session
+func (d *oracleDriver) getLockWaits(ctx context.Context, db *sql.DB, database string) ([]stats.LockWait, error) {
+	query := `
+		SELECT
+			sid,
+			blocking_session,
+			seconds_in_wait,
+			event,
+			CASE WHEN row_wait_obj# > 0 THEN TO_CHAR(row_wait_obj#) END
+		FROM v$session
+		WHERE blocking_session IS NOT NULL
+	`
+	var rows *sql.Rows
+	var err error
+	if database != "" {
+		rows, err = db.QueryContext(ctx, query+" AND schemaname = :1", database)
+	} else {
+		rows, err = db.QueryContext(ctx, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scanLockWaits(rows)
+}
+
+// getReplication returns the Data Guard transport and apply lag of a
+// standby database
+func (d *oracleDriver) getReplication(ctx context.Context, db *sql.DB) (*stats.Replication, error) {
+	var role string
+	if err := db.QueryRowContext(ctx, "SELECT database_role FROM v$database").Scan(&role); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT name, value FROM v$dataguard_stats WHERE name IN ('transport lag', 'apply lag')")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channel := stats.ReplicationChannel{Name: "Data Guard"}
+	found := false
+	for rows.Next() {
+		var name string
+		var value sql.NullString
+
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		found = true
+
+		seconds, ok := parseDayToSecond(value.String)
+		switch name {
+		case "transport lag":
+			channel.IOState = "transport lag " + value.String
+		case "apply lag":
+			channel.SQLState = "apply lag " + value.String
+			channel.Lag = seconds
+			channel.LagKnown = ok
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if role == "PRIMARY" && !found {
+		return nil, nil
+	}
+
+	replication := &stats.Replication{Role: strings.ToLower(role)}
+	if found {
+		replication.Channels = append(replication.Channels, channel)
+	}
+	summarizeLag(replication)
+	return replication, nil
+}
+
+// parseDayToSecond parses an INTERVAL DAY TO SECOND value as reported by
+// v$dataguard_stats, e.g. "+00 00:00:05", into seconds
+func parseDayToSecond(value string) (float64, bool) {
+	days, clock, ok := strings.Cut(strings.TrimPrefix(strings.TrimSpace(value), "+"), " ")
+	if !ok {
+		return 0, false
+	}
+	parts := strings.Split(clock, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+
+	d, err1 := strconv.ParseFloat(days, 64)
+	h, err2 := strconv.ParseFloat(parts[0], 64)
+	m, err3 := strconv.ParseFloat(parts[1], 64)
+	s, err4 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return 0, false
+	}
+	return d*86400 + h*3600 + m*60 + s, true
+}
+
+// getWaitEvents returns the cumulative non-idle wait events of the instance
+func (d *oracleDriver) getWaitEvents(ctx context.Context, db *sql.DB) ([]stats.WaitEvent, error) {
+	query := `
+		SELECT
+			event,
+			wait_class,
+			total_waits,
+			time_waited_micro / 1000
+		FROM v$system_event
+		WHERE wait_class <> 'Idle'
+	`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []stats.WaitEvent
+	for rows.Next() {
+		var event stats.WaitEvent
+		if err := rows.Scan(&event.Event, &event.WaitClass, &event.Total.Waits, &event.Total.Time); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// getActiveSessions samples the sessions that are on CPU or waiting on a
+// non-idle event, like Active Session History does but without requiring
+// the Diagnostics Pack. The monitoring session itself is left out.
+func (d *oracleDriver) getActiveSessions(ctx context.Context, db *sql.DB, database string) ([]stats.ActiveSession, error) {
+	query := `
+		SELECT
+			sid,
+			CASE WHEN state = 'WAITING' THEN event ELSE 'ON CPU' END,
+			CASE WHEN state = 'WAITING' THEN wait_class ELSE 'CPU' END,
+			sql_id
+		FROM v$session
+		WHERE status = 'ACTIVE'
+		AND (state <> 'WAITING' OR wait_class <> 'Idle')
+		AND sid <> SYS_CONTEXT('USERENV', 'SID')
+	`
+	var rows *sql.Rows
+	var err error
+	if database != "" {
+		rows, err = db.QueryContext(ctx, query+" AND schemaname = :1", database)
+	} else {
+		rows, err = db.QueryContext(ctx, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []stats.ActiveSession
+	for rows.Next() {
+		var session stats.ActiveSession
+		var sqlID sql.NullString
+
+		if err := rows.Scan(&session.ID, &session.Event, &session.WaitClass, &sqlID); err != nil {
+			return nil, err
+		}
+		session.SQLID = sqlID.String
+
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
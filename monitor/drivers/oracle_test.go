@@ -0,0 +1,292 @@
+//go:build !crosscompile
+// +build !crosscompile
+
+package drivers
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"dbtop/config"
+	"dbtop/monitor/stats"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/godror/godror"
+)
+
+func TestOracleCollect(t *testing.T) {
+	sessionColumns := []string{"sid", "serial#", "username", "machine", "schemaname", "status", "logon_time", "sql_id", "sql_text"}
+	lockColumns := []string{"sid", "blocking_session", "seconds_in_wait", "event", "row_wait_obj#"}
+	eventColumns := []string{"event", "wait_class", "total_waits", "time_waited"}
+	activeColumns := []string{"sid", "event", "wait_class", "sql_id"}
+	logonTime := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name     string
+		database string
+		expect   func(mock sqlmock.Sqlmock)
+		want     *stats.DatabaseStats
+	}{
+		{
+			name: "all schemas",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("WHERE status = 'ACTIVE' AND username IS NOT NULL")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("WHERE username IS NOT NULL")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM v$instance")).
+					WillReturnRows(sqlmock.NewRows([]string{"uptime"}).AddRow(7200))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM v$sysstat")).
+					WillReturnRows(sqlmock.NewRows([]string{"name", "value"}).
+						AddRow("execute count", 500).
+						AddRow("user commits", 40).
+						AddRow("user rollbacks", 2))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM v$session s")).
+					WillReturnRows(sqlmock.NewRows(sessionColumns).
+						AddRow(12, 345, "SCOTT", "app01", "SCOTT", "ACTIVE", logonTime, "abc123", "SELECT * FROM emp").
+						AddRow(13, 9, "SYSTEM", "dba01", "SYSTEM", "INACTIVE", nil, nil, nil))
+				mock.ExpectQuery(regexp.QuoteMeta("WHERE blocking_session IS NOT NULL")).
+					WillReturnRows(sqlmock.NewRows(lockColumns).
+						AddRow(12, 13, 45, "enq: TX - row lock contention", "73181"))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM v$database")).
+					WillReturnError(errors.New("ORA-01031: insufficient privileges"))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM v$system_event")).
+					WillReturnRows(sqlmock.NewRows(eventColumns).
+						AddRow("db file sequential read", "User I/O", 1000, 2500.5).
+						AddRow("log file sync", "Commit", 40, 80))
+				mock.ExpectQuery(regexp.QuoteMeta("OR wait_class <> 'Idle')")).
+					WillReturnRows(sqlmock.NewRows(activeColumns).
+						AddRow(12, "ON CPU", "CPU", "abc123").
+						AddRow(14, "db file sequential read", "User I/O", nil))
+				mock.ExpectQuery(regexp.QuoteMeta("t.owner || '.' || t.table_name")).
+					WillReturnRows(sqlmock.NewRows([]string{"table_name", "num_rows", "data_size", "index_size"}).
+						AddRow("SCOTT.EMP", nil, 65536, nil))
+			},
+			want: &stats.DatabaseStats{
+				ActiveConnections: 1,
+				TotalConnections:  4,
+				Uptime:            2 * time.Hour,
+				Counters:          stats.Counters{Queries: 500, Commits: 40, Rollbacks: 2},
+				Processes: []stats.ProcessInfo{
+					{ID: 12, Serial: 345, User: "SCOTT", Host: "app01", Database: "SCOTT", State: "ACTIVE", Time: 60, Info: "SELECT * FROM emp", SQLID: "abc123"},
+					{ID: 13, Serial: 9, User: "SYSTEM", Host: "dba01", Database: "SYSTEM", State: "INACTIVE"},
+				},
+				Threads: stats.ThreadStats{Locked: 1},
+				Locks: []stats.LockWait{
+					{WaitingID: 12, BlockingID: 13, WaitTime: 45, LockType: "enq: TX - row lock contention", Object: "73181"},
+				},
+				WaitEvents: []stats.WaitEvent{
+					{Event: "db file sequential read", WaitClass: "User I/O", Total: stats.WaitCounters{Waits: 1000, Time: 2500.5}},
+					{Event: "log file sync", WaitClass: "Commit", Total: stats.WaitCounters{Waits: 40, Time: 80}},
+				},
+				ActiveSessions: []stats.ActiveSession{
+					{ID: 12, Event: "ON CPU", WaitClass: "CPU", SQLID: "abc123"},
+					{ID: 14, Event: "db file sequential read", WaitClass: "User I/O"},
+				},
+				Tables: []stats.TableInfo{
+					{Name: "SCOTT.EMP", DataSize: 65536},
+				},
+				Warnings: []string{"failed to get replication status: ORA-01031: insufficient privileges"},
+			},
+		},
+		{
+			name:     "single schema",
+			database: "SCOTT",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("AND schemaname = :1")).
+					WithArgs("SCOTT").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta("AND schemaname = :1")).
+					WithArgs("SCOTT").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM v$instance")).
+					WillReturnRows(sqlmock.NewRows([]string{"uptime"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM v$sysstat")).
+					WillReturnRows(sqlmock.NewRows([]string{"name", "value"}))
+				mock.ExpectQuery(regexp.QuoteMeta("AND s.schemaname = :1")).
+					WithArgs("SCOTT").
+					WillReturnRows(sqlmock.NewRows(sessionColumns))
+				mock.ExpectQuery(regexp.QuoteMeta("blocking_session IS NOT NULL AND schemaname = :1")).
+					WithArgs("SCOTT").
+					WillReturnRows(sqlmock.NewRows(lockColumns))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM v$database")).
+					WillReturnRows(sqlmock.NewRows([]string{"database_role"}).AddRow("PHYSICAL STANDBY"))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM v$dataguard_stats")).
+					WillReturnRows(sqlmock.NewRows([]string{"name", "value"}).
+						AddRow("transport lag", "+00 00:00:02").
+						AddRow("apply lag", "+00 00:01:05"))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM v$system_event")).
+					WillReturnError(errors.New("ORA-00942: table or view does not exist"))
+				mock.ExpectQuery(regexp.QuoteMeta("SYS_CONTEXT('USERENV', 'SID') AND schemaname = :1")).
+					WithArgs("SCOTT").
+					WillReturnRows(sqlmock.NewRows(activeColumns))
+				mock.ExpectQuery(regexp.QuoteMeta("WHERE t.owner = :1")).
+					WithArgs("SCOTT").
+					WillReturnRows(sqlmock.NewRows([]string{"table_name", "num_rows", "data_size", "index_size"}).
+						AddRow("EMP", 14, 65536, 16384))
+			},
+			want: &stats.DatabaseStats{
+				TotalConnections: 2,
+				Uptime:           time.Second,
+				Replication: &stats.Replication{
+					Role:     "physical standby",
+					Lag:      65,
+					LagKnown: true,
+					Channels: []stats.ReplicationChannel{
+						{Name: "Data Guard", IOState: "transport lag +00 00:00:02", SQLState: "apply lag +00 00:01:05", Lag: 65, LagKnown: true},
+					},
+				},
+				Tables: []stats.TableInfo{
+					{Name: "EMP", Rows: 14, DataSize: 65536, IndexSize: 16384},
+				},
+				Warnings: []string{"failed to get wait events: ORA-00942: table or view does not exist"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMock(t)
+			tt.expect(mock)
+
+			got, err := (&oracleDriver{}).Collect(context.Background(), recentConn(db), tt.database)
+			if err != nil {
+				t.Fatalf("Collect failed: %v", err)
+			}
+			checkStats(t, got, tt.want)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestOracleKillProcess(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectExec(regexp.QuoteMeta("ALTER SYSTEM KILL SESSION '12,345' IMMEDIATE")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := (&oracleDriver{}).KillProcess(context.Background(), recentConn(db), stats.ProcessInfo{ID: 12, Serial: 345}); err != nil {
+		t.Errorf("KillProcess failed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOracleServerInfo(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM product_component_version")).
+		WillReturnRows(sqlmock.NewRows([]string{"PRODUCT", "VERSION"}).
+			AddRow("Oracle Database 12c Standard Edition ", "12.2.0.1.0"))
+
+	driver := &oracleDriver{}
+	server, err := driver.ServerInfo(context.Background(), db)
+	if err != nil {
+		t.Fatalf("ServerInfo failed: %v", err)
+	}
+	if want := (stats.ServerInfo{Flavor: "oracle", Version: "12.2.0.1.0", Edition: "Standard"}); server != want {
+		t.Errorf("ServerInfo = %+v, want %+v", server, want)
+	}
+
+	// ALTER SYSTEM CANCEL SQL needs 18c
+	if got := driver.Capabilities(server); got.Has(stats.CapCancel) || got.Has(stats.CapDigests) || !got.Has(stats.CapKill) {
+		t.Errorf("Capabilities = %s, want kill without cancel and digests", got)
+	}
+}
+
+func TestOracleRowLimitVariants(t *testing.T) {
+	tests := []struct {
+		version      string
+		dir          string
+		sessionLimit string
+		tableLimit   string
+		want         *stats.DatabaseStats
+	}{
+		{
+			// 11g has no FETCH FIRST, so the queries are wrapped in ROWNUM
+			version:      "11.2.0.4.0",
+			dir:          "oracle/11.2",
+			sessionLimit: "WHERE ROWNUM <= 50",
+			tableLimit:   "WHERE ROWNUM <= 20",
+			want: &stats.DatabaseStats{
+				Processes: []stats.ProcessInfo{
+					{ID: 131, Serial: 2291, User: "SCOTT", Host: "app01", Database: "SCOTT", State: "ACTIVE", Info: "SELECT ename FROM emp WHERE deptno = :1", SQLID: "7h35uxf5uhmm1"},
+					{ID: 142, Serial: 87, User: "HR", Host: "app02", Database: "HR", State: "INACTIVE"},
+				},
+				Tables: []stats.TableInfo{
+					{Name: "SCOTT.EMP", Rows: 14, DataSize: 65536, IndexSize: 131072},
+					{Name: "HR.EMPLOYEES", Rows: 107, DataSize: 65536},
+				},
+			},
+		},
+		{
+			version:      "19.0.0.0.0",
+			dir:          "oracle/19",
+			sessionLimit: "FETCH FIRST 50 ROWS ONLY",
+			tableLimit:   "FETCH FIRST 20 ROWS ONLY",
+			want: &stats.DatabaseStats{
+				Processes: []stats.ProcessInfo{
+					{ID: 258, Serial: 41775, User: "SCOTT", Host: "app01", Database: "SCOTT", State: "ACTIVE", Info: "SELECT COUNT(*) FROM emp", SQLID: "g0bggfqrddc4w"},
+				},
+				Tables: []stats.TableInfo{
+					{Name: "SCOTT.EMP", Rows: 14, DataSize: 65536, IndexSize: 65536},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			db, mock := newMock(t)
+			mock.ExpectQuery(regexp.QuoteMeta("WHERE status = 'ACTIVE' AND username IS NOT NULL")).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery(regexp.QuoteMeta("WHERE username IS NOT NULL")).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery(regexp.QuoteMeta("FROM v$instance")).
+				WillReturnRows(sqlmock.NewRows([]string{"uptime"}).AddRow(0))
+			mock.ExpectQuery(regexp.QuoteMeta("FROM v$sysstat")).
+				WillReturnRows(sqlmock.NewRows([]string{"name", "value"}))
+			mock.ExpectQuery(`(?s)FROM v\$session s.*` + regexp.QuoteMeta(tt.sessionLimit)).
+				WillReturnRows(fixture(t, tt.dir+"/sessions.csv"))
+			mock.ExpectQuery(regexp.QuoteMeta("FROM v$system_event")).
+				WillReturnRows(sqlmock.NewRows([]string{"event", "wait_class", "total_waits", "time_waited"}))
+			mock.ExpectQuery(regexp.QuoteMeta("OR wait_class <> 'Idle')")).
+				WillReturnRows(sqlmock.NewRows([]string{"sid", "event", "wait_class", "sql_id"}))
+			mock.ExpectQuery(`(?s)t.owner \|\| '.' \|\| t.table_name.*` + regexp.QuoteMeta(tt.tableLimit)).
+				WillReturnRows(fixture(t, tt.dir+"/tables.csv"))
+
+			conn := &Conn{DB: db, Server: stats.ServerInfo{Flavor: "oracle", Version: tt.version}, Capabilities: stats.CapTables | stats.CapKill}
+			got, err := (&oracleDriver{}).Collect(context.Background(), conn, "")
+			if err != nil {
+				t.Fatalf("Collect failed: %v", err)
+			}
+			checkStats(t, got, tt.want)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestOracleTLSDSN(t *testing.T) {
+	// The TLS settings are merged into the DSN instead of replacing it
+	instance := config.DatabaseInstance{TLS: &config.TLSConfig{Wallet: "/etc/wallet"}}
+	dsn, err := oracleTLSDSN(instance, `user="monitor" password="se\"cret" connectString="db.example.com:2484/ORCLPDB1?connect_timeout=5" poolMaxSessions=3`)
+	if err != nil {
+		t.Fatalf("oracleTLSDSN failed: %v", err)
+	}
+	params, err := godror.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("ParseDSN(%s) failed: %v", dsn, err)
+	}
+	want := "tcps://db.example.com:2484/ORCLPDB1?connect_timeout=5&ssl_server_dn_match=on&wallet_location=/etc/wallet"
+	if params.Username != "monitor" || params.Password.Secret() != `se"cret` || params.ConnectString != want || params.MaxSessions != 3 {
+		t.Errorf("oracleTLSDSN = %s, want the same user, password, and pool with connect string %s", dsn, want)
+	}
+}
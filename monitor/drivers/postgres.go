@@ -1,12 +1,19 @@
 package drivers
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"dbtop/config"
 	"dbtop/monitor/stats"
+	"dbtop/tunnel"
 
 	_ "github.com/lib/pq"
 )
@@ -18,26 +25,172 @@ func init() {
 	RegisterDriver("postgresql", &postgresDriver{})
 }
 
-func (d *postgresDriver) Connect(instance config.DatabaseInstance) (*sql.DB, error) {
+func (d *postgresDriver) Connect(ctx context.Context, instance config.DatabaseInstance) (*Conn, error) {
+	tlsParams, err := postgresTLS(&instance)
+	if err != nil {
+		return nil, err
+	}
+
+	var t *tunnel.Tunnel
+	if instance.SSH != nil {
+		if t, err = openTunnel(ctx, instance); err != nil {
+			return nil, err
+		}
+	}
+
 	dsn := instance.GetDSN()
 	if dsn == "" {
 		dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 			instance.Host, instance.Port, instance.Username, instance.Password, instance.Database, instance.SSLMode)
 	}
+	dsn += tlsParams
 
-	db, err := sql.Open("postgres", dsn)
+	db, err := openPostgres(t, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
 
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return db, nil
+	conn := newConn(ctx, d, db, "postgres")
+	if instance.Database == "" {
+		// pg_stat_user_tables only covers the database connected to, so the
+		// tables of the others are read over connections of their own,
+		// through the same tunnel
+		conn.openDatabase = func(name string) (*sql.DB, error) {
+			connector, err := postgresConnector(t, dsn+" dbname="+postgresQuote(name))
+			if err != nil {
+				return nil, err
+			}
+			return sql.OpenDB(connector), nil
+		}
+		conn.databases = instance.Databases
+	}
+	return conn, nil
+}
+
+func (d *postgresDriver) ServerInfo(ctx context.Context, db *sql.DB) (stats.ServerInfo, error) {
+	var version string
+	if err := db.QueryRowContext(ctx, "SHOW server_version").Scan(&version); err != nil {
+		return stats.ServerInfo{}, fmt.Errorf("failed to get server version: %w", err)
+	}
+	// Packaged servers append the distribution, e.g. "16.2 (Debian 16.2-1)"
+	if fields := strings.Fields(version); len(fields) > 0 {
+		version = fields[0]
+	}
+	return stats.ServerInfo{Flavor: "postgres", Version: version}, nil
+}
+
+// Capabilities enables JSON plans from PostgreSQL 9.0, pg_stat_statements
+// query IDs from 9.4, and pg_blocking_pids and pg_stat_wal_receiver from
+// 9.6
+func (d *postgresDriver) Capabilities(server stats.ServerInfo) stats.Capabilities {
+	capabilities := stats.CapKill | stats.CapCancel | stats.CapTables
+	if server.AtLeast(9, 0) {
+		capabilities |= stats.CapExplain
+	}
+	if server.AtLeast(9, 4) {
+		capabilities |= stats.CapDigests
+	}
+	if server.AtLeast(9, 6) {
+		capabilities |= stats.CapLocks | stats.CapReplication
+	}
+	return capabilities
+}
+
+// postgresCatalog holds the catalog expressions that changed between
+// PostgreSQL versions
+type postgresCatalog struct {
+	backendType   string // pg_stat_activity.backend_type
+	waitEventType string
+	waitEvent     string
+	backendXID    string
+	backendXmin   string
+	lockWaitStart string // when a blocked session started waiting
+
+	senderHost   string // pg_stat_wal_receiver.sender_host
+	senderPort   string
+	replayPaused string // function reporting whether WAL replay is paused
+	lsnDiff      string // function subtracting WAL positions
+	currentLSN   string // function returning the current WAL position
+	receiveLSN   string // function returning the last received WAL position
+	sentLSN      string // pg_stat_replication columns
+	replayLSN    string
+	writeLag     string
+	flushLag     string
+	replayLag    string
+}
+
+// newPostgresCatalog returns the catalog expressions for the server
+// version. Unknown versions get the current catalog.
+func newPostgresCatalog(server stats.ServerInfo) postgresCatalog {
+	catalog := postgresCatalog{
+		backendType:   "backend_type",
+		waitEventType: "wait_event_type",
+		waitEvent:     "wait_event",
+		backendXID:    "backend_xid::text",
+		backendXmin:   "backend_xmin::text",
+		lockWaitStart: "l.waitstart",
+		senderHost:    "r.sender_host",
+		senderPort:    "r.sender_port",
+		replayPaused:  "pg_is_wal_replay_paused",
+		lsnDiff:       "pg_wal_lsn_diff",
+		currentLSN:    "pg_current_wal_lsn",
+		receiveLSN:    "pg_last_wal_receive_lsn",
+		sentLSN:       "sent_lsn",
+		replayLSN:     "replay_lsn",
+		writeLag:      "write_lag",
+		flushLag:      "flush_lag",
+		replayLag:     "replay_lag",
+	}
+
+	// pg_locks shows when a wait began from 14; before, the wait is
+	// measured from the start of the blocked statement
+	if !server.AtLeast(14) {
+		catalog.lockWaitStart = "a.query_start"
+	}
+
+	// The WAL receiver shows its source from 11
+	if !server.AtLeast(11) {
+		catalog.senderHost = "NULL::text"
+		catalog.senderPort = "NULL::integer"
+	}
+
+	// 10 renamed xlog to wal and location to lsn, added the replication
+	// lag columns, and started listing background processes
+	if !server.AtLeast(10) {
+		catalog.backendType = "'client backend'"
+		catalog.replayPaused = "pg_is_xlog_replay_paused"
+		catalog.lsnDiff = "pg_xlog_location_diff"
+		catalog.currentLSN = "pg_current_xlog_location"
+		catalog.receiveLSN = "pg_last_xlog_receive_location"
+		catalog.sentLSN = "sent_location"
+		catalog.replayLSN = "replay_location"
+		catalog.writeLag = "NULL::interval"
+		catalog.flushLag = "NULL::interval"
+		catalog.replayLag = "NULL::interval"
+	}
+
+	// Wait events replaced the waiting flag, which only covered heavyweight
+	// locks, in 9.6
+	if !server.AtLeast(9, 6) {
+		catalog.waitEventType = "CASE WHEN waiting THEN 'Lock' END"
+		catalog.waitEvent = "NULL::text"
+	}
+
+	// The transaction ID columns were added in 9.4
+	if !server.AtLeast(9, 4) {
+		catalog.backendXID = "NULL::text"
+		catalog.backendXmin = "NULL::text"
+	}
+	return catalog
 }
 
-func (d *postgresDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseStats, error) {
+func (d *postgresDriver) Collect(ctx context.Context, conn *Conn, database string) (*stats.DatabaseStats, error) {
+	db := conn.DB
 	result := &stats.DatabaseStats{
 		Timestamp: time.Now(),
 	}
@@ -47,12 +200,12 @@ func (d *postgresDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseS
 	activeQuery := "SELECT count(*) FROM pg_stat_activity WHERE state = 'active'"
 	if database != "" {
 		activeQuery += " AND datname = $1"
-		err := db.QueryRow(activeQuery, database).Scan(&activeConnections)
+		err := db.QueryRowContext(ctx, activeQuery, database).Scan(&activeConnections)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get active connections: %w", err)
 		}
 	} else {
-		err := db.QueryRow(activeQuery).Scan(&activeConnections)
+		err := db.QueryRowContext(ctx, activeQuery).Scan(&activeConnections)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get active connections: %w", err)
 		}
@@ -64,12 +217,12 @@ func (d *postgresDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseS
 	totalQuery := "SELECT count(*) FROM pg_stat_activity"
 	if database != "" {
 		totalQuery += " WHERE datname = $1"
-		err := db.QueryRow(totalQuery, database).Scan(&totalConnections)
+		err := db.QueryRowContext(ctx, totalQuery, database).Scan(&totalConnections)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get total connections: %w", err)
 		}
 	} else {
-		err := db.QueryRow(totalQuery).Scan(&totalConnections)
+		err := db.QueryRowContext(ctx, totalQuery).Scan(&totalConnections)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get total connections: %w", err)
 		}
@@ -78,14 +231,41 @@ func (d *postgresDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseS
 
 	// Get uptime
 	var uptimeSeconds int64
-	err := db.QueryRow("SELECT EXTRACT(EPOCH FROM (now() - pg_postmaster_start_time()))").Scan(&uptimeSeconds)
+	err := db.QueryRowContext(ctx, "SELECT EXTRACT(EPOCH FROM (now() - pg_postmaster_start_time()))::bigint").Scan(&uptimeSeconds)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get uptime: %w", err)
 	}
 	result.Uptime = time.Duration(uptimeSeconds) * time.Second
 
+	// Get cumulative activity counters
+	counterQuery := `
+		SELECT
+			COALESCE(sum(xact_commit), 0),
+			COALESCE(sum(xact_rollback), 0),
+			COALESCE(sum(tup_returned), 0),
+			COALESCE(sum(tup_inserted), 0),
+			COALESCE(sum(tup_updated), 0),
+			COALESCE(sum(tup_deleted), 0)
+		FROM pg_stat_database
+	`
+	var counterRow *sql.Row
+	if database != "" {
+		counterRow = db.QueryRowContext(ctx, counterQuery+" WHERE datname = $1", database)
+	} else {
+		counterRow = db.QueryRowContext(ctx, counterQuery)
+	}
+	counters := &result.Counters
+	err = counterRow.Scan(&counters.Commits, &counters.Rollbacks, &counters.RowsRead,
+		&counters.RowsInserted, &counters.RowsUpdated, &counters.RowsDeleted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get activity counters: %w", err)
+	}
+	// PostgreSQL has no statement counter; transactions are the closest proxy
+	counters.Queries = counters.Commits + counters.Rollbacks
+
 	// Get process information
-	processQuery := `
+	catalog := newPostgresCatalog(conn.Server)
+	processQuery := fmt.Sprintf(`
 		SELECT 
 			pid,
 			usename,
@@ -93,10 +273,16 @@ func (d *postgresDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseS
 			datname,
 			state,
 			query_start,
-			query
+			query,
+			%s,
+			%s,
+			%s,
+			xact_start,
+			%s,
+			%s
 		FROM pg_stat_activity 
 		WHERE state IS NOT NULL
-	`
+	`, catalog.waitEventType, catalog.waitEvent, catalog.backendType, catalog.backendXID, catalog.backendXmin)
 	if database != "" {
 		processQuery += " AND datname = $1"
 	}
@@ -105,9 +291,9 @@ func (d *postgresDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseS
 	var rows *sql.Rows
 	var err2 error
 	if database != "" {
-		rows, err2 = db.Query(processQuery, database)
+		rows, err2 = db.QueryContext(ctx, processQuery, database)
 	} else {
-		rows, err2 = db.Query(processQuery)
+		rows, err2 = db.QueryContext(ctx, processQuery)
 	}
 	if err2 != nil {
 		return nil, fmt.Errorf("failed to get process information: %w", err2)
@@ -116,14 +302,26 @@ func (d *postgresDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseS
 
 	for rows.Next() {
 		var process stats.ProcessInfo
+		var userName, databaseName sql.NullString
 		var queryStart sql.NullTime
 		var query sql.NullString
 		var clientAddr sql.NullString
+		var waitEventType, waitEvent, backendType sql.NullString
+		var xactStart sql.NullTime
+		var backendXID, backendXmin sql.NullString
 
-		err := rows.Scan(&process.ID, &process.User, &clientAddr, &process.Database, &process.State, &queryStart, &query)
+		err := rows.Scan(&process.ID, &userName, &clientAddr, &databaseName, &process.State, &queryStart, &query,
+			&waitEventType, &waitEvent, &backendType, &xactStart, &backendXID, &backendXmin)
 		if err != nil {
 			continue
 		}
+		process.User = userName.String
+		process.Database = databaseName.String
+		process.WaitEventType = waitEventType.String
+		process.WaitEvent = waitEvent.String
+		process.BackendType = backendType.String
+		process.BackendXID = backendXID.String
+		process.BackendXmin = backendXmin.String
 
 		if clientAddr.Valid {
 			process.Host = clientAddr.String
@@ -138,16 +336,68 @@ func (d *postgresDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseS
 		if queryStart.Valid {
 			process.Time = int64(time.Since(queryStart.Time).Seconds())
 		}
+		if xactStart.Valid {
+			process.TransactionTime = int64(time.Since(xactStart.Time).Seconds())
+		}
 
 		result.Processes = append(result.Processes, process)
 	}
 
-	// Get table information
+	// Summarize all sessions by backend type, state, and wait event, and
+	// sample the active ones for the wait class chart
+	if groups, err := d.getSessionGroups(ctx, db, catalog, database); optional(result, "session groups", err) {
+		result.SessionGroups = groups
+		result.ActiveSessions = activeSessions(groups)
+	}
+
+	// Get lock waits
+	if conn.Capabilities.Has(stats.CapLocks) {
+		if locks, err := d.getLockWaits(ctx, db, catalog, database); optional(result, "lock waits", err) {
+			result.Locks = locks
+			result.Threads.Locked = lockedSessions(locks)
+		}
+	}
+
+	// Get replication status
+	if conn.Capabilities.Has(stats.CapReplication) {
+		if replication, err := d.getReplication(ctx, db, catalog); optional(result, "replication status", err) {
+			result.Replication = replication
+		}
+	}
+
+	// Get the top statements from pg_stat_statements, or the reason they
+	// are unavailable
+	if conn.Capabilities.Has(stats.CapDigests) {
+		result.Statements, result.StatementsMessage = d.getStatements(ctx, db, database)
+		result.StatementsSource = "pg_stat_statements"
+	}
+
+	// Get table information, from every database when the instance is not
+	// limited to one
+	if database == "" && conn.openDatabase != nil {
+		tables, err := d.getDatabaseTables(ctx, conn, result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get table information: %w", err)
+		}
+		result.Tables = tables
+	} else {
+		tables, err := d.getTables(ctx, db, database)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get table information: %w", err)
+		}
+		result.Tables = tables
+	}
+
+	return result, nil
+}
+
+// getTables returns the largest tables of the database db is connected to
+func (d *postgresDriver) getTables(ctx context.Context, db *sql.DB, database string) ([]stats.TableInfo, error) {
 	tableQuery := `
 		SELECT 
-			schemaname || '.' || tablename as table_name,
+			schemaname || '.' || relname as table_name,
 			n_tup_ins + n_tup_upd + n_tup_del as total_rows,
-			pg_total_relation_size(schemaname || '.' || tablename) as total_size
+			pg_total_relation_size(relid) as total_size
 		FROM pg_stat_user_tables 
 	`
 	if database != "" {
@@ -155,18 +405,13 @@ func (d *postgresDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseS
 	}
 	tableQuery += " ORDER BY total_size DESC LIMIT 10"
 
-	var tableRows *sql.Rows
-	var err3 error
-	if database != "" {
-		tableRows, err3 = db.Query(tableQuery)
-	} else {
-		tableRows, err3 = db.Query(tableQuery)
-	}
-	if err3 != nil {
-		return nil, fmt.Errorf("failed to get table information: %w", err3)
+	tableRows, err := db.QueryContext(ctx, tableQuery)
+	if err != nil {
+		return nil, err
 	}
 	defer tableRows.Close()
 
+	var tables []stats.TableInfo
 	for tableRows.Next() {
 		var table stats.TableInfo
 		var totalSize int64
@@ -177,8 +422,606 @@ func (d *postgresDriver) GetStats(db *sql.DB, database string) (*stats.DatabaseS
 		}
 
 		table.DataSize = totalSize
-		result.Tables = append(result.Tables, table)
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// maxDatabaseTables limits the tables merged from all databases
+const maxDatabaseTables = 20
+
+// getDatabaseTables reads each database in pg_database that the instance's
+// filter selects and returns their largest tables, named
+// database.schema.table. Databases that cannot be read, e.g. for lack of
+// the CONNECT privilege, or that are left when time runs out are reported
+// as warnings.
+func (d *postgresDriver) getDatabaseTables(ctx context.Context, conn *Conn, result *stats.DatabaseStats) ([]stats.TableInfo, error) {
+	rows, err := conn.DB.QueryContext(ctx, `
+		SELECT datname
+		FROM pg_database
+		WHERE datallowconn AND NOT datistemplate
+		ORDER BY datname
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	selected := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if conn.databases.Match(name) {
+			names = append(names, name)
+			selected[name] = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Close the handles of databases that were dropped
+	for name := range conn.handles {
+		if !selected[name] {
+			conn.closeDatabase(name)
+		}
+	}
+
+	var tables []stats.TableInfo
+	for i, name := range names {
+		if err := ctx.Err(); err != nil {
+			what := "tables of database " + name
+			if len(names[i:]) > 1 {
+				what = "tables of databases " + strings.Join(names[i:], ", ")
+			}
+			optional(result, what, err)
+			break
+		}
+		db, err := conn.database(name)
+		if !optional(result, "tables of database "+name, err) {
+			continue
+		}
+		databaseTables, err := d.getTables(ctx, db, "")
+		if !optional(result, "tables of database "+name, err) {
+			continue
+		}
+		for _, table := range databaseTables {
+			table.Name = name + "." + table.Name
+			tables = append(tables, table)
+		}
+	}
+
+	sort.SliceStable(tables, func(i, j int) bool {
+		return tables[i].DataSize > tables[j].DataSize
+	})
+	if len(tables) > maxDatabaseTables {
+		tables = tables[:maxDatabaseTables]
+	}
+	return tables, nil
+}
+
+func (d *postgresDriver) KillProcess(ctx context.Context, conn *Conn, process stats.ProcessInfo) error {
+	var terminated bool
+	if err := conn.DB.QueryRowContext(ctx, "SELECT pg_terminate_backend($1)", process.ID).Scan(&terminated); err != nil {
+		return fmt.Errorf("failed to terminate backend %d: %w", process.ID, err)
+	}
+	if !terminated {
+		return fmt.Errorf("backend %d not found", process.ID)
+	}
+	return nil
+}
+
+func (d *postgresDriver) CancelQuery(ctx context.Context, conn *Conn, process stats.ProcessInfo) error {
+	var cancelled bool
+	if err := conn.DB.QueryRowContext(ctx, "SELECT pg_cancel_backend($1)", process.ID).Scan(&cancelled); err != nil {
+		return fmt.Errorf("failed to cancel backend %d: %w", process.ID, err)
+	}
+	if !cancelled {
+		return fmt.Errorf("backend %d not found", process.ID)
+	}
+	return nil
+}
+
+func (d *postgresDriver) Explain(ctx context.Context, conn *Conn, process stats.ProcessInfo) (*stats.QueryPlan, error) {
+	if strings.TrimSpace(process.Info) == "" {
+		return nil, fmt.Errorf("backend %d has no query text", process.ID)
+	}
+
+	// The query text is sent back to the server, so only a single
+	// statement is explained
+	statements, params := scanPostgresQuery(process.Info)
+	if statements > 1 {
+		return nil, fmt.Errorf("query of backend %d contains several statements", process.ID)
+	}
+	explain := "EXPLAIN (FORMAT JSON) "
+	if params > 0 {
+		if !conn.Server.AtLeast(16) {
+			return nil, fmt.Errorf("query of backend %d has bind parameters ($1), which need PostgreSQL 16 to be explained", process.ID)
+		}
+		explain = "EXPLAIN (GENERIC_PLAN, FORMAT JSON) "
+	}
+
+	// EXPLAIN without ANALYZE does not run the statement; the read-only
+	// transaction guards against anything the checks above miss
+	tx, err := conn.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SET TRANSACTION READ ONLY"); err != nil {
+		return nil, fmt.Errorf("failed to make transaction read-only: %w", err)
+	}
+
+	var currentDatabase string
+	if err := tx.QueryRowContext(ctx, "SELECT current_database()").Scan(&currentDatabase); err != nil {
+		return nil, fmt.Errorf("failed to get current database: %w", err)
+	}
+	if process.Database != "" && process.Database != currentDatabase {
+		return nil, fmt.Errorf("query runs in database %s but dbtop is connected to %s", process.Database, currentDatabase)
+	}
+
+	// A prepared statement uses the extended query protocol, which refuses
+	// to run more than one statement. Generic plans do not depend on the
+	// parameter values, so they are bound to NULL.
+	stmt, err := tx.PrepareContext(ctx, explain+process.Info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to explain query of backend %d: %w", process.ID, err)
+	}
+	defer stmt.Close()
+
+	var document string
+	if err := stmt.QueryRowContext(ctx, make([]any, params)...).Scan(&document); err != nil {
+		return nil, fmt.Errorf("failed to explain query of backend %d: %w", process.ID, err)
+	}
+
+	var plans []struct {
+		Plan postgresPlan `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(document), &plans); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %w", err)
 	}
 
+	result := &stats.QueryPlan{}
+	for _, plan := range plans {
+		result.Nodes = append(result.Nodes, plan.Plan.node())
+	}
 	return result, nil
 }
+
+// scanPostgresQuery counts the statements in a query text and returns the
+// highest bind parameter number ($n) it uses. Literals, quoted identifiers,
+// and comments are skipped.
+func scanPostgresQuery(query string) (statements, params int) {
+	empty := true
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == ';':
+			if !empty {
+				statements++
+			}
+			empty = true
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(query)
+			}
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			// Block comments nest
+			depth := 0
+			for ; i < len(query); i++ {
+				if strings.HasPrefix(query[i:], "/*") {
+					depth++
+					i++
+				} else if strings.HasPrefix(query[i:], "*/") {
+					depth--
+					i++
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			continue
+		case c == '\'' || c == '"':
+			// E'...' strings allow backslash escapes
+			escapes := c == '\'' && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e')
+			for i++; i < len(query); i++ {
+				if escapes && query[i] == '\\' {
+					i++
+				} else if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+					} else {
+						break
+					}
+				}
+			}
+		case c == '$':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			if j > i+1 {
+				n, _ := strconv.Atoi(query[i+1 : j])
+				params = max(params, n)
+				i = j - 1
+				break
+			}
+			// Dollar quoting: $tag$...$tag$
+			for j < len(query) && (query[j] == '_' || unicode.IsLetter(rune(query[j])) || query[j] >= '0' && query[j] <= '9') {
+				j++
+			}
+			if j < len(query) && query[j] == '$' {
+				tag := query[i : j+1]
+				if end := strings.Index(query[j+1:], tag); end >= 0 {
+					i = j + end + len(tag)
+				} else {
+					i = len(query)
+				}
+			}
+		}
+		empty = false
+	}
+	if !empty {
+		statements++
+	}
+	return statements, params
+}
+
+// postgresPlan is a node of EXPLAIN (FORMAT JSON) output
+type postgresPlan struct {
+	NodeType     string         `json:"Node Type"`
+	RelationName string         `json:"Relation Name"`
+	Alias        string         `json:"Alias"`
+	IndexName    string         `json:"Index Name"`
+	StartupCost  float64        `json:"Startup Cost"`
+	TotalCost    float64        `json:"Total Cost"`
+	PlanRows     float64        `json:"Plan Rows"`
+	PlanWidth    int64          `json:"Plan Width"`
+	Filter       string         `json:"Filter"`
+	IndexCond    string         `json:"Index Cond"`
+	HashCond     string         `json:"Hash Cond"`
+	MergeCond    string         `json:"Merge Cond"`
+	JoinFilter   string         `json:"Join Filter"`
+	SortKey      []string       `json:"Sort Key"`
+	GroupKey     []string       `json:"Group Key"`
+	Plans        []postgresPlan `json:"Plans"`
+}
+
+// node converts the plan into a tree in the style of EXPLAIN's text output
+func (p postgresPlan) node() *stats.PlanNode {
+	label := p.NodeType
+	if p.IndexName != "" {
+		label += " using " + p.IndexName
+	}
+	if p.RelationName != "" {
+		label += " on " + p.RelationName
+		if p.Alias != "" && p.Alias != p.RelationName {
+			label += " " + p.Alias
+		}
+	}
+	label += fmt.Sprintf("  (cost=%.2f..%.2f rows=%.0f width=%d)", p.StartupCost, p.TotalCost, p.PlanRows, p.PlanWidth)
+
+	node := &stats.PlanNode{Label: label}
+	for _, detail := range [][2]string{
+		{"Index Cond", p.IndexCond},
+		{"Hash Cond", p.HashCond},
+		{"Merge Cond", p.MergeCond},
+		{"Join Filter", p.JoinFilter},
+		{"Filter", p.Filter},
+		{"Sort Key", strings.Join(p.SortKey, ", ")},
+		{"Group Key", strings.Join(p.GroupKey, ", ")},
+	} {
+		if detail[1] != "" {
+			node.Children = append(node.Children, &stats.PlanNode{Label: detail[0] + ": " + detail[1]})
+		}
+	}
+	for _, child := range p.Plans {
+		node.Children = append(node.Children, child.node())
+	}
+	return node
+}
+
+// getLockWaits returns the sessions blocked by other sessions according to
+// pg_blocking_pids, with the lock they are waiting for from pg_locks
+func (d *postgresDriver) getLockWaits(ctx context.Context, db *sql.DB, catalog postgresCatalog, database string) ([]stats.LockWait, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			a.pid,
+			b.blocking_pid,
+			COALESCE(EXTRACT(EPOCH FROM now() - %s)::bigint, 0),
+			l.locktype,
+			l.relation::regclass::text
+		FROM pg_stat_activity a
+		CROSS JOIN LATERAL unnest(pg_blocking_pids(a.pid)) AS b(blocking_pid)
+		LEFT JOIN pg_locks l ON l.pid = a.pid AND NOT l.granted
+		WHERE cardinality(pg_blocking_pids(a.pid)) > 0
+	`, catalog.lockWaitStart)
+	var rows *sql.Rows
+	var err error
+	if database != "" {
+		rows, err = db.QueryContext(ctx, query+" AND a.datname = $1", database)
+	} else {
+		rows, err = db.QueryContext(ctx, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scanLockWaits(rows)
+}
+
+// getReplication returns the WAL receiver of a standby, the replicas
+// streaming from this server, and its replication slots
+func (d *postgresDriver) getReplication(ctx context.Context, db *sql.DB, catalog postgresCatalog) (*stats.Replication, error) {
+	var inRecovery bool
+	if err := db.QueryRowContext(ctx, "SELECT pg_is_in_recovery()").Scan(&inRecovery); err != nil {
+		return nil, err
+	}
+
+	replication := &stats.Replication{Role: "primary"}
+	if inRecovery {
+		replication.Role = "replica"
+
+		// The replay timestamp only advances with new transactions, so on
+		// an idle primary the lag grows although the standby is current
+		query := fmt.Sprintf(`
+			SELECT
+				r.status,
+				%s,
+				%s,
+				EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())::float8,
+				%s()
+			FROM (SELECT 1) AS x
+			LEFT JOIN pg_stat_wal_receiver r ON true
+		`, catalog.senderHost, catalog.senderPort, catalog.replayPaused)
+		var status, host sql.NullString
+		var port sql.NullInt64
+		var lag sql.NullFloat64
+		var paused bool
+		if err := db.QueryRowContext(ctx, query).Scan(&status, &host, &port, &lag, &paused); err != nil {
+			return nil, err
+		}
+
+		channel := stats.ReplicationChannel{
+			Name:     "wal receiver",
+			IOState:  status.String,
+			SQLState: "replaying",
+			Lag:      lag.Float64,
+			LagKnown: lag.Valid,
+		}
+		if !status.Valid {
+			channel.IOState = "stopped"
+		}
+		if paused {
+			channel.SQLState = "paused"
+		}
+		if host.Valid {
+			channel.Source = fmt.Sprintf("%s:%d", host.String, port.Int64)
+		}
+		replication.Channels = append(replication.Channels, channel)
+	}
+
+	replicaQuery := fmt.Sprintf(`
+		SELECT
+			application_name,
+			client_addr,
+			state,
+			sync_state,
+			EXTRACT(EPOCH FROM %s)::float8,
+			EXTRACT(EPOCH FROM %s)::float8,
+			EXTRACT(EPOCH FROM %s)::float8,
+			%s(%s, %s)::bigint
+		FROM pg_stat_replication
+	`, catalog.writeLag, catalog.flushLag, catalog.replayLag, catalog.lsnDiff, catalog.sentLSN, catalog.replayLSN)
+	rows, err := db.QueryContext(ctx, replicaQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var replica stats.ReplicaInfo
+		var name, client, state, syncState sql.NullString
+		var writeLag, flushLag, replayLag sql.NullFloat64
+		var lagBytes sql.NullInt64
+
+		if err := rows.Scan(&name, &client, &state, &syncState, &writeLag, &flushLag, &replayLag, &lagBytes); err != nil {
+			return nil, err
+		}
+		replica.Name = name.String
+		replica.Client = client.String
+		replica.State = state.String
+		replica.SyncState = syncState.String
+		replica.WriteLag, replica.WriteLagKnown = writeLag.Float64, writeLag.Valid
+		replica.FlushLag, replica.FlushLagKnown = flushLag.Float64, flushLag.Valid
+		replica.ReplayLag, replica.ReplayLagKnown = replayLag.Float64, replayLag.Valid
+		replica.LagBytes = lagBytes.Int64
+
+		replication.Replicas = append(replication.Replicas, replica)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	slotQuery := fmt.Sprintf(`
+		SELECT
+			slot_name,
+			slot_type,
+			active,
+			%s(
+				CASE WHEN pg_is_in_recovery() THEN %s() ELSE %s() END,
+				restart_lsn
+			)::bigint
+		FROM pg_replication_slots
+	`, catalog.lsnDiff, catalog.receiveLSN, catalog.currentLSN)
+	slotRows, err := db.QueryContext(ctx, slotQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer slotRows.Close()
+
+	for slotRows.Next() {
+		var slot stats.ReplicationSlot
+		var retained sql.NullInt64
+
+		if err := slotRows.Scan(&slot.Name, &slot.Type, &slot.Active, &retained); err != nil {
+			return nil, err
+		}
+		slot.RetainedWAL = retained.Int64
+
+		replication.Slots = append(replication.Slots, slot)
+	}
+	if err := slotRows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !inRecovery && len(replication.Replicas) == 0 && len(replication.Slots) == 0 {
+		return nil, nil
+	}
+
+	summarizeLag(replication)
+	return replication, nil
+}
+
+// getStatements returns the statements with the most execution time from
+// pg_stat_statements. When the extension is missing or unreadable, it
+// returns a message explaining why instead.
+func (d *postgresDriver) getStatements(ctx context.Context, db *sql.DB, database string) ([]stats.Statement, string) {
+	var version string
+	err := db.QueryRowContext(ctx, "SELECT extversion FROM pg_extension WHERE extname = 'pg_stat_statements'").Scan(&version)
+	if err == sql.ErrNoRows {
+		return nil, "pg_stat_statements is not installed; add it to shared_preload_libraries and run CREATE EXTENSION pg_stat_statements"
+	}
+	if err != nil {
+		return nil, fmt.Sprintf("failed to check for pg_stat_statements: %v", err)
+	}
+
+	// Statements are aggregated over users so that each query appears once
+	// per database. All of them are read, as the ones to show are ranked by
+	// their time since the previous refresh.
+	query := fmt.Sprintf(`
+		SELECT
+			concat_ws('/', s.dbid, s.queryid),
+			d.datname,
+			min(s.query),
+			sum(s.calls)::bigint,
+			sum(s.%s)::float8,
+			sum(s.rows)::bigint,
+			sum(s.shared_blks_hit)::bigint,
+			sum(s.shared_blks_read)::bigint
+		FROM pg_stat_statements s
+		JOIN pg_database d ON d.oid = s.dbid
+	`, statementsTimeColumn(version))
+	groupBy := `
+		GROUP BY s.dbid, s.queryid, d.datname
+	`
+
+	var rows *sql.Rows
+	if database != "" {
+		rows, err = db.QueryContext(ctx, query+" WHERE d.datname = $1"+groupBy, database)
+	} else {
+		rows, err = db.QueryContext(ctx, query+groupBy)
+	}
+	if err != nil {
+		return nil, fmt.Sprintf("failed to read pg_stat_statements: %v", err)
+	}
+	defer rows.Close()
+
+	var statements []stats.Statement
+	for rows.Next() {
+		var statement stats.Statement
+		var queryText sql.NullString
+
+		if err := rows.Scan(&statement.ID, &statement.Database, &queryText,
+			&statement.Total.Calls, &statement.Total.Time, &statement.Total.Rows,
+			&statement.Total.BlocksHit, &statement.Total.BlocksRead); err != nil {
+			return nil, fmt.Sprintf("failed to read pg_stat_statements: %v", err)
+		}
+		statement.Query = queryText.String
+
+		statements = append(statements, statement)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Sprintf("failed to read pg_stat_statements: %v", err)
+	}
+	return statements, ""
+}
+
+// statementsTimeColumn returns the total execution time column of
+// pg_stat_statements, which was renamed from total_time in version 1.8
+func statementsTimeColumn(version string) string {
+	major, minor, _ := strings.Cut(version, ".")
+	majorVersion, _ := strconv.Atoi(major)
+	minorVersion, _ := strconv.Atoi(minor)
+	if majorVersion > 1 || majorVersion == 1 && minorVersion >= 8 {
+		return "total_exec_time"
+	}
+	return "total_time"
+}
+
+// getSessionGroups counts the sessions of pg_stat_activity, including
+// background processes, by backend type, state, and wait event
+func (d *postgresDriver) getSessionGroups(ctx context.Context, db *sql.DB, catalog postgresCatalog, database string) ([]stats.SessionGroup, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			COALESCE(%s, ''),
+			COALESCE(state, ''),
+			COALESCE(%s, ''),
+			COALESCE(%s, ''),
+			count(*)
+		FROM pg_stat_activity
+		WHERE pid <> pg_backend_pid()
+	`, catalog.backendType, catalog.waitEventType, catalog.waitEvent)
+	groupBy := " GROUP BY 1, 2, 3, 4 ORDER BY 5 DESC"
+
+	var rows *sql.Rows
+	var err error
+	if database != "" {
+		rows, err = db.QueryContext(ctx, query+" AND datname = $1"+groupBy, database)
+	} else {
+		rows, err = db.QueryContext(ctx, query+groupBy)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []stats.SessionGroup
+	for rows.Next() {
+		var group stats.SessionGroup
+		if err := rows.Scan(&group.BackendType, &group.State, &group.WaitEventType, &group.WaitEvent, &group.Count); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// activeSessions returns one sample per active session in groups, on CPU
+// unless it is waiting on an event
+func activeSessions(groups []stats.SessionGroup) []stats.ActiveSession {
+	var sessions []stats.ActiveSession
+	for _, group := range groups {
+		if group.State != "active" {
+			continue
+		}
+		session := stats.ActiveSession{Event: group.WaitEvent, WaitClass: group.WaitEventType}
+		if session.WaitClass == "" {
+			session.Event = "ON CPU"
+			session.WaitClass = "CPU"
+		}
+		for i := int64(0); i < group.Count; i++ {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
@@ -0,0 +1,644 @@
+package drivers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"dbtop/config"
+	"dbtop/monitor/stats"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPostgresCollect(t *testing.T) {
+	processColumns := []string{
+		"pid", "usename", "client_addr", "datname", "state", "query_start", "query",
+		"wait_event_type", "wait_event", "backend_type", "xact_start", "backend_xid", "backend_xmin",
+	}
+	groupColumns := []string{"backend_type", "state", "wait_event_type", "wait_event", "count"}
+	counterColumns := []string{"xact_commit", "xact_rollback", "tup_returned", "tup_inserted", "tup_updated", "tup_deleted"}
+	replicaColumns := []string{"application_name", "client_addr", "state", "sync_state", "write_lag", "flush_lag", "replay_lag", "lag_bytes"}
+	slotColumns := []string{"slot_name", "slot_type", "active", "retained"}
+	statementColumns := []string{"id", "datname", "query", "calls", "total_time", "rows", "shared_blks_hit", "shared_blks_read"}
+	lockColumns := []string{"pid", "blocking_pid", "wait_time", "locktype", "relation"}
+	queryStart := time.Now().Add(-30 * time.Second)
+	xactStart := time.Now().Add(-90 * time.Second)
+
+	tests := []struct {
+		name     string
+		database string
+		expect   func(mock sqlmock.Sqlmock)
+		want     *stats.DatabaseStats
+	}{
+		{
+			name: "all databases",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM pg_stat_activity WHERE state = 'active'")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM pg_stat_activity")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+				mock.ExpectQuery(regexp.QuoteMeta("pg_postmaster_start_time()))::bigint")).
+					WillReturnRows(sqlmock.NewRows([]string{"uptime"}).AddRow(86400))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM pg_stat_database")).
+					WillReturnRows(sqlmock.NewRows(counterColumns).AddRow(90, 10, 5000, 20, 30, 40))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM pg_stat_activity")).
+					WillReturnRows(sqlmock.NewRows(processColumns).
+						AddRow(100, "app", "10.0.0.1", "shop", "active", queryStart, "SELECT 1",
+							"Lock", "transactionid", "client backend", xactStart, "731", "730").
+						AddRow(101, nil, nil, nil, "idle", nil, nil, nil, nil, nil, nil, nil, nil))
+				mock.ExpectQuery(regexp.QuoteMeta("GROUP BY 1, 2, 3, 4")).
+					WillReturnRows(sqlmock.NewRows(groupColumns).
+						AddRow("client backend", "idle", "Client", "ClientRead", 3).
+						AddRow("client backend", "active", "Lock", "transactionid", 1).
+						AddRow("client backend", "active", "", "", 2).
+						AddRow("walwriter", "", "Activity", "WalWriterMain", 1))
+				mock.ExpectQuery(`(?s)now\(\) - l\.waitstart.*pg_blocking_pids\(a\.pid\)`).
+					WillReturnRows(sqlmock.NewRows(lockColumns).
+						AddRow(100, 102, 30, "transactionid", nil))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_is_in_recovery()")).
+					WillReturnRows(sqlmock.NewRows([]string{"pg_is_in_recovery"}).AddRow(false))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM pg_stat_replication")).
+					WillReturnRows(sqlmock.NewRows(replicaColumns).
+						AddRow("standby1", "10.0.0.2", "streaming", "async", 0.1, 0.2, 1.5, 4096).
+						AddRow("standby2", nil, "startup", nil, nil, nil, nil, nil))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM pg_replication_slots")).
+					WillReturnRows(sqlmock.NewRows(slotColumns).
+						AddRow("standby1", "physical", true, 16777216))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM pg_extension WHERE extname = 'pg_stat_statements'")).
+					WillReturnRows(sqlmock.NewRows([]string{"extversion"}).AddRow("1.10"))
+				mock.ExpectQuery(regexp.QuoteMeta("sum(s.total_exec_time)")).
+					WillReturnRows(sqlmock.NewRows(statementColumns).
+						AddRow("16384/-42", "shop", "SELECT * FROM orders WHERE id = $1", 1000, 250.5, 1000, 3000, 20))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM pg_stat_user_tables")).
+					WillReturnRows(sqlmock.NewRows([]string{"table_name", "total_rows", "total_size"}).
+						AddRow("public.orders", 70, 32768))
+			},
+			want: &stats.DatabaseStats{
+				ActiveConnections: 2,
+				TotalConnections:  5,
+				Uptime:            24 * time.Hour,
+				Counters: stats.Counters{
+					Queries: 100, Commits: 90, Rollbacks: 10,
+					RowsRead: 5000, RowsInserted: 20, RowsUpdated: 30, RowsDeleted: 40,
+				},
+				Processes: []stats.ProcessInfo{
+					{
+						ID: 100, User: "app", Host: "10.0.0.1", Database: "shop", State: "active", Time: 30, Info: "SELECT 1",
+						WaitEventType: "Lock", WaitEvent: "transactionid", BackendType: "client backend",
+						TransactionTime: 90, BackendXID: "731", BackendXmin: "730",
+					},
+					{ID: 101, Host: "localhost", State: "idle"},
+				},
+				SessionGroups: []stats.SessionGroup{
+					{BackendType: "client backend", State: "idle", WaitEventType: "Client", WaitEvent: "ClientRead", Count: 3},
+					{BackendType: "client backend", State: "active", WaitEventType: "Lock", WaitEvent: "transactionid", Count: 1},
+					{BackendType: "client backend", State: "active", Count: 2},
+					{BackendType: "walwriter", WaitEventType: "Activity", WaitEvent: "WalWriterMain", Count: 1},
+				},
+				ActiveSessions: []stats.ActiveSession{
+					{Event: "transactionid", WaitClass: "Lock"},
+					{Event: "ON CPU", WaitClass: "CPU"},
+					{Event: "ON CPU", WaitClass: "CPU"},
+				},
+				Threads: stats.ThreadStats{Locked: 1},
+				Locks: []stats.LockWait{
+					{WaitingID: 100, BlockingID: 102, WaitTime: 30, LockType: "transactionid"},
+				},
+				Replication: &stats.Replication{
+					Role:     "primary",
+					Lag:      1.5,
+					LagKnown: true,
+					Replicas: []stats.ReplicaInfo{
+						{Name: "standby1", Client: "10.0.0.2", State: "streaming", SyncState: "async", WriteLag: 0.1, WriteLagKnown: true, FlushLag: 0.2, FlushLagKnown: true, ReplayLag: 1.5, ReplayLagKnown: true, LagBytes: 4096},
+						{Name: "standby2", State: "startup"},
+					},
+					Slots: []stats.ReplicationSlot{
+						{Name: "standby1", Type: "physical", Active: true, RetainedWAL: 16777216},
+					},
+				},
+				StatementsSource: "pg_stat_statements",
+				Statements: []stats.Statement{
+					{
+						ID: "16384/-42", Database: "shop", Query: "SELECT * FROM orders WHERE id = $1",
+						Total: stats.StatementCounters{Calls: 1000, Time: 250.5, Rows: 1000, BlocksHit: 3000, BlocksRead: 20},
+					},
+				},
+				Tables: []stats.TableInfo{
+					{Name: "public.orders", Rows: 70, DataSize: 32768},
+				},
+			},
+		},
+		{
+			name:     "single database",
+			database: "shop",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("WHERE state = 'active' AND datname = $1")).
+					WithArgs("shop").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM pg_stat_activity WHERE datname = $1")).
+					WithArgs("shop").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+				mock.ExpectQuery(regexp.QuoteMeta("pg_postmaster_start_time")).
+					WillReturnRows(sqlmock.NewRows([]string{"uptime"}).AddRow(60))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM pg_stat_database WHERE datname = $1")).
+					WithArgs("shop").
+					WillReturnRows(sqlmock.NewRows(counterColumns).AddRow(0, 0, 0, 0, 0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta("AND datname = $1 ORDER BY query_start DESC")).
+					WithArgs("shop").
+					WillReturnRows(sqlmock.NewRows(processColumns))
+				mock.ExpectQuery(regexp.QuoteMeta("WHERE pid <> pg_backend_pid() AND datname = $1")).
+					WithArgs("shop").
+					WillReturnRows(sqlmock.NewRows(groupColumns))
+				mock.ExpectQuery(regexp.QuoteMeta("AND a.datname = $1")).
+					WithArgs("shop").
+					WillReturnRows(sqlmock.NewRows(lockColumns))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_is_in_recovery()")).
+					WillReturnRows(sqlmock.NewRows([]string{"pg_is_in_recovery"}).AddRow(true))
+				mock.ExpectQuery(regexp.QuoteMeta("pg_stat_wal_receiver")).
+					WillReturnRows(sqlmock.NewRows([]string{"status", "sender_host", "sender_port", "lag", "paused"}).
+						AddRow("streaming", "db1", 5432, 2.5, false))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM pg_stat_replication")).
+					WillReturnRows(sqlmock.NewRows(replicaColumns))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM pg_replication_slots")).
+					WillReturnRows(sqlmock.NewRows(slotColumns))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM pg_extension WHERE extname = 'pg_stat_statements'")).
+					WillReturnRows(sqlmock.NewRows([]string{"extversion"}))
+				mock.ExpectQuery(regexp.QuoteMeta("WHERE schemaname = 'public'")).
+					WillReturnRows(sqlmock.NewRows([]string{"table_name", "total_rows", "total_size"}))
+			},
+			want: &stats.DatabaseStats{
+				ActiveConnections: 1,
+				TotalConnections:  3,
+				Uptime:            time.Minute,
+				Replication: &stats.Replication{
+					Role:     "replica",
+					Lag:      2.5,
+					LagKnown: true,
+					Channels: []stats.ReplicationChannel{
+						{Name: "wal receiver", Source: "db1:5432", IOState: "streaming", SQLState: "replaying", Lag: 2.5, LagKnown: true},
+					},
+				},
+				StatementsSource:  "pg_stat_statements",
+				StatementsMessage: "pg_stat_statements is not installed; add it to shared_preload_libraries and run CREATE EXTENSION pg_stat_statements",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMock(t)
+			tt.expect(mock)
+
+			got, err := (&postgresDriver{}).Collect(context.Background(), recentConn(db), tt.database)
+			if err != nil {
+				t.Fatalf("Collect failed: %v", err)
+			}
+			checkStats(t, got, tt.want)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPostgresKillProcessNotFound(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_terminate_backend($1)")).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_terminate_backend"}).AddRow(false))
+
+	if err := (&postgresDriver{}).KillProcess(context.Background(), recentConn(db), stats.ProcessInfo{ID: 7}); err == nil {
+		t.Error("KillProcess succeeded for a missing backend, want error")
+	}
+}
+
+func TestStatementsTimeColumn(t *testing.T) {
+	tests := map[string]string{
+		"1.4":  "total_time",
+		"1.7":  "total_time",
+		"1.8":  "total_exec_time",
+		"1.10": "total_exec_time",
+		"2.0":  "total_exec_time",
+	}
+	for version, want := range tests {
+		if got := statementsTimeColumn(version); got != want {
+			t.Errorf("statementsTimeColumn(%q) = %q, want %q", version, got, want)
+		}
+	}
+}
+
+func TestPostgresServerInfo(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(regexp.QuoteMeta("SHOW server_version")).
+		WillReturnRows(sqlmock.NewRows([]string{"server_version"}).AddRow("9.5.25 (Debian 9.5.25-1)"))
+
+	driver := &postgresDriver{}
+	server, err := driver.ServerInfo(context.Background(), db)
+	if err != nil {
+		t.Fatalf("ServerInfo failed: %v", err)
+	}
+	if want := (stats.ServerInfo{Flavor: "postgres", Version: "9.5.25"}); server != want {
+		t.Errorf("ServerInfo = %+v, want %+v", server, want)
+	}
+
+	want := stats.CapKill | stats.CapCancel | stats.CapTables | stats.CapExplain | stats.CapDigests
+	if got := driver.Capabilities(server); got != want {
+		t.Errorf("Capabilities = %s, want %s", got, want)
+	}
+}
+
+func TestPostgresCatalogVariants(t *testing.T) {
+	tests := []struct {
+		version      string
+		processQuery string
+		groupQuery   string
+		want         *stats.DatabaseStats
+	}{
+		{
+			version:      "9.5.25",
+			processQuery: `CASE WHEN waiting THEN 'Lock' END,\s+NULL::text,\s+'client backend',\s+xact_start,\s+backend_xid::text`,
+			groupQuery:   `COALESCE\('client backend', ''\),\s+COALESCE\(state, ''\),\s+COALESCE\(CASE WHEN waiting`,
+			want: &stats.DatabaseStats{
+				Processes: []stats.ProcessInfo{
+					{
+						ID: 2841, User: "app", Host: "10.0.0.21", Database: "shop", State: "active",
+						Info: "UPDATE orders SET status = 'shipped' WHERE id = $1", WaitEventType: "Lock",
+						BackendType: "client backend", BackendXID: "1077", BackendXmin: "1070",
+					},
+					{ID: 2903, User: "app", Host: "10.0.0.22", Database: "shop", State: "idle", Info: "COMMIT", BackendType: "client backend"},
+				},
+				SessionGroups: []stats.SessionGroup{
+					{BackendType: "client backend", State: "idle", Count: 6},
+					{BackendType: "client backend", State: "active", WaitEventType: "Lock", Count: 1},
+					{BackendType: "client backend", State: "active", Count: 2},
+				},
+				ActiveSessions: []stats.ActiveSession{
+					{WaitClass: "Lock"},
+					{Event: "ON CPU", WaitClass: "CPU"},
+					{Event: "ON CPU", WaitClass: "CPU"},
+				},
+			},
+		},
+		{
+			version:      "16.2",
+			processQuery: `wait_event_type,\s+wait_event,\s+backend_type,\s+xact_start,\s+backend_xid::text`,
+			groupQuery:   `COALESCE\(backend_type, ''\),\s+COALESCE\(state, ''\),\s+COALESCE\(wait_event_type`,
+			want: &stats.DatabaseStats{
+				Processes: []stats.ProcessInfo{
+					{
+						ID: 51022, User: "app", Host: "10.0.0.21", Database: "shop", State: "active",
+						Info: "SELECT sum(total) FROM orders", WaitEventType: "IO", WaitEvent: "DataFileRead",
+						BackendType: "client backend", BackendXmin: "88120",
+					},
+					{
+						ID: 51040, User: "app", Host: "10.0.0.22", Database: "shop", State: "idle", Info: "COMMIT",
+						WaitEventType: "Client", WaitEvent: "ClientRead", BackendType: "client backend",
+					},
+				},
+				SessionGroups: []stats.SessionGroup{
+					{BackendType: "client backend", State: "idle", WaitEventType: "Client", WaitEvent: "ClientRead", Count: 6},
+					{BackendType: "client backend", State: "active", WaitEventType: "IO", WaitEvent: "DataFileRead", Count: 1},
+					{BackendType: "checkpointer", WaitEventType: "Activity", WaitEvent: "CheckpointerMain", Count: 1},
+				},
+				ActiveSessions: []stats.ActiveSession{
+					{Event: "DataFileRead", WaitClass: "IO"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			db, mock := newMock(t)
+			mock.ExpectQuery(regexp.QuoteMeta("WHERE state = 'active'")).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM pg_stat_activity")).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery(regexp.QuoteMeta("pg_postmaster_start_time()")).
+				WillReturnRows(sqlmock.NewRows([]string{"uptime"}).AddRow(0))
+			mock.ExpectQuery(regexp.QuoteMeta("FROM pg_stat_database")).
+				WillReturnRows(sqlmock.NewRows([]string{"xact_commit", "xact_rollback", "tup_returned", "tup_inserted", "tup_updated", "tup_deleted"}).
+					AddRow(0, 0, 0, 0, 0, 0))
+			mock.ExpectQuery(tt.processQuery).
+				WillReturnRows(fixture(t, "postgres/"+majorVersion(tt.version)+"/activity.csv"))
+			mock.ExpectQuery(tt.groupQuery).
+				WillReturnRows(fixture(t, "postgres/"+majorVersion(tt.version)+"/session_groups.csv"))
+			mock.ExpectQuery(regexp.QuoteMeta("FROM pg_stat_user_tables")).
+				WillReturnRows(sqlmock.NewRows([]string{"table_name", "total_rows", "total_size"}))
+
+			// Leave out the optional features to check the catalog queries only
+			conn := &Conn{DB: db, Server: stats.ServerInfo{Flavor: "postgres", Version: tt.version}, Capabilities: stats.CapTables}
+			got, err := (&postgresDriver{}).Collect(context.Background(), conn, "")
+			if err != nil {
+				t.Fatalf("Collect failed: %v", err)
+			}
+			checkStats(t, got, tt.want)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPostgresReplicationVariants(t *testing.T) {
+	tests := []struct {
+		version       string
+		receiverQuery string
+		replicaQuery  string
+		slotQuery     string
+		want          *stats.Replication
+	}{
+		{
+			version:       "9.6.24",
+			receiverQuery: `NULL::text,\s+NULL::integer,.*pg_is_xlog_replay_paused\(\)`,
+			replicaQuery:  `NULL::interval.*pg_xlog_location_diff\(sent_location, replay_location\)`,
+			slotQuery:     `pg_xlog_location_diff\(\s+CASE WHEN pg_is_in_recovery\(\) THEN pg_last_xlog_receive_location\(\) ELSE pg_current_xlog_location\(\) END`,
+			want: &stats.Replication{
+				Role: "replica", Lag: 1.5, LagKnown: true,
+				Channels: []stats.ReplicationChannel{
+					{Name: "wal receiver", IOState: "streaming", SQLState: "replaying", Lag: 1.5, LagKnown: true},
+				},
+				// 9.6 does not report the lags of its replicas
+				Replicas: []stats.ReplicaInfo{
+					{Name: "cascade", Client: "10.0.0.7", State: "streaming", SyncState: "async", LagBytes: 8192},
+				},
+				Slots: []stats.ReplicationSlot{{Name: "cascade_1", Type: "physical", RetainedWAL: 16777216}},
+			},
+		},
+		{
+			version:       "16.2",
+			receiverQuery: `r.sender_host,\s+r.sender_port,.*pg_is_wal_replay_paused\(\)`,
+			replicaQuery:  `write_lag.*pg_wal_lsn_diff\(sent_lsn, replay_lsn\)`,
+			slotQuery:     `pg_wal_lsn_diff\(\s+CASE WHEN pg_is_in_recovery\(\) THEN pg_last_wal_receive_lsn\(\) ELSE pg_current_wal_lsn\(\) END`,
+			want: &stats.Replication{
+				Role: "replica", Lag: 0.25, LagKnown: true,
+				Channels: []stats.ReplicationChannel{
+					{Name: "wal receiver", Source: "10.0.0.5:5432", IOState: "streaming", SQLState: "replaying", Lag: 0.25, LagKnown: true},
+				},
+				Replicas: []stats.ReplicaInfo{
+					{Name: "cascade", Client: "10.0.0.7", State: "streaming", SyncState: "async", WriteLag: 0.001, WriteLagKnown: true, FlushLag: 0.002, FlushLagKnown: true, ReplayLag: 0.004, ReplayLagKnown: true, LagBytes: 8192},
+				},
+				Slots: []stats.ReplicationSlot{{Name: "cascade", Type: "physical", Active: true, RetainedWAL: 8192}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			db, mock := newMock(t)
+			dir := "postgres/" + majorVersion(tt.version) + "/"
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_is_in_recovery()")).
+				WillReturnRows(sqlmock.NewRows([]string{"pg_is_in_recovery"}).AddRow(true))
+			mock.ExpectQuery(`(?s)` + tt.receiverQuery).WillReturnRows(fixture(t, dir+"wal_receiver.csv"))
+			mock.ExpectQuery(`(?s)` + tt.replicaQuery).WillReturnRows(fixture(t, dir+"replicas.csv"))
+			mock.ExpectQuery(tt.slotQuery).WillReturnRows(fixture(t, dir+"slots.csv"))
+
+			catalog := newPostgresCatalog(stats.ServerInfo{Flavor: "postgres", Version: tt.version})
+			got, err := (&postgresDriver{}).getReplication(context.Background(), db, catalog)
+			if err != nil {
+				t.Fatalf("getReplication failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected replication\n got: %+v\nwant: %+v", got, tt.want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSummarizeLag(t *testing.T) {
+	// A primary whose replicas do not report their replay lag, e.g. 9.6
+	// or idle replicas, has no known lag rather than a lag of 0s
+	replication := &stats.Replication{
+		Role:     "primary",
+		Replicas: []stats.ReplicaInfo{{Name: "standby1"}, {Name: "standby2"}},
+	}
+	summarizeLag(replication)
+	if replication.LagKnown {
+		t.Errorf("lag = %v, want unknown", replication.Lag)
+	}
+
+	replication.Replicas = append(replication.Replicas, stats.ReplicaInfo{Name: "standby3", ReplayLag: 2.5, ReplayLagKnown: true})
+	summarizeLag(replication)
+	if !replication.LagKnown || replication.Lag != 2.5 {
+		t.Errorf("lag = %v (known %v), want 2.5", replication.Lag, replication.LagKnown)
+	}
+}
+
+// majorVersion returns the fixture directory of a PostgreSQL version: the
+// major version from 10 on, major and minor before
+func majorVersion(version string) string {
+	parts := strings.Split(version, ".")
+	if parts[0] == "9" {
+		return parts[0] + "." + parts[1]
+	}
+	return parts[0]
+}
+
+func TestPostgresDatabaseTables(t *testing.T) {
+	tableColumns := []string{"table_name", "total_rows", "total_size"}
+	db, mock := newMock(t)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM pg_database")).
+		WillReturnRows(sqlmock.NewRows([]string{"datname"}).
+			AddRow("analytics").
+			AddRow("postgres").
+			AddRow("shop").
+			AddRow("shop_archive"))
+
+	// Each selected database is read over a handle of its own; analytics
+	// refuses the connection and is reported
+	databases := map[string]sqlmock.Sqlmock{}
+	handles := map[string]*sql.DB{}
+	for _, name := range []string{"analytics", "shop"} {
+		handles[name], databases[name] = newMock(t)
+	}
+	databases["analytics"].ExpectQuery(regexp.QuoteMeta("FROM pg_stat_user_tables")).
+		WillReturnError(errors.New(`pq: permission denied for database "analytics"`))
+	databases["shop"].ExpectQuery(regexp.QuoteMeta("FROM pg_stat_user_tables")).
+		WillReturnRows(sqlmock.NewRows(tableColumns).
+			AddRow("public.orders", 900, 8192000).
+			AddRow("public.customers", 40, 16384))
+
+	var opened []string
+	conn := recentConn(db)
+	conn.databases = &config.DatabaseFilter{Exclude: []string{"postgres", "*_archive"}}
+	conn.openDatabase = func(name string) (*sql.DB, error) {
+		opened = append(opened, name)
+		return handles[name], nil
+	}
+
+	result := &stats.DatabaseStats{}
+	got, err := (&postgresDriver{}).getDatabaseTables(context.Background(), conn, result)
+	if err != nil {
+		t.Fatalf("getDatabaseTables failed: %v", err)
+	}
+	want := []stats.TableInfo{
+		{Name: "shop.public.orders", Rows: 900, DataSize: 8192000},
+		{Name: "shop.public.customers", Rows: 40, DataSize: 16384},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected tables\n got: %+v\nwant: %+v", got, want)
+	}
+	wantWarnings := []string{`failed to get tables of database analytics: pq: permission denied for database "analytics"`}
+	if !reflect.DeepEqual(result.Warnings, wantWarnings) {
+		t.Errorf("warnings = %q, want %q", result.Warnings, wantWarnings)
+	}
+
+	// The next time the handles are reused. shop was dropped, so its
+	// handle is closed, and time runs out before billing is read.
+	mock.ExpectQuery(regexp.QuoteMeta("FROM pg_database")).
+		WillReturnRows(sqlmock.NewRows([]string{"datname"}).
+			AddRow("analytics").
+			AddRow("billing"))
+	databases["shop"].ExpectClose()
+	databases["analytics"].ExpectQuery(regexp.QuoteMeta("FROM pg_stat_user_tables")).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows(tableColumns))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result = &stats.DatabaseStats{}
+	got, err = (&postgresDriver{}).getDatabaseTables(ctx, conn, result)
+	if err != nil {
+		t.Fatalf("getDatabaseTables failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("unexpected tables %+v", got)
+	}
+	if len(result.Warnings) != 2 || !strings.HasPrefix(result.Warnings[0], "failed to get tables of database analytics: ") ||
+		result.Warnings[1] != "failed to get tables of database billing: context deadline exceeded" {
+		t.Errorf("warnings = %q, want analytics and billing reported", result.Warnings)
+	}
+	if !reflect.DeepEqual(opened, []string{"analytics", "shop"}) {
+		t.Errorf("opened databases %v, want analytics and shop once", opened)
+	}
+
+	// Closing the connection closes the remaining handles
+	databases["analytics"].ExpectClose()
+	mock.ExpectClose()
+	conn.Close()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	for name, mock := range databases {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestScanPostgresQuery(t *testing.T) {
+	tests := []struct {
+		query      string
+		statements int
+		params     int
+	}{
+		{"SELECT 1", 1, 0},
+		{"SELECT 1;", 1, 0},
+		{"SELECT 1; COMMIT; DROP TABLE t", 3, 0},
+		{"UPDATE orders SET status = 'shipped' WHERE id = $1", 1, 1},
+		{"SELECT * FROM t WHERE a = $2 AND b = $10", 1, 10},
+		{"SELECT 'a;b', \"c;d\" FROM t -- ; DROP TABLE t\n", 1, 0},
+		{"SELECT 1 /* ; /* nested ; */ $1 */", 1, 0},
+		{"SELECT 'it''s $1;'", 1, 0},
+		{`SELECT E'\'; DROP TABLE t; --'`, 1, 0},
+		{"SELECT $fn$ ; $1 $fn$, $$;$$", 1, 0},
+		{"  ;  ", 0, 0},
+	}
+	for _, tt := range tests {
+		statements, params := scanPostgresQuery(tt.query)
+		if statements != tt.statements || params != tt.params {
+			t.Errorf("scanPostgresQuery(%q) = %d, %d, want %d, %d", tt.query, statements, params, tt.statements, tt.params)
+		}
+	}
+}
+
+func TestPostgresExplain(t *testing.T) {
+	planColumns := []string{"QUERY PLAN"}
+	plan := `[{"Plan": {"Node Type": "Index Scan", "Relation Name": "orders", "Index Name": "orders_pkey", "Total Cost": 8.29, "Plan Rows": 1}}]`
+
+	tests := []struct {
+		name    string
+		version string
+		query   string
+		expect  func(mock sqlmock.Sqlmock)
+		wantErr string
+	}{
+		{
+			name:  "single statement",
+			query: "SELECT * FROM orders WHERE id = 42",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectPrepare(regexp.QuoteMeta("EXPLAIN (FORMAT JSON) SELECT * FROM orders WHERE id = 42")).
+					ExpectQuery().
+					WillReturnRows(sqlmock.NewRows(planColumns).AddRow(plan))
+			},
+		},
+		{
+			// Another session's query text must not end the read-only
+			// transaction and run statements with dbtop's privileges
+			name:    "several statements",
+			query:   "SELECT 1; COMMIT; DROP TABLE orders",
+			wantErr: "contains several statements",
+		},
+		{
+			name:    "bind parameters before 16",
+			version: "15.6",
+			query:   "SELECT * FROM orders WHERE id = $1",
+			wantErr: "need PostgreSQL 16",
+		},
+		{
+			name:    "bind parameters from 16",
+			version: "16.2",
+			query:   "SELECT * FROM orders WHERE id = $1",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectPrepare(regexp.QuoteMeta("EXPLAIN (GENERIC_PLAN, FORMAT JSON) SELECT * FROM orders WHERE id = $1")).
+					ExpectQuery().
+					WithArgs(nil).
+					WillReturnRows(sqlmock.NewRows(planColumns).AddRow(plan))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMock(t)
+			if tt.expect != nil {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("SET TRANSACTION READ ONLY")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT current_database()")).
+					WillReturnRows(sqlmock.NewRows([]string{"current_database"}).AddRow("shop"))
+				tt.expect(mock)
+				mock.ExpectRollback()
+			}
+
+			conn := recentConn(db)
+			conn.Server.Version = tt.version
+			process := stats.ProcessInfo{ID: 2841, Database: "shop", Info: tt.query}
+			got, err := (&postgresDriver{}).Explain(context.Background(), conn, process)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Explain error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("Explain failed: %v", err)
+			} else if len(got.Nodes) != 1 || !strings.HasPrefix(got.Nodes[0].Label, "Index Scan using orders_pkey on orders") {
+				t.Errorf("unexpected plan %+v", got.Nodes)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
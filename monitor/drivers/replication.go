@@ -0,0 +1,144 @@
+package drivers
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"dbtop/monitor/stats"
+)
+
+// scanRowMaps reads every row into a map from column name to value, for
+// statements such as SHOW REPLICA STATUS whose columns vary by version
+func scanRowMaps(rows *sql.Rows) ([]map[string]sql.NullString, error) {
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []map[string]sql.NullString
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]sql.NullString, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// column returns the value of the first of names present in row
+func column(row map[string]sql.NullString, names ...string) sql.NullString {
+	for _, name := range names {
+		if value, ok := row[name]; ok {
+			return value
+		}
+	}
+	return sql.NullString{}
+}
+
+// replicaStatusQueries returns the statements to try for the replica
+// status: the REPLICA spelling on servers at or above version, the SLAVE
+// spelling below, and both when the version is unknown
+func replicaStatusQueries(server stats.ServerInfo, replica, slave string, version ...int) []string {
+	switch {
+	case server.Version == "":
+		return []string{replica, slave}
+	case server.AtLeast(version...):
+		return []string{replica}
+	default:
+		return []string{slave}
+	}
+}
+
+// mysqlReplication returns the replica channels from the first of queries
+// the server accepts. Newer servers use the REPLICA/SOURCE terminology,
+// older ones only understand SLAVE/MASTER; the column names follow suit.
+func mysqlReplication(ctx context.Context, db *sql.DB, queries ...string) (*stats.Replication, error) {
+	var rows *sql.Rows
+	var err error
+	for _, query := range queries {
+		if rows, err = db.QueryContext(ctx, query); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	statusRows, err := scanRowMaps(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(statusRows) == 0 {
+		return nil, nil
+	}
+
+	replication := &stats.Replication{Role: "replica"}
+	for _, row := range statusRows {
+		channel := stats.ReplicationChannel{
+			Name:         column(row, "Channel_Name", "Connection_name").String,
+			IOState:      column(row, "Replica_IO_Running", "Slave_IO_Running").String,
+			SQLState:     column(row, "Replica_SQL_Running", "Slave_SQL_Running").String,
+			ReceivedGTID: column(row, "Retrieved_Gtid_Set", "Gtid_IO_Pos").String,
+			ExecutedGTID: column(row, "Executed_Gtid_Set", "Gtid_Slave_Pos").String,
+		}
+
+		host := column(row, "Source_Host", "Master_Host").String
+		port := column(row, "Source_Port", "Master_Port").String
+		if host != "" {
+			channel.Source = host + ":" + port
+		}
+
+		// Seconds_Behind_Source is NULL while the SQL thread is stopped
+		lag := column(row, "Seconds_Behind_Source", "Seconds_Behind_Master")
+		if lag.Valid {
+			if seconds, err := strconv.ParseFloat(lag.String, 64); err == nil {
+				channel.Lag = seconds
+				channel.LagKnown = true
+			}
+		}
+
+		var errors []string
+		for _, name := range []string{"Last_IO_Error", "Last_SQL_Error"} {
+			if message := row[name].String; message != "" {
+				errors = append(errors, message)
+			}
+		}
+		channel.LastError = strings.Join(errors, "; ")
+
+		replication.Channels = append(replication.Channels, channel)
+	}
+
+	summarizeLag(replication)
+	return replication, nil
+}
+
+// summarizeLag sets the overall lag to the highest known lag of the
+// channels and the replay lag of connected replicas
+func summarizeLag(replication *stats.Replication) {
+	for _, channel := range replication.Channels {
+		if channel.LagKnown && (!replication.LagKnown || channel.Lag > replication.Lag) {
+			replication.Lag = channel.Lag
+			replication.LagKnown = true
+		}
+	}
+	for _, replica := range replication.Replicas {
+		if replica.ReplayLagKnown && (!replication.LagKnown || replica.ReplayLag > replication.Lag) {
+			replication.Lag = replica.ReplayLag
+			replication.LagKnown = true
+		}
+	}
+}
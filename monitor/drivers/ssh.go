@@ -0,0 +1,163 @@
+package drivers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"dbtop/config"
+	"dbtop/tunnel"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// tunnelConnector closes the SSH tunnel along with the database handle
+type tunnelConnector struct {
+	driver.Connector
+	tunnel *tunnel.Tunnel
+}
+
+// Close is called by sql.DB.Close
+func (c tunnelConnector) Close() error {
+	if closer, ok := c.Connector.(io.Closer); ok {
+		closer.Close()
+	}
+	return c.tunnel.Close()
+}
+
+// openTunnel connects to the SSH host of an instance
+func openTunnel(ctx context.Context, instance config.DatabaseInstance) (*tunnel.Tunnel, error) {
+	t, err := tunnel.Open(ctx, *instance.SSH)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSH tunnel: %w", err)
+	}
+	return t, nil
+}
+
+// forwardInstance opens the SSH tunnel of an instance and points its host
+// and port at a local port forwarded to the database. It is for drivers
+// that cannot take a custom dialer.
+func forwardInstance(ctx context.Context, instance *config.DatabaseInstance) (*tunnel.Tunnel, error) {
+	t, err := openTunnel(ctx, *instance)
+	if err != nil {
+		return nil, err
+	}
+	local, err := t.Forward(net.JoinHostPort(instance.Host, strconv.Itoa(instance.Port)))
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	host, port, _ := net.SplitHostPort(local)
+	instance.Host = host
+	instance.Port, _ = strconv.Atoi(port)
+	return t, nil
+}
+
+// mysqlTunnelNet is the network name of the dialer registered with the
+// MySQL driver. The driver keeps registered dialers forever, so a single
+// one serves every tunnel and finds it in the context of the connection.
+const mysqlTunnelNet = "dbtop-ssh"
+
+var registerMySQLDialer sync.Once
+
+// tunnelKey is the context key of the tunnel to dial through
+type tunnelKey struct{}
+
+// mysqlTunnelConnector hands its tunnel to the registered dialer
+type mysqlTunnelConnector struct {
+	tunnelConnector
+}
+
+func (c mysqlTunnelConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.Connector.Connect(context.WithValue(ctx, tunnelKey{}, c.tunnel))
+}
+
+// openMySQL opens a MySQL or MariaDB DSN, dialing through the SSH tunnel of
+// the instance if it has one
+func openMySQL(ctx context.Context, instance config.DatabaseInstance, dsn string) (*sql.DB, error) {
+	if instance.SSH == nil {
+		return sql.Open("mysql", dsn)
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	t, err := openTunnel(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+	registerMySQLDialer.Do(func() {
+		mysql.RegisterDialContext(mysqlTunnelNet, func(ctx context.Context, addr string) (net.Conn, error) {
+			t, ok := ctx.Value(tunnelKey{}).(*tunnel.Tunnel)
+			if !ok {
+				return nil, errors.New("no SSH tunnel to dial through")
+			}
+			return t.DialContext(ctx, "tcp", addr)
+		})
+	})
+	cfg.Net = mysqlTunnelNet
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return sql.OpenDB(mysqlTunnelConnector{tunnelConnector{connector, t}}), nil
+}
+
+// postgresDialer dials PostgreSQL connections through an SSH tunnel. The
+// connection string keeps the real host, so verify-full checks the server
+// certificate against it.
+type postgresDialer struct {
+	tunnel *tunnel.Tunnel
+}
+
+func (d postgresDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d postgresDialer) DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, addr)
+}
+
+func (d postgresDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d.tunnel.DialContext(ctx, network, addr)
+}
+
+// postgresConnector returns a connector for a PostgreSQL connection
+// string, dialing through the SSH tunnel if there is one
+func postgresConnector(t *tunnel.Tunnel, dsn string) (driver.Connector, error) {
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		connector.Dialer(postgresDialer{t})
+	}
+	return connector, nil
+}
+
+// openPostgres opens a PostgreSQL connection string, dialing through the
+// SSH tunnel if there is one. The tunnel is closed along with the handle.
+func openPostgres(t *tunnel.Tunnel, dsn string) (*sql.DB, error) {
+	if t == nil {
+		return sql.Open("postgres", dsn)
+	}
+	connector, err := postgresConnector(t, dsn)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return sql.OpenDB(tunnelConnector{connector, t}), nil
+}
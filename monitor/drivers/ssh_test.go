@@ -0,0 +1,135 @@
+package drivers
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"dbtop/config"
+	"dbtop/tunnel/sshtest"
+)
+
+func TestConnectThroughSSH(t *testing.T) {
+	// The database hangs up right away, so Connect fails after the tunnel
+	// has carried the connection
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	dbHost, dbPort, _ := net.SplitHostPort(listener.Addr().String())
+
+	keyFile, clientKey := sshtest.ClientKey(t)
+	server := sshtest.NewServer(t, clientKey)
+	sshHost, sshPort, _ := net.SplitHostPort(server.Addr)
+	sshPortNumber, _ := strconv.Atoi(sshPort)
+	knownHosts := sshtest.KnownHosts(t, server)
+
+	for _, dbType := range []string{"mysql", "mariadb", "postgres"} {
+		before := len(server.Forwarded())
+		port, _ := strconv.Atoi(dbPort)
+		instance := config.DatabaseInstance{
+			Type:     dbType,
+			Host:     dbHost,
+			Port:     port,
+			Username: "monitor",
+			Password: "secret",
+			SSLMode:  "disable",
+			SSH: &config.SSHConfig{
+				Host:       sshHost,
+				Port:       sshPortNumber,
+				User:       "dbtop",
+				KeyFile:    keyFile,
+				KnownHosts: knownHosts,
+			},
+		}
+
+		driver, err := GetDriver(dbType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := driver.Connect(context.Background(), instance); err == nil {
+			t.Errorf("%s: Connect succeeded against a server that hangs up", dbType)
+		}
+		forwarded := server.Forwarded()[before:]
+		if len(forwarded) == 0 || forwarded[0] != listener.Addr().String() {
+			t.Errorf("%s: forwarded to %v, want %s", dbType, forwarded, listener.Addr())
+		}
+	}
+}
+
+func TestPostgresTLSThroughSSH(t *testing.T) {
+	// The database accepts the SSL request and completes the handshake,
+	// which only succeeds if the client checked the certificate against
+	// the real host rather than a forwarded local port
+	certFile, keyFile := writeCertificate(t)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	handshake := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		request := make([]byte, 8)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			handshake <- err
+			return
+		}
+		conn.Write([]byte("S"))
+		handshake <- tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}}).Handshake()
+	}()
+	_, dbPort, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := strconv.Atoi(dbPort)
+
+	keyFile, clientKey := sshtest.ClientKey(t)
+	server := sshtest.NewServer(t, clientKey)
+	sshHost, sshPort, _ := net.SplitHostPort(server.Addr)
+	sshPortNumber, _ := strconv.Atoi(sshPort)
+
+	instance := config.DatabaseInstance{
+		Type:     "postgres",
+		Host:     "localhost",
+		Port:     port,
+		Username: "monitor",
+		Password: "secret",
+		TLS:      &config.TLSConfig{CAFile: certFile},
+		SSH: &config.SSHConfig{
+			Host:       sshHost,
+			Port:       sshPortNumber,
+			User:       "dbtop",
+			KeyFile:    keyFile,
+			KnownHosts: sshtest.KnownHosts(t, server),
+		},
+	}
+	driver, err := GetDriver("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.Connect(context.Background(), instance); err == nil {
+		t.Error("Connect succeeded against a server that hangs up after the handshake")
+	}
+	if err := <-handshake; err != nil {
+		t.Errorf("TLS handshake failed: %v", err)
+	}
+}
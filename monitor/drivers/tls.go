@@ -0,0 +1,173 @@
+package drivers
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"dbtop/config"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// tlsConfig builds a crypto/tls configuration from the TLS settings of an
+// instance. The server name defaults to the host.
+func tlsConfig(instance config.DatabaseInstance) (*tls.Config, error) {
+	settings := instance.TLS
+	cfg := &tls.Config{
+		ServerName:         settings.ServerName,
+		InsecureSkipVerify: settings.SkipVerify,
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = instance.Host
+	}
+
+	if settings.CAFile != "" {
+		pem, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", settings.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if settings.CertFile != "" || settings.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// mysqlTLS registers the TLS settings of an instance with the MySQL driver
+// and returns the DSN with the tls parameter naming them. The name is
+// derived from the settings so reconnecting reuses the registration.
+func mysqlTLS(instance config.DatabaseInstance, dsn string) (string, error) {
+	if instance.TLS == nil {
+		return dsn, nil
+	}
+	if instance.TLS.Wallet != "" {
+		return "", errors.New("tls.wallet is only supported for Oracle")
+	}
+	if instance.TLS.ServerDN != "" {
+		return "", errors.New("tls.server_dn is only supported for Oracle")
+	}
+
+	cfg, err := tlsConfig(instance)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d %+v", instance.Host, instance.Port, *instance.TLS)))
+	name := "dbtop-" + hex.EncodeToString(sum[:8])
+	if err := mysql.RegisterTLSConfig(name, cfg); err != nil {
+		return "", fmt.Errorf("failed to register TLS config: %w", err)
+	}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + "tls=" + name, nil
+}
+
+// postgresQuote quotes a value for a key=value connection string
+func postgresQuote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// postgresTLS returns the connection string parameters for the TLS
+// settings of an instance. Unless ssl_mode is set, the server certificate
+// is verified against the host name, or only encryption is required when
+// verification is skipped.
+func postgresTLS(instance *config.DatabaseInstance) (string, error) {
+	settings := instance.TLS
+	if settings == nil {
+		return "", nil
+	}
+	if settings.Wallet != "" {
+		return "", errors.New("tls.wallet is only supported for Oracle")
+	}
+	if settings.ServerDN != "" {
+		return "", errors.New("tls.server_dn is only supported for Oracle")
+	}
+	if settings.ServerName != "" {
+		return "", errors.New("tls.server_name is not supported for PostgreSQL; connect to the host name in the certificate")
+	}
+
+	if instance.SSLMode == "" {
+		instance.SSLMode = "verify-full"
+		if settings.SkipVerify {
+			instance.SSLMode = "require"
+		}
+	}
+
+	var params string
+	if settings.CAFile != "" {
+		params += " sslrootcert=" + postgresQuote(settings.CAFile)
+	}
+	if settings.CertFile != "" {
+		params += " sslcert=" + postgresQuote(settings.CertFile)
+	}
+	if settings.KeyFile != "" {
+		params += " sslkey=" + postgresQuote(settings.KeyFile)
+	}
+	return params, nil
+}
+
+// oracleTLS adds the TLS settings of an instance to an Easy Connect string:
+// TCPS with Easy Connect Plus parameters for the wallet and for matching
+// the server certificate against the host, or against server_dn. Through
+// an SSH tunnel the host is the forwarded local port, so only server_dn
+// can be matched. Connect descriptors and TNS aliases carry their own
+// security settings and are rejected.
+func oracleTLS(instance config.DatabaseInstance, connect string) (string, error) {
+	settings := instance.TLS
+	for name, value := range map[string]string{
+		"ca_file":     settings.CAFile,
+		"cert_file":   settings.CertFile,
+		"key_file":    settings.KeyFile,
+		"server_name": settings.ServerName,
+	} {
+		if value != "" {
+			return "", fmt.Errorf("tls.%s is not supported for Oracle; put the certificates in a wallet and set tls.wallet", name)
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(connect), "("):
+		return "", errors.New("tls cannot be added to an Oracle connect descriptor; set PROTOCOL=TCPS and the SECURITY parameters in the descriptor instead")
+	case !strings.ContainsAny(connect, ":/"):
+		return "", fmt.Errorf("tls cannot be added to the TNS alias %s; configure TCPS in tnsnames.ora instead", connect)
+	}
+	address := strings.TrimPrefix(strings.TrimPrefix(connect, "tcp://"), "tcps://")
+	separator := "?"
+	if strings.Contains(address, "?") {
+		separator = "&"
+	}
+
+	match := "on"
+	if settings.SkipVerify {
+		match = "off"
+	}
+	connect = "tcps://" + address + separator + "ssl_server_dn_match=" + match
+	if settings.ServerDN != "" {
+		connect += `&ssl_server_cert_dn="` + settings.ServerDN + `"`
+	} else if instance.SSH != nil && !settings.SkipVerify {
+		return "", errors.New("tls.server_dn is required for Oracle through an SSH tunnel, since the certificate cannot be matched against the forwarded local port")
+	}
+	if settings.Wallet != "" {
+		connect += "&wallet_location=" + settings.Wallet
+	}
+	return connect, nil
+}
@@ -0,0 +1,220 @@
+package drivers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dbtop/config"
+)
+
+// writeCertificate writes a self-signed certificate and its key to a
+// temporary directory and returns their paths
+func writeCertificate(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "db.example.com"},
+		DNSNames:     []string{"db.example.com", "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	certFile, keyFile := writeCertificate(t)
+
+	cfg, err := tlsConfig(config.DatabaseInstance{
+		Host: "db.example.com",
+		TLS:  &config.TLSConfig{CAFile: certFile, CertFile: certFile, KeyFile: keyFile},
+	})
+	if err != nil {
+		t.Fatalf("tlsConfig failed: %v", err)
+	}
+	if cfg.ServerName != "db.example.com" || cfg.RootCAs == nil || len(cfg.Certificates) != 1 || cfg.InsecureSkipVerify {
+		t.Errorf("unexpected TLS config %+v", cfg)
+	}
+
+	cfg, err = tlsConfig(config.DatabaseInstance{
+		Host: "10.0.0.1",
+		TLS:  &config.TLSConfig{ServerName: "db.example.com", SkipVerify: true},
+	})
+	if err != nil || cfg.ServerName != "db.example.com" || !cfg.InsecureSkipVerify {
+		t.Errorf("tlsConfig = %+v, %v", cfg, err)
+	}
+
+	_, err = tlsConfig(config.DatabaseInstance{TLS: &config.TLSConfig{CAFile: keyFile}})
+	if err == nil || !strings.Contains(err.Error(), "no certificates found") {
+		t.Errorf("tlsConfig with a key as CA file: %v", err)
+	}
+}
+
+func TestMySQLTLS(t *testing.T) {
+	certFile, _ := writeCertificate(t)
+	instance := config.DatabaseInstance{
+		Host: "db.example.com",
+		Port: 3306,
+		TLS:  &config.TLSConfig{CAFile: certFile},
+	}
+
+	dsn, err := mysqlTLS(instance, "monitor:secret@tcp(db.example.com:3306)/")
+	if err != nil {
+		t.Fatalf("mysqlTLS failed: %v", err)
+	}
+	if !strings.HasPrefix(dsn, "monitor:secret@tcp(db.example.com:3306)/?tls=dbtop-") {
+		t.Errorf("dsn = %q", dsn)
+	}
+	again, _ := mysqlTLS(instance, "monitor:secret@tcp(db.example.com:3306)/?parseTime=true")
+	if !strings.HasSuffix(again, "&"+dsn[strings.Index(dsn, "tls="):]) {
+		t.Errorf("dsn = %q, want the same registration as %q", again, dsn)
+	}
+
+	instance.TLS = &config.TLSConfig{Wallet: "/etc/wallet"}
+	if _, err := mysqlTLS(instance, ""); err == nil {
+		t.Error("mysqlTLS accepted an Oracle wallet")
+	}
+}
+
+func TestPostgresTLS(t *testing.T) {
+	tests := []struct {
+		instance config.DatabaseInstance
+		params   string
+		sslMode  string
+		err      string
+	}{
+		{
+			instance: config.DatabaseInstance{TLS: &config.TLSConfig{CAFile: "/etc/ca.pem", CertFile: "/etc/it's.pem", KeyFile: "/etc/key.pem"}},
+			params:   ` sslrootcert='/etc/ca.pem' sslcert='/etc/it\'s.pem' sslkey='/etc/key.pem'`,
+			sslMode:  "verify-full",
+		},
+		{
+			instance: config.DatabaseInstance{TLS: &config.TLSConfig{SkipVerify: true}},
+			sslMode:  "require",
+		},
+		{
+			instance: config.DatabaseInstance{SSLMode: "verify-ca", TLS: &config.TLSConfig{CAFile: "/etc/ca.pem"}},
+			params:   ` sslrootcert='/etc/ca.pem'`,
+			sslMode:  "verify-ca",
+		},
+		{
+			instance: config.DatabaseInstance{SSLMode: "disable"},
+			sslMode:  "disable",
+		},
+		{
+			instance: config.DatabaseInstance{TLS: &config.TLSConfig{ServerName: "db"}},
+			err:      "tls.server_name is not supported",
+		},
+		{
+			instance: config.DatabaseInstance{TLS: &config.TLSConfig{ServerDN: "CN=db"}},
+			err:      "tls.server_dn is only supported for Oracle",
+		},
+	}
+	for _, tt := range tests {
+		instance := tt.instance
+		params, err := postgresTLS(&instance)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("postgresTLS error = %v, want %q", err, tt.err)
+			}
+			continue
+		}
+		if err != nil || params != tt.params || instance.SSLMode != tt.sslMode {
+			t.Errorf("postgresTLS = %q, %v with sslmode %q; want %q with sslmode %q", params, err, instance.SSLMode, tt.params, tt.sslMode)
+		}
+	}
+}
+
+func TestOracleTLS(t *testing.T) {
+	wallet := &config.TLSConfig{Wallet: "/etc/wallet"}
+	tunneled := config.DatabaseInstance{SSH: &config.SSHConfig{Host: "bastion.example.com"}}
+	tests := []struct {
+		instance config.DatabaseInstance
+		connect  string
+		want     string
+		err      string
+	}{
+		{
+			instance: config.DatabaseInstance{TLS: wallet},
+			connect:  "db.example.com:2484/ORCLPDB1",
+			want:     "tcps://db.example.com:2484/ORCLPDB1?ssl_server_dn_match=on&wallet_location=/etc/wallet",
+		},
+		{
+			// Parameters of the given connect string are kept
+			instance: config.DatabaseInstance{TLS: &config.TLSConfig{SkipVerify: true}},
+			connect:  "tcp://db.example.com:2484/ORCLPDB1?connect_timeout=5",
+			want:     "tcps://db.example.com:2484/ORCLPDB1?connect_timeout=5&ssl_server_dn_match=off",
+		},
+		{
+			instance: config.DatabaseInstance{TLS: &config.TLSConfig{CAFile: "/etc/ca.pem"}},
+			connect:  "db.example.com:2484/ORCLPDB1",
+			err:      "tls.ca_file is not supported",
+		},
+		{
+			instance: config.DatabaseInstance{TLS: wallet},
+			connect:  "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=db.example.com)(PORT=1521))(CONNECT_DATA=(SERVICE_NAME=ORCLPDB1)))",
+			err:      "tls cannot be added to an Oracle connect descriptor",
+		},
+		{
+			instance: config.DatabaseInstance{TLS: wallet},
+			connect:  "ORCLPDB1",
+			err:      "tls cannot be added to the TNS alias ORCLPDB1",
+		},
+		{
+			// Through an SSH tunnel the host is the forwarded port, so
+			// only the distinguished name can be matched
+			instance: config.DatabaseInstance{SSH: tunneled.SSH, TLS: wallet},
+			connect:  "127.0.0.1:40001/ORCLPDB1",
+			err:      "tls.server_dn is required",
+		},
+		{
+			instance: config.DatabaseInstance{SSH: tunneled.SSH, TLS: &config.TLSConfig{Wallet: "/etc/wallet", ServerDN: "CN=db.example.com,O=Example"}},
+			connect:  "127.0.0.1:40001/ORCLPDB1",
+			want:     `tcps://127.0.0.1:40001/ORCLPDB1?ssl_server_dn_match=on&ssl_server_cert_dn="CN=db.example.com,O=Example"&wallet_location=/etc/wallet`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := oracleTLS(tt.instance, tt.connect)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("oracleTLS(%q) error = %v, want %q", tt.connect, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("oracleTLS(%q) = %q, %v; want %q", tt.connect, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"dbtop/config"
+	"dbtop/monitor/stats"
+)
+
+// exporterTarget is an instance scraped by the exporter. The session is
+// opened lazily so an unreachable instance does not stop the exporter.
+type exporterTarget struct {
+	name     string
+	instance config.DatabaseInstance
+	mu       sync.Mutex
+	session  *session
+}
+
+// collect returns a fresh snapshot, reconnecting if needed
+func (t *exporterTarget) collect() (*stats.DatabaseStats, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.session == nil {
+		session, err := openSession(t.name, t.instance)
+		if err != nil {
+			return nil, err
+		}
+		t.session = session
+	}
+
+	stats, err := t.session.collect()
+	if err != nil {
+		// Drop the connection so the next scrape starts from scratch
+		t.session.close()
+		t.session = nil
+		return nil, err
+	}
+	return stats, nil
+}
+
+// metricSample is one value of a metric family with its extra labels
+type metricSample struct {
+	labels [][2]string
+	value  float64
+}
+
+// metricFamily describes a metric and how to extract it from a snapshot
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	samples func(s *stats.DatabaseStats) []metricSample
+}
+
+// single returns a family with one unlabelled sample per instance
+func single(name, help, kind string, value func(s *stats.DatabaseStats) float64) metricFamily {
+	return metricFamily{name, help, kind, func(s *stats.DatabaseStats) []metricSample {
+		return []metricSample{{value: value(s)}}
+	}}
+}
+
+// processCounts returns the number of processes per value of key
+func processCounts(label string, key func(p stats.ProcessInfo) string) func(s *stats.DatabaseStats) []metricSample {
+	return func(s *stats.DatabaseStats) []metricSample {
+		counts := make(map[string]int)
+		for _, process := range s.Processes {
+			counts[key(process)]++
+		}
+		values := make([]string, 0, len(counts))
+		for value := range counts {
+			values = append(values, value)
+		}
+		sort.Strings(values)
+
+		samples := make([]metricSample, 0, len(values))
+		for _, value := range values {
+			samples = append(samples, metricSample{
+				labels: [][2]string{{label, value}},
+				value:  float64(counts[value]),
+			})
+		}
+		return samples
+	}
+}
+
+// tableValues returns one sample per table
+func tableValues(value func(t stats.TableInfo) int64) func(s *stats.DatabaseStats) []metricSample {
+	return func(s *stats.DatabaseStats) []metricSample {
+		samples := make([]metricSample, 0, len(s.Tables))
+		for _, table := range s.Tables {
+			samples = append(samples, metricSample{
+				labels: [][2]string{{"table", table.Name}},
+				value:  float64(value(table)),
+			})
+		}
+		return samples
+	}
+}
+
+// replicationLag returns the overall replication lag, if it is known
+func replicationLag(s *stats.DatabaseStats) []metricSample {
+	if s.Replication == nil || !s.Replication.LagKnown {
+		return nil
+	}
+	return []metricSample{{value: s.Replication.Lag}}
+}
+
+// slotRetainedWAL returns one sample per replication slot
+func slotRetainedWAL(s *stats.DatabaseStats) []metricSample {
+	if s.Replication == nil {
+		return nil
+	}
+	samples := make([]metricSample, 0, len(s.Replication.Slots))
+	for _, slot := range s.Replication.Slots {
+		samples = append(samples, metricSample{
+			labels: [][2]string{{"slot", slot.Name}},
+			value:  float64(slot.RetainedWAL),
+		})
+	}
+	return samples
+}
+
+// counter returns a counter family backed by one of the cumulative counters
+func counter(name, help string, value func(c stats.Counters) int64) metricFamily {
+	return single(name, help, "counter", func(s *stats.DatabaseStats) float64 {
+		return float64(value(s.Counters))
+	})
+}
+
+var metricFamilies = []metricFamily{
+	single("dbtop_uptime_seconds", "Time since the database server started.", "gauge",
+		func(s *stats.DatabaseStats) float64 { return s.Uptime.Seconds() }),
+	single("dbtop_active_connections", "Number of connections currently executing a statement.", "gauge",
+		func(s *stats.DatabaseStats) float64 { return float64(s.ActiveConnections) }),
+	single("dbtop_connections", "Number of open connections.", "gauge",
+		func(s *stats.DatabaseStats) float64 { return float64(s.TotalConnections) }),
+	{"dbtop_threads", "Number of server threads by state.", "gauge", func(s *stats.DatabaseStats) []metricSample {
+		return []metricSample{
+			{labels: [][2]string{{"state", "running"}}, value: float64(s.Threads.Running)},
+			{labels: [][2]string{{"state", "connected"}}, value: float64(s.Threads.Connected)},
+			{labels: [][2]string{{"state", "sleeping"}}, value: float64(s.Threads.Sleeping)},
+			{labels: [][2]string{{"state", "locked"}}, value: float64(s.Threads.Locked)},
+		}
+	}},
+	{"dbtop_processes", "Number of processes by state.", "gauge",
+		processCounts("state", func(p stats.ProcessInfo) string { return p.State })},
+	{"dbtop_processes_by_user", "Number of processes by user.", "gauge",
+		processCounts("user", func(p stats.ProcessInfo) string { return p.User })},
+	{"dbtop_processes_by_database", "Number of processes by database.", "gauge",
+		processCounts("database", func(p stats.ProcessInfo) string { return p.Database })},
+	{"dbtop_table_rows", "Number of rows in the table.", "gauge",
+		tableValues(func(t stats.TableInfo) int64 { return t.Rows })},
+	{"dbtop_table_data_bytes", "Size of the table data in bytes.", "gauge",
+		tableValues(func(t stats.TableInfo) int64 { return t.DataSize })},
+	{"dbtop_table_index_bytes", "Size of the table indexes in bytes.", "gauge",
+		tableValues(func(t stats.TableInfo) int64 { return t.IndexSize })},
+	{"dbtop_replication_lag_seconds", "Highest replication lag of the server's replication channels and replicas.", "gauge",
+		replicationLag},
+	{"dbtop_replication_slot_retained_wal_bytes", "WAL retained by the replication slot.", "gauge",
+		slotRetainedWAL},
+	counter("dbtop_queries_total", "Statements executed by the server.",
+		func(c stats.Counters) int64 { return c.Queries }),
+	counter("dbtop_selects_total", "SELECT statements executed.",
+		func(c stats.Counters) int64 { return c.Selects }),
+	counter("dbtop_inserts_total", "INSERT statements executed.",
+		func(c stats.Counters) int64 { return c.Inserts }),
+	counter("dbtop_updates_total", "UPDATE statements executed.",
+		func(c stats.Counters) int64 { return c.Updates }),
+	counter("dbtop_deletes_total", "DELETE statements executed.",
+		func(c stats.Counters) int64 { return c.Deletes }),
+	counter("dbtop_commits_total", "Transactions committed.",
+		func(c stats.Counters) int64 { return c.Commits }),
+	counter("dbtop_rollbacks_total", "Transactions rolled back.",
+		func(c stats.Counters) int64 { return c.Rollbacks }),
+	counter("dbtop_slow_queries_total", "Statements that exceeded the slow query threshold.",
+		func(c stats.Counters) int64 { return c.SlowQueries }),
+	counter("dbtop_rows_read_total", "Rows read by the server.",
+		func(c stats.Counters) int64 { return c.RowsRead }),
+	counter("dbtop_rows_inserted_total", "Rows inserted.",
+		func(c stats.Counters) int64 { return c.RowsInserted }),
+	counter("dbtop_rows_updated_total", "Rows updated.",
+		func(c stats.Counters) int64 { return c.RowsUpdated }),
+	counter("dbtop_rows_deleted_total", "Rows deleted.",
+		func(c stats.Counters) int64 { return c.RowsDeleted }),
+}
+
+// scrapeResult is the outcome of collecting one target
+type scrapeResult struct {
+	target *exporterTarget
+	stats  *stats.DatabaseStats
+}
+
+// StartExporter serves the statistics of the named instances on listen in
+// the Prometheus text exposition format. Every series is labelled with the
+// instance name and database type.
+func StartExporter(instances map[string]config.DatabaseInstance, listen string) error {
+	return http.ListenAndServe(listen, newExporterHandler(instances))
+}
+
+// newExporterHandler returns the exporter's HTTP handler for the instances
+func newExporterHandler(instances map[string]config.DatabaseInstance) http.Handler {
+	var targets []*exporterTarget
+	for name, instance := range instances {
+		targets = append(targets, &exporterTarget{name: name, instance: instance})
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].name < targets[j].name
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		results := scrape(targets)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, results)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, `<html><body><h1>dbtop exporter</h1><a href="/metrics">Metrics</a></body></html>`)
+	})
+	return mux
+}
+
+// scrape collects all targets concurrently
+func scrape(targets []*exporterTarget) []scrapeResult {
+	results := make([]scrapeResult, len(targets))
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target *exporterTarget) {
+			defer wg.Done()
+			stats, err := target.collect()
+			if err != nil {
+				log.Printf("Failed to get stats for %s: %v", target.name, err)
+			}
+			results[i] = scrapeResult{target: target, stats: stats}
+		}(i, target)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// writeMetrics writes all metric families for the scraped targets
+func writeMetrics(w io.Writer, results []scrapeResult) {
+	buf := bufio.NewWriter(w)
+	defer buf.Flush()
+
+	fmt.Fprintln(buf, "# HELP dbtop_up Whether the last collection of the instance succeeded.")
+	fmt.Fprintln(buf, "# TYPE dbtop_up gauge")
+	for _, result := range results {
+		up := 0.0
+		if result.stats != nil {
+			up = 1
+		}
+		writeSample(buf, "dbtop_up", result.target, nil, up)
+	}
+
+	for _, family := range metricFamilies {
+		fmt.Fprintf(buf, "# HELP %s %s\n", family.name, family.help)
+		fmt.Fprintf(buf, "# TYPE %s %s\n", family.name, family.kind)
+		for _, result := range results {
+			if result.stats == nil {
+				continue
+			}
+			for _, sample := range family.samples(result.stats) {
+				writeSample(buf, family.name, result.target, sample.labels, sample.value)
+			}
+		}
+	}
+}
+
+// writeSample writes a single sample line
+func writeSample(w io.Writer, name string, target *exporterTarget, labels [][2]string, value float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteString(`{instance="`)
+	b.WriteString(escapeLabel(target.name))
+	b.WriteString(`",type="`)
+	b.WriteString(escapeLabel(target.instance.Type))
+	b.WriteString(`"`)
+	for _, label := range labels {
+		b.WriteString(",")
+		b.WriteString(label[0])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(label[1]))
+		b.WriteString(`"`)
+	}
+	b.WriteString("} ")
+	b.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	fmt.Fprintln(w, b.String())
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value for the text exposition format
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,88 @@
+package monitor
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dbtop/config"
+	"dbtop/monitor/drivers/fake"
+	"dbtop/monitor/stats"
+)
+
+func TestExporterMetrics(t *testing.T) {
+	fake.Register("fake-exporter-primary", &stats.DatabaseStats{
+		ActiveConnections: 3,
+		TotalConnections:  10,
+		Counters:          stats.Counters{Queries: 1234},
+		Processes: []stats.ProcessInfo{
+			{ID: 1, User: `app"ro`, Database: `C:\data`, State: "active"},
+			{ID: 2, User: "line\nbreak", Database: "shop", State: "active"},
+		},
+		Tables: []stats.TableInfo{{Name: "public.orders", Rows: 900, DataSize: 8192}},
+		// Replication status without a known lag
+		Replication: &stats.Replication{Role: "primary"},
+	})
+	fake.Register("fake-exporter-replica", &stats.DatabaseStats{
+		Replication: &stats.Replication{
+			Role: "replica", Lag: 2.5, LagKnown: true,
+			Slots: []stats.ReplicationSlot{{Name: "standby_1", RetainedWAL: 4096}},
+		},
+	})
+	down := fake.Register("fake-exporter-down")
+	down.ConnectErr = errors.New("connection refused")
+
+	server := httptest.NewServer(newExporterHandler(map[string]config.DatabaseInstance{
+		"primary": {Type: "fake-exporter-primary"},
+		"replica": {Type: "fake-exporter-replica"},
+		"down":    {Type: "fake-exporter-down"},
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := string(body)
+
+	for _, want := range []string{
+		"# HELP dbtop_up Whether the last collection of the instance succeeded.\n# TYPE dbtop_up gauge\n",
+		`dbtop_up{instance="down",type="fake-exporter-down"} 0` + "\n",
+		`dbtop_up{instance="primary",type="fake-exporter-primary"} 1` + "\n",
+		`dbtop_active_connections{instance="primary",type="fake-exporter-primary"} 3` + "\n",
+		"# TYPE dbtop_queries_total counter\n",
+		`dbtop_queries_total{instance="primary",type="fake-exporter-primary"} 1234` + "\n",
+		`dbtop_processes_by_user{instance="primary",type="fake-exporter-primary",user="app\"ro"} 1` + "\n",
+		`dbtop_processes_by_user{instance="primary",type="fake-exporter-primary",user="line\nbreak"} 1` + "\n",
+		`dbtop_processes_by_database{instance="primary",type="fake-exporter-primary",database="C:\\data"} 1` + "\n",
+		`dbtop_table_rows{instance="primary",type="fake-exporter-primary",table="public.orders"} 900` + "\n",
+		`dbtop_replication_lag_seconds{instance="replica",type="fake-exporter-replica"} 2.5` + "\n",
+		`dbtop_replication_slot_retained_wal_bytes{instance="replica",type="fake-exporter-replica",slot="standby_1"} 4096` + "\n",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+
+	// Unknown lag is left out rather than reported as zero, and instances
+	// that are down only have dbtop_up
+	for _, unwanted := range []string{
+		`dbtop_replication_lag_seconds{instance="primary"`,
+		`dbtop_uptime_seconds{instance="down"`,
+	} {
+		if strings.Contains(metrics, unwanted) {
+			t.Errorf("metrics contain %q", unwanted)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"dbtop/monitor/stats"
+	"dbtop/ui"
+)
+
+// historySize is the number of samples kept per charted metric
+const historySize = 300
+
+// ring is a fixed-size buffer of the most recent values of a metric
+type ring struct {
+	values []float64
+	next   int
+	full   bool
+}
+
+// newRing creates an empty ring holding up to size values
+func newRing(size int) *ring {
+	return &ring{values: make([]float64, size)}
+}
+
+// push adds a value, overwriting the oldest one when the ring is full
+func (r *ring) push(value float64) {
+	r.values[r.next] = value
+	r.next = (r.next + 1) % len(r.values)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// slice returns a copy of the values, oldest first
+func (r *ring) slice() []float64 {
+	if !r.full {
+		return append([]float64(nil), r.values[:r.next]...)
+	}
+	return append(append([]float64(nil), r.values[r.next:]...), r.values[:r.next]...)
+}
+
+// historyMetric is a metric charted over time. The value function reports
+// false when the snapshot does not know the value.
+type historyMetric struct {
+	name  string
+	unit  string
+	value func(snapshot *stats.DatabaseStats) (float64, bool)
+}
+
+// historyMetrics are the metrics kept in a History, in chart order
+var historyMetrics = []historyMetric{
+	{"Queries/Second", "", func(s *stats.DatabaseStats) (float64, bool) {
+		return s.QueriesPerSecond, true
+	}},
+	{"Active Connections", "", func(s *stats.DatabaseStats) (float64, bool) {
+		return float64(s.ActiveConnections), true
+	}},
+	{"Threads Running", "", func(s *stats.DatabaseStats) (float64, bool) {
+		return float64(s.Threads.Running), true
+	}},
+	{"Replication Lag", "s", func(s *stats.DatabaseStats) (float64, bool) {
+		if s.Replication == nil || !s.Replication.LagKnown {
+			return 0, false
+		}
+		return s.Replication.Lag, true
+	}},
+}
+
+// History keeps the recent values of the charted metrics of one instance.
+// It is safe for concurrent use, as pollers add samples while the UI reads
+// them.
+type History struct {
+	mu      sync.Mutex
+	size    int
+	last    time.Time
+	metrics []*ring // indexed like historyMetrics
+}
+
+// NewHistory creates an empty history keeping size samples per metric
+func NewHistory(size int) *History {
+	h := &History{size: size}
+	h.reset()
+	return h
+}
+
+// reset drops all samples
+func (h *History) reset() {
+	h.metrics = make([]*ring, len(historyMetrics))
+	for i := range h.metrics {
+		h.metrics[i] = newRing(h.size)
+	}
+}
+
+// Add records the charted metrics of a snapshot. Unknown values are kept
+// as NaN. A snapshot older than the previous one, as when seeking back in
+// a replay, starts a new history.
+func (h *History) Add(snapshot *stats.DatabaseStats) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if snapshot.Timestamp.Before(h.last) {
+		h.reset()
+	}
+	h.last = snapshot.Timestamp
+
+	for i, metric := range historyMetrics {
+		value, ok := metric.value(snapshot)
+		if !ok {
+			value = math.NaN()
+		}
+		h.metrics[i].push(value)
+	}
+}
+
+// Series returns the recorded values of each charted metric for the UI
+func (h *History) Series() []ui.MetricHistory {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series := make([]ui.MetricHistory, len(historyMetrics))
+	for i, metric := range historyMetrics {
+		series[i] = ui.MetricHistory{
+			Name:   metric.name,
+			Unit:   metric.unit,
+			Values: h.metrics[i].slice(),
+		}
+	}
+	return series
+}
@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"dbtop/monitor/stats"
+)
+
+func TestHistory(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshot := func(seconds int, connections int64, replication *stats.Replication) *stats.DatabaseStats {
+		return &stats.DatabaseStats{
+			Timestamp:         start.Add(time.Duration(seconds) * time.Second),
+			ActiveConnections: connections,
+			Replication:       replication,
+		}
+	}
+
+	history := NewHistory(3)
+	history.Add(snapshot(0, 1, nil))
+	history.Add(snapshot(1, 2, &stats.Replication{Lag: 4, LagKnown: true}))
+	history.Add(snapshot(2, 3, &stats.Replication{}))
+	history.Add(snapshot(3, 4, &stats.Replication{Lag: 1.5, LagKnown: true}))
+
+	series := history.Series()
+	if len(series) != len(historyMetrics) {
+		t.Fatalf("got %d series, want %d", len(series), len(historyMetrics))
+	}
+
+	// The ring keeps the last three samples, oldest first
+	connections := series[1]
+	if connections.Name != "Active Connections" || !reflect.DeepEqual(connections.Values, []float64{2, 3, 4}) {
+		t.Errorf("connections = %+v, want the last three samples", connections)
+	}
+
+	// Unknown lag is kept as NaN
+	lag := series[3].Values
+	if len(lag) != 3 || lag[0] != 4 || !math.IsNaN(lag[1]) || lag[2] != 1.5 {
+		t.Errorf("lag = %v, want [4 NaN 1.5]", lag)
+	}
+
+	// Going back in time starts over
+	history.Add(snapshot(1, 7, nil))
+	if got := history.Series()[1].Values; !reflect.DeepEqual(got, []float64{7}) {
+		t.Errorf("connections after going back = %v, want [7]", got)
+	}
+}
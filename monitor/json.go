@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"dbtop/config"
+	"dbtop/monitor/stats"
+)
+
+// jsonSnapshot is a single line of JSON output
+type jsonSnapshot struct {
+	Instance string `json:"instance"`
+	Type     string `json:"type"`
+	*stats.DatabaseStats
+}
+
+// StartJSON writes snapshots of the instance to w as JSON lines, one object
+// per refresh interval. When once is set a single snapshot is written and any
+// failure to collect it is returned; otherwise collection errors are reported
+// on stderr and streaming continues.
+func StartJSON(instanceName string, instance config.DatabaseInstance, w io.Writer, once bool) error {
+	session, err := openSession(instanceName, instance)
+	if err != nil {
+		return err
+	}
+	defer session.close()
+
+	encoder := json.NewEncoder(w)
+	for {
+		stats, err := session.collect()
+		if err != nil {
+			if once {
+				return fmt.Errorf("failed to get database stats: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Failed to get database stats: %v\n", err)
+		} else {
+			snapshot := jsonSnapshot{
+				Instance:      instanceName,
+				Type:          instance.Type,
+				DatabaseStats: stats,
+			}
+			if err := encoder.Encode(snapshot); err != nil {
+				return fmt.Errorf("failed to write snapshot: %w", err)
+			}
+		}
+
+		if once {
+			return nil
+		}
+		time.Sleep(instance.RefreshInterval)
+	}
+}
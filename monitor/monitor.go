@@ -1,64 +1,86 @@
 package monitor
 
 import (
-	"log"
 	"time"
 
 	"dbtop/config"
-	"dbtop/monitor/drivers"
 	"dbtop/ui"
+
+	"github.com/gizak/termui/v3"
 )
 
-// Start begins monitoring the specified database instance
-func Start(instanceName string, instance config.DatabaseInstance) {
-	// Get the appropriate driver for the database type
-	driver, err := drivers.GetDriver(instance.Type)
+// Start begins monitoring the specified database instance, evaluating
+// the alert rules that apply to it against every snapshot. Collecting and
+// reconnecting happen in the background, so the UI keeps handling keys
+// while the server is slow or unreachable.
+func Start(instanceName string, instance config.DatabaseInstance, alertsConfig config.AlertsConfig) error {
+	errorLog := ui.NewErrorLog(ui.ErrorLogSize)
+	dispatcher, err := newDispatcher(alertsConfig, errorLog)
+	if err != nil {
+		return err
+	}
+	defer dispatcher.Close()
+
+	evaluator, err := newEvaluator(instanceName, alertsConfig, dispatcher)
 	if err != nil {
-		log.Fatal("Failed to get database driver:", err)
+		return err
 	}
 
-	// Connect to the database
-	db, err := driver.Connect(instance)
+	session, err := openSession(instanceName, instance)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return err
 	}
-	defer db.Close()
+
+	// The poller owns the session from here on and closes it when done
+	poller := &poller{
+		name:      instanceName,
+		instance:  instance,
+		interval:  instance.RefreshInterval,
+		intervals: make(chan time.Duration, 1),
+		evaluator: evaluator,
+		errorLog:  errorLog,
+		session:   session,
+	}
+	updates := make(chan instanceUpdate)
+	done := make(chan struct{})
+	defer close(done)
+	go poller.run(updates, done)
 
 	// Initialize the UI
 	ui := ui.NewUI(instanceName, instance.Type, instance.RefreshInterval)
 	defer ui.Close()
+	ui.SetProcessHandler(poller.processAction)
+	ui.SetExplainHandler(poller.explain)
+	ui.SetHistoryHandler(poller.history)
+	ui.SetErrorLog(errorLog)
+	ui.Render()
 
-	// Start monitoring loop
-	ticker := time.NewTicker(instance.RefreshInterval)
-	defer ticker.Stop()
-
-	// Channel for UI events
-	uiEvents := make(chan string, 10)
-
-	// Start UI event handling in a goroutine
-	go func() {
-		for {
-			select {
-			case event := <-uiEvents:
-				if !ui.HandleKey(event) {
-					return
-				}
-			}
-		}
-	}()
-
+	uiEvents := termui.PollEvents()
 	for {
 		select {
-		case <-ticker.C:
-			// Get database statistics
-			stats, err := driver.GetStats(db, instance.Database)
-			if err != nil {
-				log.Printf("Failed to get database stats: %v", err)
+		case event := <-uiEvents:
+			switch event.Type {
+			case termui.ResizeEvent:
+				payload := event.Payload.(termui.Resize)
+				ui.Resize(payload.Width, payload.Height)
+			case termui.KeyboardEvent:
+				if !ui.HandleKey(event.ID) {
+					return nil
+				}
+				poller.setInterval(ui.RefreshInterval())
+				ui.Render()
+			}
+		case update := <-updates:
+			ui.SetConnectionStatus(update.connection)
+			if update.connected {
+				ui.SetServer(update.server, update.capabilities)
+			}
+			if update.err != nil {
+				ui.Render()
 				continue
 			}
-
-			// Update the UI
-			ui.Update(stats)
+			ui.SetAlertStatus(update.alerts)
+			ui.Update(update.stats)
 		}
 	}
 }
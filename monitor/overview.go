@@ -0,0 +1,267 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"dbtop/alerts"
+	"dbtop/config"
+	"dbtop/monitor/stats"
+	"dbtop/ui"
+
+	"github.com/gizak/termui/v3"
+)
+
+// instanceUpdate is the result of polling one instance
+type instanceUpdate struct {
+	name         string
+	stats        *stats.DatabaseStats
+	alerts       alerts.Status
+	connection   ui.ConnectionStatus
+	server       stats.ServerInfo
+	capabilities stats.Capabilities
+	connected    bool // whether server and capabilities are set
+	err          error
+}
+
+// poller periodically collects an instance in the background
+type poller struct {
+	name      string
+	instance  config.DatabaseInstance
+	interval  time.Duration
+	intervals chan time.Duration
+	evaluator *alerts.Evaluator
+	errorLog  *ui.ErrorLog
+
+	mu      sync.Mutex
+	session *session
+}
+
+// setSession publishes the poller's current session for process actions
+func (p *poller) setSession(session *session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.session = session
+}
+
+// processAction runs a UI process action on the poller's current session
+func (p *poller) processAction(action ui.ProcessAction, process stats.ProcessInfo) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.session == nil {
+		return errors.New("not connected")
+	}
+	return p.session.processAction(action, process)
+}
+
+// explain fetches a plan on the poller's current session
+func (p *poller) explain(process stats.ProcessInfo) (*stats.QueryPlan, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.session == nil {
+		return nil, errors.New("not connected")
+	}
+	return p.session.explain(process)
+}
+
+// setInterval passes a new refresh interval on to run, replacing any
+// change it has not picked up yet
+func (p *poller) setInterval(interval time.Duration) {
+	if interval == p.interval {
+		return
+	}
+	p.interval = interval
+	select {
+	case <-p.intervals:
+	default:
+	}
+	p.intervals <- interval
+}
+
+// history returns the metric history of the poller's current session
+func (p *poller) history() []ui.MetricHistory {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.session == nil {
+		return nil
+	}
+	return p.session.history.Series()
+}
+
+// run connects to the instance, unless it was given an open session, and
+// sends an update every refresh interval until done is closed. The session
+// reconnects with increasing delays when the connection is lost.
+func (p *poller) run(updates chan<- instanceUpdate, done <-chan struct{}) {
+	p.mu.Lock()
+	session := p.session
+	p.mu.Unlock()
+	defer func() {
+		if session != nil {
+			p.setSession(nil)
+			session.close()
+		}
+	}()
+
+	ticker := time.NewTicker(p.instance.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		update := instanceUpdate{name: p.name}
+		if session == nil {
+			session, update.err = newSession(p.name, p.instance)
+			p.setSession(session)
+		}
+		if session != nil {
+			update.stats, update.err = session.collect()
+			update.connection = session.connectionStatus()
+			update.server, update.capabilities, update.connected = session.server()
+			if errors.Is(update.err, errRetryPending) {
+				// Keep showing why the last attempt failed
+				update.err = update.connection.Err
+			} else if update.err != nil {
+				p.errorLog.Add(fmt.Errorf("%s: %w", p.name, update.err))
+			} else {
+				for _, warning := range session.newWarnings(update.stats) {
+					p.errorLog.Add(fmt.Errorf("%s: %s", p.name, warning))
+				}
+			}
+		}
+		if update.stats != nil {
+			update.alerts = p.evaluator.Evaluate(update.stats)
+		}
+
+		select {
+		case updates <- update:
+		case <-done:
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case interval := <-p.intervals:
+			ticker.Reset(interval)
+		case <-done:
+			return
+		}
+	}
+}
+
+// StartOverview polls all given instances concurrently and shows one
+// summary row per instance. Enter opens the single-instance view of the
+// selected row; Escape or q returns to the overview. Alert rules are
+// evaluated for every instance, whether or not it is open.
+func StartOverview(instances map[string]config.DatabaseInstance, alertsConfig config.AlertsConfig) error {
+	errorLog := ui.NewErrorLog(ui.ErrorLogSize)
+	dispatcher, err := newDispatcher(alertsConfig, errorLog)
+	if err != nil {
+		return err
+	}
+	defer dispatcher.Close()
+
+	types := make(map[string]string)
+	pollers := make(map[string]*poller)
+	for name, instance := range instances {
+		evaluator, err := newEvaluator(name, alertsConfig, dispatcher)
+		if err != nil {
+			return err
+		}
+		types[name] = instance.Type
+		pollers[name] = &poller{
+			name:      name,
+			instance:  instance,
+			interval:  instance.RefreshInterval,
+			intervals: make(chan time.Duration, 1),
+			evaluator: evaluator,
+			errorLog:  errorLog,
+		}
+	}
+
+	updates := make(chan instanceUpdate)
+	done := make(chan struct{})
+	defer close(done)
+	for _, poller := range pollers {
+		go poller.run(updates, done)
+	}
+
+	overview := ui.NewOverview(types)
+	defer overview.Close()
+	overview.Render()
+
+	// detail is the drilled-down view, or nil while showing the overview
+	var detail *ui.UI
+	var detailName string
+
+	uiEvents := termui.PollEvents()
+	for {
+		select {
+		case event := <-uiEvents:
+			switch event.Type {
+			case termui.ResizeEvent:
+				payload := event.Payload.(termui.Resize)
+				overview.Resize(payload.Width, payload.Height)
+				if detail != nil {
+					detail.Resize(payload.Width, payload.Height)
+				}
+			case termui.KeyboardEvent:
+				if detail == nil {
+					if event.ID == "<Enter>" {
+						detailName = overview.Selected()
+						if detailName == "" {
+							continue
+						}
+						detail = overview.Detail(detailName, pollers[detailName].interval)
+						detail.SetProcessHandler(pollers[detailName].processAction)
+						detail.SetExplainHandler(pollers[detailName].explain)
+						detail.SetHistoryHandler(pollers[detailName].history)
+						detail.SetErrorLog(errorLog)
+						detail.Render()
+						continue
+					}
+					if !overview.HandleKey(event.ID) {
+						return nil
+					}
+					overview.Render()
+					continue
+				}
+
+				if event.ID == "<C-c>" {
+					return nil
+				}
+				if (event.ID == "<Escape>" && !detail.Modal()) || !detail.HandleKey(event.ID) {
+					detail = nil
+					overview.Render()
+					continue
+				}
+
+				// Pass refresh rate changes on to the instance's poller
+				pollers[detailName].setInterval(detail.RefreshInterval())
+				detail.Render()
+			}
+		case update := <-updates:
+			overview.Update(update.name, update.stats, update.err)
+			overview.SetConnectionStatus(update.name, update.connection)
+			if update.connected {
+				overview.SetServer(update.name, update.server, update.capabilities)
+			}
+			if update.err == nil {
+				overview.SetAlertStatus(update.name, update.alerts)
+			}
+			if detail == nil {
+				overview.Render()
+			} else if update.name == detailName {
+				detail.SetConnectionStatus(update.connection)
+				if update.connected {
+					detail.SetServer(update.server, update.capabilities)
+				}
+				if update.err == nil {
+					detail.SetAlertStatus(update.alerts)
+					detail.Update(update.stats)
+				} else {
+					detail.Render()
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"dbtop/alerts"
+	"dbtop/config"
+	"dbtop/monitor/drivers/fake"
+	"dbtop/monitor/stats"
+	"dbtop/ui"
+)
+
+func TestPollerRun(t *testing.T) {
+	fake.Register("fake-poller", &stats.DatabaseStats{ActiveConnections: 2})
+	instance := config.DatabaseInstance{Type: "fake-poller", RefreshInterval: time.Hour}
+	session, err := openSession("test", instance)
+	if err != nil {
+		t.Fatalf("openSession failed: %v", err)
+	}
+	evaluator, err := alerts.NewEvaluator("test", nil, func(alerts.Alert) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The poller takes over the open session
+	p := &poller{
+		name:      "test",
+		instance:  instance,
+		interval:  instance.RefreshInterval,
+		intervals: make(chan time.Duration, 1),
+		evaluator: evaluator,
+		errorLog:  ui.NewErrorLog(ui.ErrorLogSize),
+		session:   session,
+	}
+	updates := make(chan instanceUpdate)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		p.run(updates, done)
+		close(stopped)
+	}()
+
+	receive := func(step string) instanceUpdate {
+		t.Helper()
+		select {
+		case update := <-updates:
+			return update
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no update", step)
+			return instanceUpdate{}
+		}
+	}
+
+	update := receive("first update")
+	if update.err != nil || !update.connected || update.stats.ActiveConnections != 2 {
+		t.Errorf("first update = %+v, want the snapshot of the open session", update)
+	}
+
+	// A shorter interval reaches the waiting poller
+	p.setInterval(10 * time.Millisecond)
+	receive("update after the interval change")
+
+	close(done)
+	<-stopped
+	if p.history() != nil {
+		t.Error("poller kept its session after stopping")
+	}
+}
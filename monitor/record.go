@@ -0,0 +1,60 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"dbtop/config"
+	"dbtop/recording"
+)
+
+// StartRecord appends a snapshot of the instance to the recording at path
+// every refresh interval until interrupted
+func StartRecord(instanceName string, instance config.DatabaseInstance, path string) error {
+	session, err := openSession(instanceName, instance)
+	if err != nil {
+		return err
+	}
+	defer session.close()
+
+	writer, err := recording.Create(path)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(instance.RefreshInterval)
+	defer ticker.Stop()
+
+	recorded := 0
+	for {
+		stats, err := session.collect()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get database stats: %v\n", err)
+		} else {
+			err := writer.Write(recording.Record{
+				Instance: instanceName,
+				Type:     instance.Type,
+				Stats:    stats,
+			})
+			if err != nil {
+				writer.Close()
+				return err
+			}
+			recorded++
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			fmt.Fprintf(os.Stderr, "Recorded %d snapshot(s) to %s\n", recorded, path)
+			return writer.Close()
+		}
+	}
+}
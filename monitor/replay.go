@@ -0,0 +1,235 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"dbtop/recording"
+	"dbtop/ui"
+
+	"github.com/gizak/termui/v3"
+)
+
+// replayHelp lists the controls of the replay view
+const replayHelp = "q: quit | Space: pause | Left/Right: step | </>: -/+1 min | g: go to time | [/]: speed | s/r/t/Enter: as live | k/c/e/+/-: live only"
+
+// replayer tracks the position and speed of a replay
+type replayer struct {
+	records  []recording.Record
+	position int
+	paused   bool
+	speed    float64
+	input    *string // go-to-time entry, nil when not typing
+	message  string
+}
+
+// current returns the record at the replay position
+func (r *replayer) current() recording.Record {
+	return r.records[r.position]
+}
+
+// delay returns how long to show the current record at the current speed
+func (r *replayer) delay() time.Duration {
+	if r.position+1 >= len(r.records) {
+		return time.Second
+	}
+	gap := r.records[r.position+1].Stats.Timestamp.Sub(r.current().Stats.Timestamp)
+	return max(time.Duration(float64(gap)/r.speed), 10*time.Millisecond)
+}
+
+// advance moves to the next record while playing and pauses at the end
+func (r *replayer) advance() bool {
+	if r.paused {
+		return false
+	}
+	if r.position+1 >= len(r.records) {
+		r.paused = true
+		r.message = "end of recording"
+		return true
+	}
+	r.position++
+	return true
+}
+
+// step moves by delta records and pauses the replay
+func (r *replayer) step(delta int) {
+	r.paused = true
+	r.position = min(max(r.position+delta, 0), len(r.records)-1)
+}
+
+// seek moves to the first record at or after t
+func (r *replayer) seek(t time.Time) {
+	r.position = sort.Search(len(r.records), func(i int) bool {
+		return !r.records[i].Stats.Timestamp.Before(t)
+	})
+	if r.position == len(r.records) {
+		r.position = len(r.records) - 1
+		r.message = "time is after the end of the recording"
+	}
+}
+
+// seekClock moves to a wall clock time given as HH:MM or HH:MM:SS, on the
+// day the recording started or the following day
+func (r *replayer) seekClock(clock string) error {
+	var hour, minute, second int
+	parts := strings.Split(clock, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("invalid time '%s' (expected HH:MM or HH:MM:SS)", clock)
+	}
+	values := []*int{&hour, &minute, &second}
+	for i, part := range parts {
+		if _, err := fmt.Sscanf(part, "%d", values[i]); err != nil {
+			return fmt.Errorf("invalid time '%s' (expected HH:MM or HH:MM:SS)", clock)
+		}
+	}
+
+	start := r.records[0].Stats.Timestamp
+	target := time.Date(start.Year(), start.Month(), start.Day(), hour, minute, second, 0, start.Location())
+	if target.Before(start) {
+		target = target.AddDate(0, 0, 1)
+	}
+	r.seek(target)
+	return nil
+}
+
+// history returns the metric history up to the replay position, so the
+// charts follow seeking in either direction
+func (r *replayer) history() []ui.MetricHistory {
+	history := NewHistory(historySize)
+	for _, record := range r.records[max(r.position-historySize+1, 0) : r.position+1] {
+		history.Add(record.Stats)
+	}
+	return history.Series()
+}
+
+// handleKey handles replay controls and reports whether the key was used
+func (r *replayer) handleKey(key string) bool {
+	if r.input != nil {
+		switch key {
+		case "<Enter>":
+			if err := r.seekClock(*r.input); err != nil {
+				r.message = err.Error()
+			}
+			r.input = nil
+		case "<Escape>":
+			r.input = nil
+		case "<Backspace>", "<C-<Backspace>>":
+			if len(*r.input) > 0 {
+				*r.input = (*r.input)[:len(*r.input)-1]
+			}
+		default:
+			if len(key) == 1 && strings.Contains("0123456789:", key) {
+				*r.input += key
+			}
+		}
+		return true
+	}
+
+	r.message = ""
+	switch key {
+	case "<Space>":
+		r.paused = !r.paused
+	case "<Right>", ".":
+		r.step(1)
+	case "<Left>", ",":
+		r.step(-1)
+	case ">":
+		r.seek(r.current().Stats.Timestamp.Add(time.Minute))
+	case "<":
+		r.seek(r.current().Stats.Timestamp.Add(-time.Minute))
+	case "]":
+		r.speed = min(r.speed*2, 64)
+	case "[":
+		r.speed = max(r.speed/2, 0.25)
+	case "g":
+		input := ""
+		r.input = &input
+	default:
+		return false
+	}
+	return true
+}
+
+// notice describes the replay position for the info box
+func (r *replayer) notice() string {
+	if r.input != nil {
+		return fmt.Sprintf("Go to time (HH:MM[:SS]): %s_", *r.input)
+	}
+
+	state := "playing"
+	if r.paused {
+		state = "paused"
+	}
+	notice := fmt.Sprintf("Replay: %s (%d/%d) %gx %s",
+		r.current().Stats.Timestamp.Format("2006-01-02 15:04:05"),
+		r.position+1, len(r.records), r.speed, state)
+	if r.message != "" {
+		notice += " - " + r.message
+	}
+	return notice
+}
+
+// StartReplay shows a recording in the monitoring UI with controls to
+// pause, step, seek, and change the playback speed
+func StartReplay(path string) error {
+	records, err := recording.Load(path)
+	if err != nil {
+		return err
+	}
+
+	r := &replayer{records: records, speed: 1}
+	first := r.current()
+
+	// Use the recorded sampling interval as the displayed refresh rate
+	interval := time.Duration(0)
+	if len(records) > 1 {
+		interval = records[1].Stats.Timestamp.Sub(first.Stats.Timestamp)
+	}
+
+	ui := ui.NewUI(first.Instance, first.Type, interval)
+	defer ui.Close()
+	ui.SetHelp(replayHelp)
+	ui.SetReplay()
+	ui.SetHistoryHandler(r.history)
+
+	show := func() {
+		ui.SetNotice(r.notice())
+		ui.Update(r.current().Stats)
+	}
+	show()
+
+	timer := time.NewTimer(r.delay())
+	defer timer.Stop()
+
+	uiEvents := termui.PollEvents()
+	for {
+		select {
+		case event := <-uiEvents:
+			switch event.Type {
+			case termui.ResizeEvent:
+				payload := event.Payload.(termui.Resize)
+				ui.Resize(payload.Width, payload.Height)
+			case termui.KeyboardEvent:
+				if event.ID == "<C-c>" {
+					return nil
+				}
+				if r.handleKey(event.ID) {
+					show()
+					timer.Reset(r.delay())
+					continue
+				}
+				if !ui.HandleKey(event.ID) {
+					return nil
+				}
+				ui.Render()
+			}
+		case <-timer.C:
+			if r.advance() {
+				show()
+			}
+			timer.Reset(r.delay())
+		}
+	}
+}
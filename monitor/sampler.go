@@ -0,0 +1,144 @@
+package monitor
+
+import (
+	"sort"
+
+	"dbtop/monitor/stats"
+)
+
+// maxStatements limits the statements kept in a snapshot
+const maxStatements = 200
+
+// Sampler derives per-second rates from the cumulative counters of
+// successive snapshots of a single instance
+type Sampler struct {
+	previous   *stats.DatabaseStats
+	statements map[string]stats.StatementCounters // totals of all statements of the previous snapshot
+}
+
+// NewSampler creates a sampler with no previous snapshot
+func NewSampler() *Sampler {
+	return &Sampler{}
+}
+
+// Sample fills in the rate fields of current from the difference with the
+// previous snapshot and remembers current for the next call. The first
+// snapshot, and any snapshot taken after a server restart, has zero rates.
+//
+// Drivers return every statement, so that one that only just became busy
+// is compared with its earlier totals; Sample then keeps the statements
+// with the most time since the previous snapshot.
+func (s *Sampler) Sample(current *stats.DatabaseStats) {
+	previous := s.previous
+	s.previous = current
+
+	previousStatements := s.statements
+	s.statements = statementTotals(current.Statements)
+	defer func() {
+		current.Statements = topStatements(current.Statements, maxStatements)
+	}()
+
+	if previous == nil || current.Uptime < previous.Uptime {
+		return
+	}
+
+	elapsed := current.Timestamp.Sub(previous.Timestamp).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	cur, prev := current.Counters, previous.Counters
+	current.Rates = stats.Rates{
+		Queries:      rate(cur.Queries, prev.Queries, elapsed),
+		Selects:      rate(cur.Selects, prev.Selects, elapsed),
+		Inserts:      rate(cur.Inserts, prev.Inserts, elapsed),
+		Updates:      rate(cur.Updates, prev.Updates, elapsed),
+		Deletes:      rate(cur.Deletes, prev.Deletes, elapsed),
+		Commits:      rate(cur.Commits, prev.Commits, elapsed),
+		Rollbacks:    rate(cur.Rollbacks, prev.Rollbacks, elapsed),
+		SlowQueries:  rate(cur.SlowQueries, prev.SlowQueries, elapsed),
+		RowsRead:     rate(cur.RowsRead, prev.RowsRead, elapsed),
+		RowsInserted: rate(cur.RowsInserted, prev.RowsInserted, elapsed),
+		RowsUpdated:  rate(cur.RowsUpdated, prev.RowsUpdated, elapsed),
+		RowsDeleted:  rate(cur.RowsDeleted, prev.RowsDeleted, elapsed),
+	}
+	current.QueriesPerSecond = current.Rates.Queries
+
+	statementDeltas(current.Statements, previousStatements)
+	waitEventDeltas(current.WaitEvents, previous.WaitEvents)
+}
+
+// statementDeltas fills in the increase of each statement since the
+// previous snapshot. Statements that were not in the previous snapshot, or
+// whose counters were reset, have no delta.
+func statementDeltas(current []stats.Statement, totals map[string]stats.StatementCounters) {
+	for i := range current {
+		prev, ok := totals[current[i].ID]
+		cur := current[i].Total
+		if !ok || cur.Calls < prev.Calls {
+			continue
+		}
+		current[i].Delta = cur.Sub(prev)
+	}
+}
+
+// statementTotals maps the statements to their cumulative counters
+func statementTotals(statements []stats.Statement) map[string]stats.StatementCounters {
+	totals := make(map[string]stats.StatementCounters, len(statements))
+	for _, statement := range statements {
+		totals[statement.ID] = statement.Total
+	}
+	return totals
+}
+
+// topStatements returns the n statements with the most time since the
+// previous snapshot, falling back to the most total time for those without
+// a delta, e.g. in the first snapshot
+func topStatements(statements []stats.Statement, n int) []stats.Statement {
+	sort.SliceStable(statements, func(i, j int) bool {
+		a, b := statements[i], statements[j]
+		if a.Delta.Time != b.Delta.Time {
+			return a.Delta.Time > b.Delta.Time
+		}
+		return a.Total.Time > b.Total.Time
+	})
+	if len(statements) > n {
+		// Copy so the snapshot does not hold on to all statements
+		statements = append([]stats.Statement(nil), statements[:n]...)
+	}
+	return statements
+}
+
+// rate returns the per-second increase of a counter, treating a counter
+// that went backwards (e.g. after FLUSH STATUS) as having no activity
+func rate(current, previous int64, elapsed float64) float64 {
+	if current < previous {
+		return 0
+	}
+	return float64(current-previous) / elapsed
+}
+
+// waitEventDeltas fills in the increase of each wait event since the
+// previous snapshot
+func waitEventDeltas(current, previous []stats.WaitEvent) {
+	if len(current) == 0 || len(previous) == 0 {
+		return
+	}
+
+	totals := make(map[string]stats.WaitCounters, len(previous))
+	for _, event := range previous {
+		totals[event.Event] = event.Total
+	}
+
+	for i := range current {
+		prev, ok := totals[current[i].Event]
+		cur := current[i].Total
+		if !ok || cur.Waits < prev.Waits {
+			continue
+		}
+		current[i].Delta = stats.WaitCounters{
+			Waits: cur.Waits - prev.Waits,
+			Time:  cur.Time - prev.Time,
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"dbtop/config"
+	"dbtop/monitor/drivers/fake"
+	"dbtop/monitor/stats"
+)
+
+func TestSessionRates(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake.Register("fake-rates",
+		&stats.DatabaseStats{
+			Timestamp: start,
+			Uptime:    time.Hour,
+			Counters:  stats.Counters{Queries: 100, Commits: 10, SlowQueries: 1},
+		},
+		&stats.DatabaseStats{
+			Timestamp: start.Add(2 * time.Second),
+			Uptime:    time.Hour + 2*time.Second,
+			Counters:  stats.Counters{Queries: 300, Commits: 14, SlowQueries: 1},
+		},
+		// Server restarted: counters went back to zero
+		&stats.DatabaseStats{
+			Timestamp: start.Add(4 * time.Second),
+			Uptime:    time.Second,
+			Counters:  stats.Counters{Queries: 5},
+		},
+	)
+
+	session, err := openSession("test", config.DatabaseInstance{Type: "fake-rates"})
+	if err != nil {
+		t.Fatalf("openSession failed: %v", err)
+	}
+	defer session.close()
+
+	tests := []struct {
+		queries float64
+		commits float64
+	}{
+		{0, 0},
+		{100, 2},
+		{0, 0},
+	}
+	for i, tt := range tests {
+		got, err := session.collect()
+		if err != nil {
+			t.Fatalf("collect #%d failed: %v", i, err)
+		}
+		if got.Rates.Queries != tt.queries || got.QueriesPerSecond != tt.queries {
+			t.Errorf("collect #%d: queries/s = %v (QueriesPerSecond %v), want %v", i, got.Rates.Queries, got.QueriesPerSecond, tt.queries)
+		}
+		if got.Rates.Commits != tt.commits {
+			t.Errorf("collect #%d: commits/s = %v, want %v", i, got.Rates.Commits, tt.commits)
+		}
+	}
+}
+
+func TestStatementDeltas(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sampler := NewSampler()
+
+	sampler.Sample(&stats.DatabaseStats{
+		Timestamp: start,
+		Uptime:    time.Hour,
+		Statements: []stats.Statement{
+			{ID: "a", Total: stats.StatementCounters{Calls: 10, Time: 100, Rows: 10}},
+			{ID: "b", Total: stats.StatementCounters{Calls: 50, Time: 5}},
+		},
+	})
+
+	current := &stats.DatabaseStats{
+		Timestamp: start.Add(2 * time.Second),
+		Uptime:    time.Hour + 2*time.Second,
+		Statements: []stats.Statement{
+			{ID: "a", Total: stats.StatementCounters{Calls: 15, Time: 160, Rows: 15, BlocksHit: 4}},
+			{ID: "b", Total: stats.StatementCounters{Calls: 2, Time: 1}}, // reset
+			{ID: "c", Total: stats.StatementCounters{Calls: 7, Time: 70}},
+		},
+	}
+	sampler.Sample(current)
+
+	want := map[string]stats.StatementCounters{
+		"a": {Calls: 5, Time: 60, Rows: 5, BlocksHit: 4},
+		"b": {},
+		"c": {},
+	}
+	for _, statement := range current.Statements {
+		if statement.Delta != want[statement.ID] {
+			t.Errorf("statement %s: delta = %+v, want %+v", statement.ID, statement.Delta, want[statement.ID])
+		}
+	}
+}
+
+func TestTopStatements(t *testing.T) {
+	statements := []stats.Statement{
+		{ID: "slow", Total: stats.StatementCounters{Time: 90000}, Delta: stats.StatementCounters{Time: 10}},
+		{ID: "new", Total: stats.StatementCounters{Time: 500}},
+		{ID: "hot", Total: stats.StatementCounters{Time: 800}, Delta: stats.StatementCounters{Time: 700}},
+		{ID: "idle", Total: stats.StatementCounters{Time: 50000}},
+	}
+
+	// Recent activity outranks the all-time totals
+	var got []string
+	for _, statement := range topStatements(statements, 3) {
+		got = append(got, statement.ID)
+	}
+	if want := []string{"hot", "slow", "idle"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("topStatements = %v, want %v", got, want)
+	}
+}
+
+func TestWaitEventDeltas(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sampler := NewSampler()
+
+	sampler.Sample(&stats.DatabaseStats{
+		Timestamp: start,
+		Uptime:    time.Hour,
+		WaitEvents: []stats.WaitEvent{
+			{Event: "log file sync", Total: stats.WaitCounters{Waits: 40, Time: 80}},
+		},
+	})
+
+	current := &stats.DatabaseStats{
+		Timestamp: start.Add(2 * time.Second),
+		Uptime:    time.Hour + 2*time.Second,
+		WaitEvents: []stats.WaitEvent{
+			{Event: "log file sync", Total: stats.WaitCounters{Waits: 50, Time: 110}},
+			{Event: "db file sequential read", Total: stats.WaitCounters{Waits: 5, Time: 10}},
+		},
+	}
+	sampler.Sample(current)
+
+	want := []stats.WaitCounters{{Waits: 10, Time: 30}, {}}
+	for i, event := range current.WaitEvents {
+		if event.Delta != want[i] {
+			t.Errorf("event %s: delta = %+v, want %+v", event.Event, event.Delta, want[i])
+		}
+	}
+}
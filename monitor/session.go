@@ -0,0 +1,261 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"dbtop/config"
+	"dbtop/monitor/drivers"
+	"dbtop/monitor/stats"
+	"dbtop/ui"
+)
+
+const (
+	// initialBackoff is the delay before the second reconnect attempt
+	initialBackoff = time.Second
+	// maxBackoff is the longest delay between reconnect attempts. Once it
+	// is reached the connection is reported as failed.
+	maxBackoff = time.Minute
+)
+
+// errRetryPending is returned by collect while waiting for the next
+// reconnect attempt
+var errRetryPending = errors.New("not connected, waiting to reconnect")
+
+// session holds the connection and sampling state of one monitored instance
+type session struct {
+	name     string
+	instance config.DatabaseInstance
+	driver   drivers.Driver
+	sampler  *Sampler
+	history  *History
+	now      func() time.Time
+	warned   map[string]bool // warnings of the last snapshot
+
+	mu      sync.Mutex
+	conn    *drivers.Conn // nil while reconnecting
+	status  ui.ConnectionStatus
+	backoff time.Duration
+}
+
+// newSession looks up the driver for the instance without connecting to
+// it. The password has to be resolved already.
+func newSession(name string, instance config.DatabaseInstance) (*session, error) {
+	// Get the appropriate driver for the database type
+	driver, err := drivers.GetDriver(instance.Type)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database driver: %w", err)
+	}
+
+	if instance.QueryTimeout == 0 {
+		instance.QueryTimeout = config.DefaultQueryTimeout
+	}
+
+	return &session{
+		name:     name,
+		instance: instance,
+		driver:   driver,
+		sampler:  NewSampler(),
+		history:  NewHistory(historySize),
+		now:      time.Now,
+		status:   ui.ConnectionStatus{State: ui.StateReconnecting},
+	}, nil
+}
+
+// openSession looks up the driver for the instance and connects to it
+func openSession(name string, instance config.DatabaseInstance) (*session, error) {
+	s, err := newSession(name, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	// Connect to the database
+	if _, err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// queryContext returns the context that bounds one call to the driver
+func (s *session) queryContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), s.instance.QueryTimeout)
+}
+
+// connect returns the connection, reconnecting first if the connection
+// was lost and the backoff delay has passed
+func (s *session) connect() (*drivers.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		return s.conn, nil
+	}
+	if s.now().Before(s.status.NextRetry) {
+		return nil, errRetryPending
+	}
+
+	ctx, cancel := s.queryContext()
+	defer cancel()
+	conn, err := s.driver.Connect(ctx, s.instance)
+	if err != nil {
+		s.backoff = min(max(2*s.backoff, initialBackoff), maxBackoff)
+		s.status.Attempts++
+		s.status.NextRetry = s.now().Add(s.backoff)
+		s.status.Err = err
+		if s.backoff == maxBackoff {
+			s.status.State = ui.StateFailed
+		}
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	s.conn = conn
+	s.backoff = 0
+	s.status = ui.ConnectionStatus{State: ui.StateConnected}
+	return conn, nil
+}
+
+// current returns the connection without reconnecting
+func (s *session) current() (*drivers.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil, errors.New("not connected")
+	}
+	return s.conn, nil
+}
+
+// server returns the server of the current connection and the features
+// it supports. ok is false while not connected.
+func (s *session) server() (server stats.ServerInfo, capabilities stats.Capabilities, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return stats.ServerInfo{}, 0, false
+	}
+	return s.conn.Server, s.conn.Capabilities, true
+}
+
+// connectionStatus returns the state of the connection
+func (s *session) connectionStatus() ui.ConnectionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// collect fetches a new snapshot, fills in its rates, and adds it to the
+// metric history. A failed collection marks the connection as degraded if
+// the server still answers, and as lost otherwise, in which case the
+// following calls reconnect with increasing delays.
+func (s *session) collect() (*stats.DatabaseStats, error) {
+	conn, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := s.queryContext()
+	defer cancel()
+	stats, err := s.driver.Collect(ctx, conn, s.instance.Database)
+	if err != nil {
+		s.collectFailed(conn, err)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.status = ui.ConnectionStatus{State: ui.StateConnected}
+	s.mu.Unlock()
+
+	s.sampler.Sample(stats)
+	s.history.Add(stats)
+	return stats, nil
+}
+
+// newWarnings returns the warnings of a snapshot that the previous one did
+// not have, so that a lasting problem such as a missing privilege is
+// logged once instead of on every refresh
+func (s *session) newWarnings(snapshot *stats.DatabaseStats) []string {
+	var fresh []string
+	warned := make(map[string]bool)
+	for _, warning := range snapshot.Warnings {
+		if !s.warned[warning] {
+			fresh = append(fresh, warning)
+		}
+		warned[warning] = true
+	}
+	s.warned = warned
+	return fresh
+}
+
+// collectFailed checks whether the connection survived a failed
+// collection and drops it if not
+func (s *session) collectFailed(conn *drivers.Conn, err error) {
+	ctx, cancel := s.queryContext()
+	defer cancel()
+	pingErr := conn.DB.PingContext(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pingErr == nil {
+		s.status = ui.ConnectionStatus{State: ui.StateDegraded, Err: err}
+		return
+	}
+	if s.conn == conn {
+		s.conn.Close()
+		s.conn = nil
+	}
+	s.backoff = 0
+	s.status = ui.ConnectionStatus{State: ui.StateReconnecting, Err: pingErr}
+}
+
+// processAction carries out a kill or cancel request from the UI
+func (s *session) processAction(action ui.ProcessAction, process stats.ProcessInfo) error {
+	conn, err := s.current()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := s.queryContext()
+	defer cancel()
+
+	switch action {
+	case ui.ActionKill:
+		if !conn.Capabilities.Has(stats.CapKill) {
+			return fmt.Errorf("killing sessions is not supported on %s", conn.Server)
+		}
+		return s.driver.KillProcess(ctx, conn, process)
+	case ui.ActionCancel:
+		if !conn.Capabilities.Has(stats.CapCancel) {
+			return fmt.Errorf("cancelling queries is not supported on %s", conn.Server)
+		}
+		return s.driver.CancelQuery(ctx, conn, process)
+	default:
+		return fmt.Errorf("unsupported process action %d", action)
+	}
+}
+
+// explain fetches the execution plan of a process for the UI
+func (s *session) explain(process stats.ProcessInfo) (*stats.QueryPlan, error) {
+	conn, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	if !conn.Capabilities.Has(stats.CapExplain) {
+		return nil, fmt.Errorf("execution plans are not supported on %s", conn.Server)
+	}
+	ctx, cancel := s.queryContext()
+	defer cancel()
+	return s.driver.Explain(ctx, conn, process)
+}
+
+// close releases the database connection
+func (s *session) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,134 @@
+package monitor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dbtop/config"
+	"dbtop/monitor/drivers/fake"
+	"dbtop/monitor/stats"
+	"dbtop/ui"
+)
+
+func TestSessionReconnect(t *testing.T) {
+	driver := fake.Register("fake-reconnect")
+	session, err := openSession("test", config.DatabaseInstance{Type: "fake-reconnect"})
+	if err != nil {
+		t.Fatalf("openSession failed: %v", err)
+	}
+	defer session.close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	session.now = func() time.Time { return now }
+
+	check := func(step string, wantErr bool, state ui.ConnectionState, attempts int) {
+		t.Helper()
+		_, err := session.collect()
+		if (err != nil) != wantErr {
+			t.Errorf("%s: collect error = %v, want error %v", step, err, wantErr)
+		}
+		status := session.connectionStatus()
+		if status.State != state || status.Attempts != attempts {
+			t.Errorf("%s: state %s after %d attempts, want %s after %d", step, status.State, status.Attempts, state, attempts)
+		}
+	}
+
+	check("connected", false, ui.StateConnected, 0)
+
+	// The queries fail but the server still answers
+	driver.StatsErr = errors.New("query timed out")
+	check("query failure", true, ui.StateDegraded, 0)
+
+	// The server went away: the connection is dropped and reconnected
+	driver.PingErr = errors.New("connection refused")
+	check("connection lost", true, ui.StateReconnecting, 0)
+	if err := session.processAction(ui.ActionKill, stats.ProcessInfo{ID: 1}); err == nil {
+		t.Error("processAction succeeded without a connection")
+	}
+
+	driver.ConnectErr = errors.New("connection refused")
+	check("first attempt", true, ui.StateReconnecting, 1)
+	if _, err := session.collect(); !errors.Is(err, errRetryPending) {
+		t.Errorf("collect before the backoff passed: %v, want errRetryPending", err)
+	}
+
+	// The delays double up to a minute, at which point the connection is
+	// reported as failed
+	for attempt, delay := range []time.Duration{1, 2, 4, 8, 16, 32} {
+		now = now.Add(delay * time.Second)
+		state := ui.StateReconnecting
+		if delay == 32 {
+			state = ui.StateFailed
+		}
+		check("retry", true, state, attempt+2)
+	}
+	if next := session.connectionStatus().NextRetry; next != now.Add(maxBackoff) {
+		t.Errorf("next retry at %v, want %v", next, now.Add(maxBackoff))
+	}
+
+	driver.ConnectErr = nil
+	driver.PingErr = nil
+	driver.StatsErr = nil
+	now = now.Add(maxBackoff)
+	check("reconnected", false, ui.StateConnected, 0)
+}
+
+func TestSessionCapabilities(t *testing.T) {
+	driver := fake.Register("fake-old")
+	driver.Server = stats.ServerInfo{Version: "5.6.51"}
+	driver.Unsupported = stats.CapCancel | stats.CapExplain
+	driver.Plan = &stats.QueryPlan{Text: []string{"plan"}}
+
+	session, err := openSession("test", config.DatabaseInstance{Type: "fake-old"})
+	if err != nil {
+		t.Fatalf("openSession failed: %v", err)
+	}
+	defer session.close()
+
+	server, capabilities, ok := session.server()
+	if !ok || server.String() != "fake 5.6.51" || capabilities.Has(stats.CapCancel) {
+		t.Errorf("server() = %s, %s, %v", server, capabilities, ok)
+	}
+
+	process := stats.ProcessInfo{ID: 1}
+	if err := session.processAction(ui.ActionKill, process); err != nil {
+		t.Errorf("kill failed: %v", err)
+	}
+	if err := session.processAction(ui.ActionCancel, process); err == nil {
+		t.Error("cancel succeeded on a server without it")
+	}
+	if _, err := session.explain(process); err == nil {
+		t.Error("explain succeeded on a server without it")
+	}
+	if len(driver.Killed) != 1 || len(driver.Cancelled) != 0 {
+		t.Errorf("driver got killed %v, cancelled %v", driver.Killed, driver.Cancelled)
+	}
+}
+
+func TestSessionNewWarnings(t *testing.T) {
+	denied := "failed to get lock waits: permission denied"
+	fake.Register("fake-warnings",
+		&stats.DatabaseStats{Warnings: []string{denied}},
+		&stats.DatabaseStats{Warnings: []string{denied}},
+		&stats.DatabaseStats{},
+		&stats.DatabaseStats{Warnings: []string{denied}},
+	)
+	session, err := openSession("test", config.DatabaseInstance{Type: "fake-warnings"})
+	if err != nil {
+		t.Fatalf("openSession failed: %v", err)
+	}
+	defer session.close()
+
+	// A lasting warning is reported when it first appears and again only
+	// after it went away
+	for i, want := range []int{1, 0, 0, 1} {
+		snapshot, err := session.collect()
+		if err != nil {
+			t.Fatalf("collect failed: %v", err)
+		}
+		if got := session.newWarnings(snapshot); len(got) != want {
+			t.Errorf("snapshot %d: new warnings %q, want %d", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package stats
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ServerInfo describes the server a driver is connected to
+type ServerInfo struct {
+	Flavor  string `json:"flavor"`            // e.g. mysql, percona, mariadb, postgres, oracle
+	Version string `json:"version,omitempty"` // dotted version number, empty when unknown
+	Edition string `json:"edition,omitempty"` // e.g. Enterprise, or the server's version comment
+}
+
+// String describes the server as flavor and version
+func (s ServerInfo) String() string {
+	if s.Version == "" {
+		return s.Flavor
+	}
+	return s.Flavor + " " + s.Version
+}
+
+// AtLeast reports whether the server version is at or above the given
+// version, e.g. AtLeast(8, 0, 22). An unknown version counts as recent,
+// so features are only disabled when the version is known to lack them.
+func (s ServerInfo) AtLeast(version ...int) bool {
+	if s.Version == "" {
+		return true
+	}
+	parts := strings.Split(s.Version, ".")
+	for i, want := range version {
+		var got int
+		if i < len(parts) {
+			var err error
+			if got, err = strconv.Atoi(parts[i]); err != nil {
+				return true
+			}
+		}
+		if got != want {
+			return got > want
+		}
+	}
+	return true
+}
+
+// Capabilities is the set of optional features a server supports
+type Capabilities uint
+
+const (
+	// CapKill allows terminating sessions
+	CapKill Capabilities = 1 << iota
+	// CapCancel allows aborting the statement of a session
+	CapCancel
+	// CapExplain allows fetching the plan of a running statement
+	CapExplain
+	// CapReplication provides the replication status
+	CapReplication
+	// CapLocks provides lock waits
+	CapLocks
+	// CapDigests provides statement statistics
+	CapDigests
+	// CapTables provides table sizes
+	CapTables
+
+	// AllCapabilities is the set of every feature
+	AllCapabilities = CapKill | CapCancel | CapExplain | CapReplication | CapLocks | CapDigests | CapTables
+)
+
+var capabilityNames = []string{"kill", "cancel", "explain", "replication", "locks", "digests", "tables"}
+
+// Has reports whether all of the given capabilities are in the set
+func (c Capabilities) Has(capabilities Capabilities) bool {
+	return c&capabilities == capabilities
+}
+
+// String lists the capabilities in the set, e.g. "kill,explain"
+func (c Capabilities) String() string {
+	var names []string
+	for i, name := range capabilityNames {
+		if c.Has(1 << i) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
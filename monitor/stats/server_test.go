@@ -0,0 +1,39 @@
+package stats
+
+import "testing"
+
+func TestServerInfoAtLeast(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []int
+		ok      bool
+	}{
+		{"8.0.36", []int{8, 0, 22}, true},
+		{"8.0.21", []int{8, 0, 22}, false},
+		{"5.7.44", []int{8}, false},
+		{"10.11.6", []int{10, 5, 1}, true},
+		{"16", []int{9, 6}, true},
+		{"9.6", []int{9, 6, 1}, false},
+		{"19.3.0.0.0", []int{18}, true},
+		{"", []int{99}, true},
+		{"devel", []int{12}, true},
+	}
+	for _, tt := range tests {
+		if got := (ServerInfo{Version: tt.version}).AtLeast(tt.want...); got != tt.ok {
+			t.Errorf("%q.AtLeast(%v) = %v, want %v", tt.version, tt.want, got, tt.ok)
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	caps := CapKill | CapExplain | CapTables
+	if !caps.Has(CapKill | CapTables) {
+		t.Error("Has(kill|tables) = false, want true")
+	}
+	if caps.Has(CapKill | CapLocks) {
+		t.Error("Has(kill|locks) = true, want false")
+	}
+	if got := caps.String(); got != "kill,explain,tables" {
+		t.Errorf("String() = %q, want %q", got, "kill,explain,tables")
+	}
+}
@@ -4,41 +4,239 @@ import "time"
 
 // DatabaseStats represents database statistics
 type DatabaseStats struct {
-	Timestamp         time.Time
-	ActiveConnections int64
-	TotalConnections  int64
-	QueriesPerSecond  float64
-	SlowQueries       int64
-	Uptime            time.Duration
-	Threads           ThreadStats
-	Processes         []ProcessInfo
-	Tables            []TableInfo
+	Timestamp         time.Time       `json:"timestamp"`
+	ActiveConnections int64           `json:"active_connections"`
+	TotalConnections  int64           `json:"total_connections"`
+	QueriesPerSecond  float64         `json:"queries_per_second"`
+	SlowQueries       int64           `json:"slow_queries"`
+	Uptime            time.Duration   `json:"uptime_ns"`
+	Counters          Counters        `json:"counters"`
+	Rates             Rates           `json:"rates"`
+	Threads           ThreadStats     `json:"threads"`
+	Processes         []ProcessInfo   `json:"processes"`
+	Tables            []TableInfo     `json:"tables"`
+	Locks             []LockWait      `json:"locks"`
+	Replication       *Replication    `json:"replication,omitempty"`
+	Statements        []Statement     `json:"statements,omitempty"`
+	StatementsSource  string          `json:"statements_source,omitempty"`  // view the statement statistics come from
+	StatementsMessage string          `json:"statements_message,omitempty"` // why statement statistics are unavailable
+	WaitEvents        []WaitEvent     `json:"wait_events,omitempty"`
+	ActiveSessions    []ActiveSession `json:"active_sessions,omitempty"`
+	SessionGroups     []SessionGroup  `json:"session_groups,omitempty"`
+	Warnings          []string        `json:"warnings,omitempty"` // optional parts that could not be collected
+}
+
+// Counters represents cumulative server counters as reported by the driver.
+// Counters that an engine does not expose are left at zero.
+type Counters struct {
+	Queries      int64 `json:"queries"`
+	Selects      int64 `json:"selects"`
+	Inserts      int64 `json:"inserts"`
+	Updates      int64 `json:"updates"`
+	Deletes      int64 `json:"deletes"`
+	Commits      int64 `json:"commits"`
+	Rollbacks    int64 `json:"rollbacks"`
+	SlowQueries  int64 `json:"slow_queries"`
+	RowsRead     int64 `json:"rows_read"`
+	RowsInserted int64 `json:"rows_inserted"`
+	RowsUpdated  int64 `json:"rows_updated"`
+	RowsDeleted  int64 `json:"rows_deleted"`
+}
+
+// Rates represents per-second rates derived from two successive Counters samples
+type Rates struct {
+	Queries      float64 `json:"queries"`
+	Selects      float64 `json:"selects"`
+	Inserts      float64 `json:"inserts"`
+	Updates      float64 `json:"updates"`
+	Deletes      float64 `json:"deletes"`
+	Commits      float64 `json:"commits"`
+	Rollbacks    float64 `json:"rollbacks"`
+	SlowQueries  float64 `json:"slow_queries"`
+	RowsRead     float64 `json:"rows_read"`
+	RowsInserted float64 `json:"rows_inserted"`
+	RowsUpdated  float64 `json:"rows_updated"`
+	RowsDeleted  float64 `json:"rows_deleted"`
 }
 
 // ThreadStats represents thread-related statistics
 type ThreadStats struct {
-	Running   int64
-	Connected int64
-	Sleeping  int64
-	Locked    int64
+	Running   int64 `json:"running"`
+	Connected int64 `json:"connected"`
+	Sleeping  int64 `json:"sleeping"`
+	Locked    int64 `json:"locked"`
 }
 
 // ProcessInfo represents information about a database process
 type ProcessInfo struct {
-	ID       int64
-	User     string
-	Host     string
-	Database string
-	Command  string
-	Time     int64
-	State    string
-	Info     string
+	ID       int64  `json:"id"`
+	Serial   int64  `json:"serial,omitempty"` // Oracle serial#, needed to kill a session
+	User     string `json:"user"`
+	Host     string `json:"host"`
+	Database string `json:"database"`
+	Command  string `json:"command"`
+	Time     int64  `json:"time"`
+	State    string `json:"state"`
+	Info     string `json:"info"`
+	SQLID    string `json:"sql_id,omitempty"` // Oracle sql_id of the current statement
+
+	// PostgreSQL session details
+	WaitEventType   string `json:"wait_event_type,omitempty"`
+	WaitEvent       string `json:"wait_event,omitempty"`
+	BackendType     string `json:"backend_type,omitempty"`
+	TransactionTime int64  `json:"transaction_time,omitempty"` // seconds since the transaction started
+	BackendXID      string `json:"backend_xid,omitempty"`
+	BackendXmin     string `json:"backend_xmin,omitempty"`
+}
+
+// SessionGroup represents the number of sessions sharing a backend type,
+// state, and wait event
+type SessionGroup struct {
+	BackendType   string `json:"backend_type"`
+	State         string `json:"state"`
+	WaitEventType string `json:"wait_event_type"`
+	WaitEvent     string `json:"wait_event"`
+	Count         int64  `json:"count"`
+}
+
+// LockWait represents a session waiting for a lock held by another session
+type LockWait struct {
+	WaitingID  int64  `json:"waiting_id"`
+	BlockingID int64  `json:"blocking_id"`
+	WaitTime   int64  `json:"wait_time"` // seconds
+	LockType   string `json:"lock_type"`
+	Object     string `json:"object"`
+}
+
+// Replication represents the replication state of the server, both as a
+// replica of another server and as a source for its own replicas. It is nil
+// when the server takes no part in replication.
+type Replication struct {
+	Role     string               `json:"role"`
+	Lag      float64              `json:"lag_seconds"` // highest known lag of any channel or replica
+	LagKnown bool                 `json:"lag_known"`
+	Channels []ReplicationChannel `json:"channels,omitempty"`
+	Replicas []ReplicaInfo        `json:"replicas,omitempty"`
+	Slots    []ReplicationSlot    `json:"slots,omitempty"`
+}
+
+// ReplicationChannel represents a stream the server replicates from
+type ReplicationChannel struct {
+	Name         string  `json:"name"`
+	Source       string  `json:"source"`
+	IOState      string  `json:"io_state"`  // state of the receiving side
+	SQLState     string  `json:"sql_state"` // state of the applying side
+	Lag          float64 `json:"lag_seconds"`
+	LagKnown     bool    `json:"lag_known"`
+	ReceivedGTID string  `json:"received_gtid,omitempty"`
+	ExecutedGTID string  `json:"executed_gtid,omitempty"`
+	LastError    string  `json:"last_error,omitempty"`
+}
+
+// ReplicaInfo represents a replica connected to the server. The lags are
+// unknown while the replica is idle, or when the server does not report
+// them.
+type ReplicaInfo struct {
+	Name           string  `json:"name"`
+	Client         string  `json:"client"`
+	State          string  `json:"state"`
+	SyncState      string  `json:"sync_state"`
+	WriteLag       float64 `json:"write_lag_seconds"`
+	WriteLagKnown  bool    `json:"write_lag_known"`
+	FlushLag       float64 `json:"flush_lag_seconds"`
+	FlushLagKnown  bool    `json:"flush_lag_known"`
+	ReplayLag      float64 `json:"replay_lag_seconds"`
+	ReplayLagKnown bool    `json:"replay_lag_known"`
+	LagBytes       int64   `json:"lag_bytes"`
+}
+
+// ReplicationSlot represents a replication slot and the WAL it retains
+type ReplicationSlot struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Active      bool   `json:"active"`
+	RetainedWAL int64  `json:"retained_wal_bytes"`
+}
+
+// Statement represents the statistics of a normalized statement. Total
+// holds the cumulative values reported by the server; Delta holds the
+// increase since the previous snapshot and is filled in by the monitor.
+type Statement struct {
+	ID       string            `json:"id"`
+	Database string            `json:"database"`
+	Query    string            `json:"query"`
+	Total    StatementCounters `json:"total"`
+	Delta    StatementCounters `json:"delta"`
+}
+
+// StatementCounters represents the counters of a normalized statement.
+// Counters that an engine does not expose are left at zero.
+type StatementCounters struct {
+	Calls        int64   `json:"calls"`
+	Time         float64 `json:"time_ms"`
+	Rows         int64   `json:"rows"`
+	RowsExamined int64   `json:"rows_examined"`
+	NoIndexUsed  int64   `json:"no_index_used"`
+	BlocksHit    int64   `json:"blocks_hit"`
+	BlocksRead   int64   `json:"blocks_read"`
+}
+
+// Sub returns the difference between c and other
+func (c StatementCounters) Sub(other StatementCounters) StatementCounters {
+	return StatementCounters{
+		Calls:        c.Calls - other.Calls,
+		Time:         c.Time - other.Time,
+		Rows:         c.Rows - other.Rows,
+		RowsExamined: c.RowsExamined - other.RowsExamined,
+		NoIndexUsed:  c.NoIndexUsed - other.NoIndexUsed,
+		BlocksHit:    c.BlocksHit - other.BlocksHit,
+		BlocksRead:   c.BlocksRead - other.BlocksRead,
+	}
+}
+
+// WaitEvent represents the time the server spent waiting on an event.
+// Total holds the cumulative values reported by the server; Delta holds
+// the increase since the previous snapshot and is filled in by the monitor.
+type WaitEvent struct {
+	Event     string       `json:"event"`
+	WaitClass string       `json:"wait_class"`
+	Total     WaitCounters `json:"total"`
+	Delta     WaitCounters `json:"delta"`
+}
+
+// WaitCounters represents the counters of a wait event
+type WaitCounters struct {
+	Waits int64   `json:"waits"`
+	Time  float64 `json:"time_ms"`
+}
+
+// ActiveSession represents a session sampled while it was active, either
+// on CPU or waiting on an event
+type ActiveSession struct {
+	ID        int64  `json:"id"`
+	Event     string `json:"event"`
+	WaitClass string `json:"wait_class"`
+	SQLID     string `json:"sql_id,omitempty"`
 }
 
 // TableInfo represents information about database tables
 type TableInfo struct {
-	Name      string
-	Rows      int64
-	DataSize  int64
-	IndexSize int64
+	Name      string `json:"name"`
+	Rows      int64  `json:"rows"`
+	DataSize  int64  `json:"data_size"`
+	IndexSize int64  `json:"index_size"`
+}
+
+// QueryPlan represents an execution plan returned by a driver. Engines that
+// produce a structured plan fill Nodes; engines that return preformatted
+// output fill Text.
+type QueryPlan struct {
+	Nodes []*PlanNode `json:"nodes,omitempty"`
+	Text  []string    `json:"text,omitempty"`
+}
+
+// PlanNode represents a step of an execution plan
+type PlanNode struct {
+	Label    string      `json:"label"`
+	Children []*PlanNode `json:"children,omitempty"`
 }
@@ -0,0 +1,127 @@
+// Package recording stores snapshots of an instance on disk so that a
+// monitoring session can be replayed later.
+//
+// A recording is a gzip stream of JSON lines, one Record per line. Every
+// recording session appends a new gzip member to the file, and the writer
+// flushes after each record so that a recording cut short by a crash is
+// still readable up to the last complete snapshot, including when later
+// sessions were appended after the unfinished member.
+package recording
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"dbtop/monitor/stats"
+)
+
+// Record is a single recorded snapshot
+type Record struct {
+	Instance string               `json:"instance"`
+	Type     string               `json:"type"`
+	Stats    *stats.DatabaseStats `json:"stats"`
+}
+
+// Writer appends records to a recording file
+type Writer struct {
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+// Create opens the recording at path for appending, creating it if needed
+func Create(path string) (*Writer, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+
+	gz := gzip.NewWriter(file)
+	return &Writer{file: file, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+// Write appends a record and flushes it to disk
+func (w *Writer) Write(record Record) error {
+	if err := w.enc.Encode(record); err != nil {
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+	if err := w.gz.Flush(); err != nil {
+		return fmt.Errorf("failed to flush recording: %w", err)
+	}
+	return nil
+}
+
+// Close finishes the gzip member and closes the file
+func (w *Writer) Close() error {
+	if err := w.gz.Close(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("failed to finish recording: %w", err)
+	}
+	return w.file.Close()
+}
+
+// gzipHeader starts every gzip member: the magic number and deflate
+var gzipHeader = []byte{0x1f, 0x8b, 8}
+
+// Load reads all records of a recording. A member left unfinished by an
+// interrupted recorder yields the records written before the crash, and
+// reading resumes at the next member.
+func Load(path string) ([]Record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	if len(data) > 0 && !bytes.HasPrefix(data, gzipHeader) {
+		return nil, errors.New("failed to read recording: not a gzip file")
+	}
+
+	var records []Record
+	for offset := 0; offset < len(data); {
+		reader := bytes.NewReader(data[offset:])
+		if err := readMember(reader, &records); err == nil {
+			offset = len(data) - reader.Len()
+			continue
+		}
+		next := bytes.Index(data[offset+1:], gzipHeader)
+		if next < 0 {
+			break
+		}
+		offset += 1 + next
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("recording contains no snapshots")
+	}
+	return records, nil
+}
+
+// readMember appends the records of the gzip member at the start of r. It
+// reads no further than the end of the member and fails if the member is
+// cut short or corrupt, keeping the records decoded until then.
+func readMember(r *bytes.Reader, records *[]Record) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	gz.Multistream(false)
+
+	decoder := json.NewDecoder(gz)
+	for {
+		var record Record
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if record.Stats != nil {
+			*records = append(*records, record)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package recording
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dbtop/monitor/stats"
+)
+
+func TestAppendAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.dbtop")
+	start := time.Date(2024, 5, 1, 3, 12, 0, 0, time.UTC)
+
+	// Two recording sessions appended to the same file
+	for session := 0; session < 2; session++ {
+		w, err := Create(path)
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			err := w.Write(Record{
+				Instance: "prod",
+				Type:     "mysql",
+				Stats: &stats.DatabaseStats{
+					Timestamp:         start.Add(time.Duration(session*3+i) * time.Second),
+					ActiveConnections: int64(session*3 + i),
+				},
+			})
+			if err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+
+	records, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(records) != 6 {
+		t.Fatalf("Load returned %d records, want 6", len(records))
+	}
+	for i, record := range records {
+		if record.Instance != "prod" || record.Stats.ActiveConnections != int64(i) {
+			t.Errorf("record %d = %+v", i, record)
+		}
+		if !record.Stats.Timestamp.Equal(start.Add(time.Duration(i) * time.Second)) {
+			t.Errorf("record %d timestamp = %v", i, record.Stats.Timestamp)
+		}
+	}
+}
+
+func TestLoadTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crash.dbtop")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := w.Write(Record{Instance: "prod", Stats: &stats.DatabaseStats{ActiveConnections: int64(i)}}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	// Simulate a crash: the gzip member is never finished
+	w.file.Close()
+
+	records, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("Load returned %d records, want 2", len(records))
+	}
+
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load succeeded on an empty file, want error")
+	}
+}
+
+func TestLoadAppendedAfterCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crash.dbtop")
+	write := func(w *Writer, connections int64) {
+		t.Helper()
+		if err := w.Write(Record{Instance: "prod", Stats: &stats.DatabaseStats{ActiveConnections: connections}}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	// A recorder that is killed without Close in the middle of a record,
+	// followed by one that appends to the same file and finishes normally
+	crashed, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	write(crashed, 0)
+	write(crashed, 1)
+	crashed.gz.Write([]byte(`{"instance":"prod","sta`))
+	crashed.gz.Flush()
+	crashed.file.Close()
+
+	appended, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	write(appended, 2)
+	write(appended, 3)
+	if err := appended.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	records, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Load returned %d records, want 4", len(records))
+	}
+	for i, record := range records {
+		if record.Stats.ActiveConnections != int64(i) {
+			t.Errorf("record %d has %d active connections", i, record.Stats.ActiveConnections)
+		}
+	}
+}
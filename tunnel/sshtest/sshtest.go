@@ -0,0 +1,176 @@
+// Package sshtest runs SSH servers in-process for testing connections
+// through tunnels.
+package sshtest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Server is an SSH server that only allows port forwarding
+type Server struct {
+	Addr    string
+	HostKey ssh.PublicKey
+
+	mu        sync.Mutex
+	forwarded []string
+}
+
+// ClientKey generates a client key and writes it to a file. It returns the
+// path of the file and the public key to authorize.
+func ClientKey(t testing.TB) (string, ssh.PublicKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(private, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, key
+}
+
+// NewServer starts a server on a local port that accepts the given client
+// key. It is stopped when the test ends.
+func NewServer(t testing.TB, clientKey ssh.PublicKey) *Server {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, fmt.Errorf("unknown public key")
+			}
+			return nil, nil
+		},
+	}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &Server{Addr: listener.Addr().String(), HostKey: signer.PublicKey()}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, serverConfig)
+		}
+	}()
+	return s
+}
+
+// Forwarded returns the addresses that connections were forwarded to
+func (s *Server) Forwarded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.forwarded...)
+}
+
+// serve handles one SSH connection
+func (s *Server) serve(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	defer conn.Close()
+	server, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		return
+	}
+	defer server.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "only port forwarding is allowed")
+			continue
+		}
+		var target struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, "invalid forwarding request")
+			continue
+		}
+		go s.forward(newChannel, net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	}
+}
+
+// forward connects a forwarding channel to addr
+func (s *Server) forward(newChannel ssh.NewChannel, addr string) {
+	s.mu.Lock()
+	s.forwarded = append(s.forwarded, addr)
+	s.mu.Unlock()
+
+	remote, err := net.Dial("tcp", addr)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer remote.Close()
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(reqs)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, channel)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(channel, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// KnownHosts writes a known_hosts file with the host keys of the servers
+// and returns its path
+func KnownHosts(t testing.TB, servers ...*Server) string {
+	t.Helper()
+	var lines string
+	for _, s := range servers {
+		lines += knownhosts.Line([]string{s.Addr}, s.HostKey) + "\n"
+	}
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(path, []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
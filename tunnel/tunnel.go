@@ -0,0 +1,283 @@
+// Package tunnel connects to databases through SSH, optionally via a chain
+// of jump hosts.
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dbtop/config"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// dialTimeout bounds connecting to each SSH host
+const dialTimeout = 10 * time.Second
+
+// Tunnel is an SSH connection that database connections are dialed
+// through
+type Tunnel struct {
+	// clients holds the connection to each hop, the target host last
+	clients []*ssh.Client
+	agent   net.Conn
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	closed    bool
+}
+
+// hop is one SSH host on the way to the target
+type hop struct {
+	user string
+	addr string
+}
+
+// parseHop parses [user@]host[:port], filling in the defaults
+func parseHop(spec, defaultUser string) (hop, error) {
+	h := hop{user: defaultUser}
+	if user, host, ok := strings.Cut(spec, "@"); ok {
+		h.user, spec = user, host
+	}
+	if spec == "" {
+		return hop{}, errors.New("missing host")
+	}
+	if _, _, err := net.SplitHostPort(spec); err != nil {
+		spec = net.JoinHostPort(spec, "22")
+	}
+	h.addr = spec
+	return h, nil
+}
+
+// hops returns the jump hosts and then the target host of cfg
+func hops(cfg config.SSHConfig) ([]hop, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("ssh.host is not set")
+	}
+	if cfg.User == "" {
+		return nil, errors.New("ssh.user is not set")
+	}
+
+	var result []hop
+	for _, spec := range cfg.Jump {
+		h, err := parseHop(spec, cfg.User)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jump host '%s': %w", spec, err)
+		}
+		result = append(result, h)
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 22
+	}
+	return append(result, hop{user: cfg.User, addr: net.JoinHostPort(cfg.Host, strconv.Itoa(port))}), nil
+}
+
+// Open connects to the SSH host of cfg through its jump hosts. The host
+// keys are checked against the known_hosts file. Connecting stops when ctx
+// is done.
+func Open(ctx context.Context, cfg config.SSHConfig) (*Tunnel, error) {
+	route, err := hops(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tunnel{}
+	auth, err := t.authMethods(cfg)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+
+	knownHosts := cfg.KnownHosts
+	if knownHosts == "" {
+		knownHosts = "~/.ssh/known_hosts"
+	}
+	if knownHosts, err = config.ExpandHome(knownHosts); err != nil {
+		t.Close()
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(knownHosts)
+	if err != nil {
+		t.Close()
+		return nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	for _, h := range route {
+		clientConfig := &ssh.ClientConfig{
+			User:            h.user,
+			Auth:            auth,
+			HostKeyCallback: hostKeys,
+		}
+		client, err := t.dialHop(ctx, h.addr, clientConfig)
+		if err != nil {
+			t.Close()
+			return nil, fmt.Errorf("failed to connect to SSH host %s: %w", h.addr, err)
+		}
+		t.clients = append(t.clients, client)
+	}
+	return t, nil
+}
+
+// authMethods returns the ways of authenticating configured in cfg
+func (t *Tunnel) authMethods(cfg config.SSHConfig) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	if cfg.KeyFile != "" {
+		path, err := config.ExpandHome(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			var missing *ssh.PassphraseMissingError
+			if errors.As(err, &missing) {
+				return nil, fmt.Errorf("SSH key %s is encrypted; load it into ssh-agent and set ssh.agent instead", cfg.KeyFile)
+			}
+			return nil, fmt.Errorf("failed to parse SSH key: %w", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if cfg.Agent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, errors.New("ssh.agent is set but SSH_AUTH_SOCK is not")
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to SSH agent: %w", err)
+		}
+		t.agent = conn
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("ssh needs key_file or agent")
+	}
+	return methods, nil
+}
+
+// dialHop opens an SSH connection to addr, through the last hop if there
+// is one. The SSH handshake does not take a context, so the connection is
+// closed to interrupt it when ctx is done.
+func (t *Tunnel) dialHop(ctx context.Context, addr string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if len(t.clients) == 0 {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = t.clients[len(t.clients)-1].DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if !stop() {
+		if err == nil {
+			c.Close()
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// DialContext connects to addr from the SSH host. Its signature matches
+// the custom dialers of the database drivers.
+func (t *Tunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client := t.clients[len(t.clients)-1]
+	return client.DialContext(ctx, network, addr)
+}
+
+// Forward listens on a local port and forwards each connection to addr
+// through the tunnel. It returns the local address to connect to.
+func (t *Tunnel) Forward(addr string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return "", errors.New("tunnel is closed")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to listen for forwarded connections: %w", err)
+	}
+	t.listeners = append(t.listeners, listener)
+
+	go func() {
+		for {
+			local, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go t.forward(local, addr)
+		}
+	}()
+	return listener.Addr().String(), nil
+}
+
+// forward copies data between a local connection and addr until either
+// side closes
+func (t *Tunnel) forward(local net.Conn, addr string) {
+	defer local.Close()
+	remote, err := t.DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// Close stops forwarding and closes the SSH connections
+func (t *Tunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+
+	for _, listener := range t.listeners {
+		listener.Close()
+	}
+	var err error
+	for i := len(t.clients) - 1; i >= 0; i-- {
+		if closeErr := t.clients[i].Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	if t.agent != nil {
+		t.agent.Close()
+	}
+	return err
+}
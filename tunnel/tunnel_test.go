@@ -0,0 +1,229 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"dbtop/config"
+	"dbtop/tunnel/sshtest"
+)
+
+// echoServer starts a TCP server that echoes what it receives
+func echoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// checkEcho sends a line over conn and expects it back
+func checkEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	reply := make([]byte, 5)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping\n" {
+		t.Fatalf("read %q, %v; want the echo", reply, err)
+	}
+}
+
+// sshConfig returns the settings for connecting to server
+func sshConfig(t *testing.T, server *sshtest.Server, keyFile, knownHosts string) config.SSHConfig {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(server.Addr)
+	portNumber, _ := strconv.Atoi(port)
+	return config.SSHConfig{Host: host, Port: portNumber, User: "dbtop", KeyFile: keyFile, KnownHosts: knownHosts}
+}
+
+func TestTunnel(t *testing.T) {
+	target := echoServer(t)
+	keyFile, clientKey := sshtest.ClientKey(t)
+	server := sshtest.NewServer(t, clientKey)
+
+	tunnel, err := Open(context.Background(), sshConfig(t, server, keyFile, sshtest.KnownHosts(t, server)))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	conn, err := tunnel.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatalf("DialContext failed: %v", err)
+	}
+	checkEcho(t, conn)
+
+	local, err := tunnel.Forward(target)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	conn, err = net.Dial("tcp", local)
+	if err != nil {
+		t.Fatalf("failed to connect to the forwarded port: %v", err)
+	}
+	checkEcho(t, conn)
+
+	if got := server.Forwarded(); !reflect.DeepEqual(got, []string{target, target}) {
+		t.Errorf("forwarded to %v, want %s twice", got, target)
+	}
+
+	if err := tunnel.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if _, err := net.Dial("tcp", local); err == nil {
+		t.Error("the forwarded port is still open after Close")
+	}
+	if _, err := tunnel.Forward(target); err == nil {
+		t.Error("Forward succeeded after Close")
+	}
+}
+
+func TestTunnelJumpHosts(t *testing.T) {
+	target := echoServer(t)
+	keyFile, clientKey := sshtest.ClientKey(t)
+	bastion := sshtest.NewServer(t, clientKey)
+	server := sshtest.NewServer(t, clientKey)
+
+	cfg := sshConfig(t, server, keyFile, sshtest.KnownHosts(t, bastion, server))
+	cfg.Jump = []string{"jump@" + bastion.Addr}
+	tunnel, err := Open(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer tunnel.Close()
+
+	conn, err := tunnel.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatalf("DialContext failed: %v", err)
+	}
+	checkEcho(t, conn)
+
+	if got := bastion.Forwarded(); !reflect.DeepEqual(got, []string{server.Addr}) {
+		t.Errorf("bastion forwarded to %v, want %s", got, server.Addr)
+	}
+	if got := server.Forwarded(); !reflect.DeepEqual(got, []string{target}) {
+		t.Errorf("server forwarded to %v, want %s", got, target)
+	}
+}
+
+func TestOpenContext(t *testing.T) {
+	// The host behind the bastion accepts connections but never answers
+	// the SSH handshake, so only the context stops Open
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	keyFile, clientKey := sshtest.ClientKey(t)
+	bastion := sshtest.NewServer(t, clientKey)
+	cfg := sshConfig(t, &sshtest.Server{Addr: silent.Addr().String()}, keyFile, sshtest.KnownHosts(t, bastion))
+	cfg.Jump = []string{"jump@" + bastion.Addr}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = Open(ctx, cfg)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Open error = %v, want the context deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > dialTimeout/2 {
+		t.Errorf("Open took %v after the context ended", elapsed)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	keyFile, clientKey := sshtest.ClientKey(t)
+	server := sshtest.NewServer(t, clientKey)
+	_, otherKey := sshtest.ClientKey(t)
+	other := sshtest.NewServer(t, otherKey)
+
+	tests := []struct {
+		name string
+		cfg  config.SSHConfig
+		want string
+	}{
+		{
+			name: "unknown host key",
+			cfg:  sshConfig(t, server, keyFile, sshtest.KnownHosts(t)),
+			want: "key is unknown",
+		},
+		{
+			name: "changed host key",
+			cfg:  sshConfig(t, server, keyFile, sshtest.KnownHosts(t, &sshtest.Server{Addr: server.Addr, HostKey: other.HostKey})),
+			want: "key mismatch",
+		},
+		{
+			name: "key not authorized",
+			cfg:  sshConfig(t, other, keyFile, sshtest.KnownHosts(t, other)),
+			want: "unable to authenticate",
+		},
+		{
+			name: "no authentication",
+			cfg:  config.SSHConfig{Host: "bastion", User: "dbtop"},
+			want: "ssh needs key_file or agent",
+		},
+		{
+			name: "no user",
+			cfg:  config.SSHConfig{Host: "bastion", KeyFile: keyFile},
+			want: "ssh.user is not set",
+		},
+	}
+	for _, tt := range tests {
+		_, err := Open(context.Background(), tt.cfg)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Open error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseHop(t *testing.T) {
+	tests := []struct {
+		spec string
+		want hop
+	}{
+		{"bastion", hop{user: "dbtop", addr: "bastion:22"}},
+		{"admin@bastion:2222", hop{user: "admin", addr: "bastion:2222"}},
+		{"[2001:db8::1]:2222", hop{user: "dbtop", addr: "[2001:db8::1]:2222"}},
+	}
+	for _, tt := range tests {
+		got, err := parseHop(tt.spec, "dbtop")
+		if err != nil || got != tt.want {
+			t.Errorf("parseHop(%q) = %+v, %v; want %+v", tt.spec, got, err, tt.want)
+		}
+	}
+	if _, err := parseHop("admin@", "dbtop"); err == nil {
+		t.Error("parseHop accepted a spec without a host")
+	}
+}
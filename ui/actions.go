@@ -0,0 +1,155 @@
+package ui
+
+import (
+	"fmt"
+
+	"dbtop/monitor/stats"
+
+	"github.com/gizak/termui/v3"
+)
+
+// ProcessAction represents an operation on a single process
+type ProcessAction int
+
+const (
+	ActionKill ProcessAction = iota
+	ActionCancel
+)
+
+// ProcessHandler carries out a process action against the database
+type ProcessHandler func(action ProcessAction, process stats.ProcessInfo) error
+
+// pendingAction is a process action waiting for confirmation
+type pendingAction struct {
+	action  ProcessAction
+	process stats.ProcessInfo
+}
+
+// describe returns a short description of the action for prompts
+func (p *pendingAction) describe() string {
+	verb := "Kill connection"
+	if p.action == ActionCancel {
+		verb = "Cancel query of"
+	}
+	return fmt.Sprintf("%s %d (%s@%s)", verb, p.process.ID, p.process.User, p.process.Host)
+}
+
+// SetProcessHandler sets the function that carries out kill and cancel
+// requests. Without a handler the actions are unavailable.
+func (ui *UI) SetProcessHandler(handler ProcessHandler) {
+	ui.processHandler = handler
+}
+
+// Modal reports whether a prompt or pane is open that handles Escape itself
+func (ui *UI) Modal() bool {
+	return ui.pending != nil || ui.detailProcess != nil
+}
+
+// selectedProcess returns the process under the cursor, if any
+func (ui *UI) selectedProcess() (stats.ProcessInfo, bool) {
+	row := ui.processList.SelectedRow
+	if row < 0 || row >= len(ui.visibleProcesses) {
+		return stats.ProcessInfo{}, false
+	}
+	return ui.visibleProcesses[row], true
+}
+
+// moveSelection moves the process cursor and remembers the process it
+// lands on so the cursor follows it across refreshes and re-sorting
+func (ui *UI) moveSelection(key string) {
+	if len(ui.processList.Rows) == 0 {
+		return
+	}
+	switch key {
+	case "<Up>":
+		ui.processList.ScrollUp()
+	case "<Down>":
+		ui.processList.ScrollDown()
+	case "<PageUp>":
+		ui.processList.ScrollPageUp()
+	case "<PageDown>":
+		ui.processList.ScrollPageDown()
+	case "<Home>":
+		ui.processList.ScrollTop()
+	case "<End>":
+		ui.processList.ScrollBottom()
+	}
+	if process, ok := ui.selectedProcess(); ok {
+		ui.selectedID = process.ID
+	}
+}
+
+// restoreSelection puts the cursor back on the previously selected process
+func (ui *UI) restoreSelection() {
+	for i, process := range ui.visibleProcesses {
+		if process.ID == ui.selectedID {
+			ui.processList.SelectedRow = i
+			return
+		}
+	}
+	if ui.processList.SelectedRow >= len(ui.visibleProcesses) {
+		ui.processList.SelectedRow = max(len(ui.visibleProcesses)-1, 0)
+	}
+	if process, ok := ui.selectedProcess(); ok {
+		ui.selectedID = process.ID
+	}
+}
+
+// requestAction asks for confirmation before acting on the selected process
+func (ui *UI) requestAction(action ProcessAction) {
+	process, ok := ui.selectedProcess()
+	if !ok {
+		ui.status = "No process selected"
+		return
+	}
+	ui.confirmAction(action, process)
+}
+
+// confirmAction asks for confirmation before acting on a process
+func (ui *UI) confirmAction(action ProcessAction, process stats.ProcessInfo) {
+	if ui.processHandler == nil {
+		ui.status = "Process actions are not available here"
+		return
+	}
+	capability := stats.CapKill
+	if action == ActionCancel {
+		capability = stats.CapCancel
+	}
+	if !ui.supports(capability) {
+		return
+	}
+	ui.pending = &pendingAction{action: action, process: process}
+}
+
+// handleConfirmation runs or discards the pending action
+func (ui *UI) handleConfirmation(key string) {
+	pending := ui.pending
+	ui.pending = nil
+
+	if key != "y" && key != "Y" {
+		ui.status = pending.describe() + ": aborted"
+		return
+	}
+
+	if err := ui.processHandler(pending.action, pending.process); err != nil {
+		ui.status = fmt.Sprintf("%s: %v", pending.describe(), err)
+		return
+	}
+	ui.status = pending.describe() + ": done"
+}
+
+// renderHelp shows the confirmation prompt, the last status message, or
+// the list of controls
+func (ui *UI) renderHelp() {
+	switch {
+	case ui.pending != nil:
+		ui.helpBox.Text = ui.pending.describe() + "? [y/N]"
+		ui.helpBox.TextStyle = termui.NewStyle(termui.ColorRed, termui.ColorClear, termui.ModifierBold)
+	case ui.status != "":
+		ui.helpBox.Text = ui.status
+		ui.helpBox.TextStyle = termui.NewStyle(termui.ColorYellow)
+	default:
+		ui.helpBox.Text = ui.helpText()
+		ui.helpBox.TextStyle = termui.NewStyle(termui.ColorWhite)
+	}
+}
@@ -0,0 +1,73 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"dbtop/alerts"
+
+	"github.com/gizak/termui/v3"
+)
+
+// statFields are the alert rule fields shown in the stats table, by row
+// label
+var statFields = map[string]string{
+	"Total Connections": "total_connections",
+	"Queries/Second":    "queries_per_second",
+	"Slow Queries":      "slow_queries",
+	"Threads Running":   "threads_running",
+	"Threads Connected": "threads_connected",
+	"Threads Sleeping":  "threads_sleeping",
+	"Threads Locked":    "threads_locked",
+}
+
+// markupEscaper replaces brackets in text that would otherwise be parsed
+// as termui markup
+var markupEscaper = strings.NewReplacer("[", "(", "]", ")")
+
+// breachStyle highlights rows that breach an alert rule
+var breachStyle = termui.NewStyle(termui.ColorRed, termui.ColorClear, termui.ModifierBold)
+
+// SetAlertStatus sets the breaching processes and metrics and the firing
+// alerts shown with the next update
+func (ui *UI) SetAlertStatus(status alerts.Status) {
+	ui.alertStatus = status
+}
+
+// highlight marks text that breaches an alert rule
+func highlight(text string, breaching bool) string {
+	if !breaching {
+		return text
+	}
+	return "[" + text + "](fg:red,mod:bold)"
+}
+
+// highlightStats colors the stats table rows of breaching metrics
+func (ui *UI) highlightStats() {
+	ui.statsTable.RowStyles = make(map[int]termui.Style)
+	for i, row := range ui.statsTable.Rows {
+		if field, ok := statFields[row[0]]; ok && ui.alertStatus.Fields[field] {
+			ui.statsTable.RowStyles[i] = breachStyle
+		}
+	}
+}
+
+// alertsSummary returns a line for the info box naming the firing alerts
+func alertsSummary(firing []alerts.Alert) string {
+	if len(firing) == 0 {
+		return ""
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, alert := range firing {
+		if !seen[alert.Rule] {
+			seen[alert.Rule] = true
+			names = append(names, alert.Rule)
+		}
+	}
+	// The rule names may contain brackets, which would break the markup
+	summary := fmt.Sprintf("Alerts: %d firing (%s)", len(firing), strings.Join(names, ", "))
+	summary = markupEscaper.Replace(summary)
+	return highlight(summary, true)
+}
@@ -0,0 +1,88 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+)
+
+// ConnectionState describes the connection to a monitored instance
+type ConnectionState int
+
+const (
+	// StateConnected means the last collection succeeded
+	StateConnected ConnectionState = iota
+	// StateDegraded means the last collection failed but the server still
+	// answers, e.g. because a query timed out
+	StateDegraded
+	// StateReconnecting means the connection was lost and is being
+	// re-established with increasing delays
+	StateReconnecting
+	// StateFailed means reconnecting keeps failing and is retried at the
+	// longest delay
+	StateFailed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateDegraded:
+		return "degraded"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnectionStatus is the connection state of an instance with the details
+// of the last failure
+type ConnectionStatus struct {
+	State     ConnectionState
+	Attempts  int       // Failed reconnect attempts in a row
+	NextRetry time.Time // When the next reconnect attempt is made
+	Err       error     // Why the instance is not connected
+}
+
+// Summary describes the status in one line
+func (s ConnectionStatus) Summary(now time.Time) string {
+	summary := s.State.String()
+	if s.State < StateReconnecting || s.Attempts == 0 {
+		return summary
+	}
+	summary += fmt.Sprintf(" (attempt %d", s.Attempts)
+	if wait := s.NextRetry.Sub(now).Round(time.Second); wait > 0 {
+		summary += fmt.Sprintf(", next in %s", wait)
+	}
+	return summary + ")"
+}
+
+// SetConnectionStatus sets the connection state shown in the info box
+func (ui *UI) SetConnectionStatus(status ConnectionStatus) {
+	ui.connection = &status
+}
+
+// connectionSummary returns the info box lines with the connection state
+// and the number of logged errors
+func (ui *UI) connectionSummary() string {
+	if ui.connection == nil {
+		return ""
+	}
+	line := "Connection: " + ui.connection.Summary(time.Now())
+	switch ui.connection.State {
+	case StateConnected:
+	case StateDegraded:
+		line = "[" + line + "](fg:yellow,mod:bold)"
+	default:
+		line = "[" + line + "](fg:red,mod:bold)"
+	}
+
+	if ui.errorLog != nil {
+		if count := ui.errorLog.Len(); count > 0 {
+			line += fmt.Sprintf("\nErrors: %d (E to show)", count)
+		}
+	}
+	return line
+}
@@ -0,0 +1,103 @@
+package ui
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// ErrorLogSize is the number of entries kept in an error log
+const ErrorLogSize = 200
+
+// ErrorEntry is one message in the error log. Repeats of the same message
+// in a row are counted instead of added again.
+type ErrorEntry struct {
+	Time    time.Time // When the message was last logged
+	Message string
+	Count   int
+}
+
+// ErrorLog keeps the most recent errors for the error log view. It is safe
+// for concurrent use, so background work such as alert notifiers can log
+// to it.
+type ErrorLog struct {
+	mu      sync.Mutex
+	size    int
+	entries []ErrorEntry
+}
+
+// NewErrorLog creates an error log that keeps the last size entries
+func NewErrorLog(size int) *ErrorLog {
+	return &ErrorLog{size: size}
+}
+
+// Add logs an error
+func (l *ErrorLog) Add(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	message := err.Error()
+	if n := len(l.entries); n > 0 && l.entries[n-1].Message == message {
+		l.entries[n-1].Time = time.Now()
+		l.entries[n-1].Count++
+		return
+	}
+	l.entries = append(l.entries, ErrorEntry{Time: time.Now(), Message: message, Count: 1})
+	if len(l.entries) > l.size {
+		l.entries = append(l.entries[:0], l.entries[len(l.entries)-l.size:]...)
+	}
+}
+
+// Entries returns the logged errors, oldest first
+func (l *ErrorLog) Entries() []ErrorEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]ErrorEntry(nil), l.entries...)
+}
+
+// Len returns the number of entries in the log
+func (l *ErrorLog) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// SetErrorLog sets the log shown in the error log view
+func (ui *UI) SetErrorLog(log *ErrorLog) {
+	ui.errorLog = log
+}
+
+// setupErrorsWidget initializes the error log view
+func (ui *UI) setupErrorsWidget() {
+	ui.errorsList = widgets.NewList()
+	ui.errorsList.Title = "Errors, newest first (Press 'E' for processes)"
+	ui.errorsList.TextStyle = termui.NewStyle(termui.ColorRed)
+	ui.errorsList.BorderStyle = termui.NewStyle(termui.ColorBlue)
+	ui.errorsList.WrapText = false
+}
+
+// renderErrors fills the error log view
+func (ui *UI) renderErrors() {
+	var entries []ErrorEntry
+	if ui.errorLog != nil {
+		entries = ui.errorLog.Entries()
+	}
+	if len(entries) == 0 {
+		ui.errorsList.Rows = []string{"No errors"}
+		return
+	}
+
+	rows := make([]string, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		row := entry.Time.Format("15:04:05") + " " + entry.Message
+		if entry.Count > 1 {
+			row += fmt.Sprintf(" (%d times)", entry.Count)
+		}
+		rows = append(rows, markupEscaper.Replace(row))
+	}
+	ui.errorsList.Rows = rows
+}
@@ -0,0 +1,151 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// historyCharts is the number of line charts in the history view
+const historyCharts = 4
+
+// historyColors are the colors of the charted metrics, in chart order
+var historyColors = []termui.Color{termui.ColorGreen, termui.ColorCyan, termui.ColorYellow, termui.ColorMagenta}
+
+// MetricHistory holds the recent values of a charted metric, oldest first.
+// Values that were unknown when sampled are NaN.
+type MetricHistory struct {
+	Name   string
+	Unit   string // "s" for durations in seconds, empty for plain numbers
+	Values []float64
+}
+
+// HistoryHandler returns the recent values of the charted metrics
+type HistoryHandler func() []MetricHistory
+
+// SetHistoryHandler sets the function that provides the metric history.
+// Without a handler the history charts stay empty.
+func (ui *UI) SetHistoryHandler(handler HistoryHandler) {
+	ui.historyHandler = handler
+}
+
+// setupHistoryWidgets initializes the sparklines next to the statistics
+// and the line charts of the history view
+func (ui *UI) setupHistoryWidgets() {
+	ui.sparklines = widgets.NewSparklineGroup(noHistory())
+	ui.sparklines.Title = "History (Press 'h' for charts)"
+	ui.sparklines.BorderStyle = termui.NewStyle(termui.ColorGreen)
+
+	for i := 0; i < historyCharts; i++ {
+		plot := widgets.NewPlot()
+		plot.BorderStyle = termui.NewStyle(termui.ColorBlue)
+		plot.LineColors = []termui.Color{historyColors[i%len(historyColors)]}
+		plot.Data = [][]float64{{0, 0}}
+		ui.historyPlots = append(ui.historyPlots, plot)
+	}
+}
+
+// noHistory returns a placeholder sparkline, as a sparkline group cannot
+// be drawn without one
+func noHistory() *widgets.Sparkline {
+	sparkline := widgets.NewSparkline()
+	sparkline.Title = "No history available"
+	sparkline.MaxVal = 1
+	return sparkline
+}
+
+// lastValues returns at most n of the most recent values, with unknown
+// values drawn as zero, and the highest of them
+func lastValues(values []float64, n int) ([]float64, float64) {
+	if n > 0 && len(values) > n {
+		values = values[len(values)-n:]
+	}
+	result := make([]float64, len(values))
+	peak := 0.0
+	for i, value := range values {
+		if !math.IsNaN(value) {
+			result[i] = value
+			peak = max(peak, value)
+		}
+	}
+	return result, peak
+}
+
+// formatMetric formats a charted value according to its unit
+func formatMetric(value float64, unit string) string {
+	switch {
+	case math.IsNaN(value):
+		return "unknown"
+	case unit == "s":
+		return formatLag(value, true)
+	case value == math.Trunc(value):
+		return fmt.Sprintf("%.0f", value)
+	default:
+		return fmt.Sprintf("%.2f", value)
+	}
+}
+
+// historyTitle describes the latest value of a metric and the highest
+// value shown
+func historyTitle(metric MetricHistory, peak float64) string {
+	current := math.NaN()
+	if len(metric.Values) > 0 {
+		current = metric.Values[len(metric.Values)-1]
+	}
+	if math.IsNaN(current) && peak == 0 {
+		return metric.Name + ": unknown"
+	}
+	return fmt.Sprintf("%s: %s (max %s)", metric.Name, formatMetric(current, metric.Unit), formatMetric(peak, metric.Unit))
+}
+
+// renderHistory fills the sparklines and the history charts
+func (ui *UI) renderHistory() {
+	var history []MetricHistory
+	if ui.historyHandler != nil {
+		history = ui.historyHandler()
+	}
+
+	// A sparkline group draws one column per value
+	var sparklines []*widgets.Sparkline
+	for i, metric := range history {
+		values, peak := lastValues(metric.Values, ui.sparklines.Inner.Dx())
+
+		sparkline := widgets.NewSparkline()
+		sparkline.Title = historyTitle(metric, peak)
+		sparkline.Data = values
+		sparkline.MaxVal = max(peak, 1)
+		sparkline.LineColor = historyColors[i%len(historyColors)]
+		sparklines = append(sparklines, sparkline)
+	}
+	if len(sparklines) == 0 {
+		sparklines = append(sparklines, noHistory())
+	}
+	ui.sparklines.Sparklines = sparklines
+
+	for i, plot := range ui.historyPlots {
+		if i >= len(history) {
+			plot.Title = "No history available"
+			plot.Data = [][]float64{{0, 0}}
+			plot.MaxVal = 1
+			continue
+		}
+		metric := history[i]
+
+		// One point per column of the plot area, which is the inner
+		// width minus the y axis labels
+		values, peak := lastValues(metric.Values, plot.Inner.Dx()-5)
+		plot.Title = fmt.Sprintf("%s (last %d samples)", historyTitle(metric, peak), len(values))
+
+		// A line needs at least two points
+		switch len(values) {
+		case 0:
+			values = []float64{0, 0}
+		case 1:
+			values = append(values, values[0])
+		}
+		plot.Data = [][]float64{values}
+		plot.MaxVal = max(peak, 1)
+	}
+}
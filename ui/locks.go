@@ -0,0 +1,191 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"dbtop/monitor/stats"
+
+	"github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// lockRow is a session shown in the blocking tree together with the root
+// blocker at the head of its chain
+type lockRow struct {
+	id   int64
+	head int64
+}
+
+// setupLocksWidget initializes the lock waits view
+func (ui *UI) setupLocksWidget() {
+	ui.locksList = widgets.NewList()
+	ui.locksList.Title = "Blocking Sessions (Enter: jump to head blocker, 'k' to kill it, 'l' for processes)"
+	ui.locksList.TextStyle = termui.NewStyle(termui.ColorYellow)
+	ui.locksList.BorderStyle = termui.NewStyle(termui.ColorBlue)
+	ui.locksList.SelectedRowStyle = termui.NewStyle(termui.ColorBlack, termui.ColorYellow)
+}
+
+// findProcess returns the process with the given ID from the last snapshot
+func (ui *UI) findProcess(id int64) (stats.ProcessInfo, bool) {
+	for _, process := range ui.processes {
+		if process.ID == id {
+			return process, true
+		}
+	}
+	return stats.ProcessInfo{}, false
+}
+
+// describeSession returns a short description of a session for the tree
+func (ui *UI) describeSession(id int64) string {
+	process, ok := ui.findProcess(id)
+	if !ok {
+		return fmt.Sprintf("[%d]", id)
+	}
+	line := fmt.Sprintf("[%d] %s@%s", id, process.User, process.Host)
+	if process.Command != "" {
+		line += " (" + process.Command + ")"
+	}
+	if process.State != "" {
+		line += " - " + process.State
+	}
+	return line
+}
+
+// renderLocks builds the blocking tree: root blockers, which hold locks
+// without waiting themselves, followed by the sessions they block
+func (ui *UI) renderLocks() {
+	var locks []stats.LockWait
+	if ui.stats != nil {
+		locks = ui.stats.Locks
+	}
+
+	victims := make(map[int64][]stats.LockWait)
+	waiting := make(map[int64]bool)
+	for _, lock := range locks {
+		victims[lock.BlockingID] = append(victims[lock.BlockingID], lock)
+		waiting[lock.WaitingID] = true
+	}
+
+	var roots []int64
+	for blocker := range victims {
+		if !waiting[blocker] {
+			roots = append(roots, blocker)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i] < roots[j] })
+
+	// Sessions blocking each other in a cycle have no root; show them from
+	// their lowest session ID so that deadlocks still appear
+	var cycles []int64
+	for blocker := range victims {
+		if waiting[blocker] {
+			cycles = append(cycles, blocker)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i] < cycles[j] })
+
+	var lines []string
+	var rows []lockRow
+	visited := make(map[int64]bool)
+
+	var walk func(id, head int64, depth int)
+	walk = func(id, head int64, depth int) {
+		visited[id] = true
+		for _, lock := range victims[id] {
+			line := fmt.Sprintf("%s└─ %s waiting %ds", strings.Repeat("   ", depth), ui.describeSession(lock.WaitingID), lock.WaitTime)
+			if lock.LockType != "" {
+				line += " for " + lock.LockType
+			}
+			if lock.Object != "" {
+				line += " on " + lock.Object
+			}
+			if visited[lock.WaitingID] {
+				line += " (cycle)"
+			}
+			lines = append(lines, line)
+			rows = append(rows, lockRow{id: lock.WaitingID, head: head})
+			if !visited[lock.WaitingID] {
+				walk(lock.WaitingID, head, depth+1)
+			}
+		}
+	}
+
+	for _, root := range append(roots, cycles...) {
+		if visited[root] {
+			continue
+		}
+		lines = append(lines, ui.describeSession(root)+" (head blocker)")
+		rows = append(rows, lockRow{id: root, head: root})
+		walk(root, root, 1)
+	}
+
+	if len(lines) == 0 {
+		lines = []string{"No sessions are waiting for locks"}
+	}
+	ui.locksList.Rows = lines
+	ui.lockRows = rows
+	if ui.locksList.SelectedRow >= len(lines) {
+		ui.locksList.SelectedRow = len(lines) - 1
+	}
+}
+
+// selectedBlocker returns the head blocker of the chain under the cursor.
+// It has to be in the process list, which holds what is needed to act on
+// it, such as the Oracle serial number; otherwise the status says why not.
+func (ui *UI) selectedBlocker() (stats.ProcessInfo, bool) {
+	row := ui.locksList.SelectedRow
+	if row < 0 || row >= len(ui.lockRows) {
+		ui.status = "No blocking session selected"
+		return stats.ProcessInfo{}, false
+	}
+	head := ui.lockRows[row].head
+	process, ok := ui.findProcess(head)
+	if !ok {
+		ui.status = fmt.Sprintf("Session %d is not in the process list", head)
+	}
+	return process, ok
+}
+
+// moveLockSelection moves the cursor in the lock waits view
+func (ui *UI) moveLockSelection(key string) {
+	if len(ui.lockRows) == 0 {
+		return
+	}
+	switch key {
+	case "<Up>":
+		ui.locksList.ScrollUp()
+	case "<Down>":
+		ui.locksList.ScrollDown()
+	case "<PageUp>":
+		ui.locksList.ScrollPageUp()
+	case "<PageDown>":
+		ui.locksList.ScrollPageDown()
+	case "<Home>":
+		ui.locksList.ScrollTop()
+	case "<End>":
+		ui.locksList.ScrollBottom()
+	}
+}
+
+// jumpToBlocker switches to the process list with the cursor on the head
+// blocker of the selected chain
+func (ui *UI) jumpToBlocker() {
+	blocker, ok := ui.selectedBlocker()
+	if !ok {
+		return
+	}
+	ui.selectedID = blocker.ID
+	ui.setView(ViewProcesses)
+}
+
+// killBlocker asks for confirmation before killing the head blocker of the
+// selected chain
+func (ui *UI) killBlocker() {
+	blocker, ok := ui.selectedBlocker()
+	if !ok {
+		return
+	}
+	ui.confirmAction(ActionKill, blocker)
+}
@@ -0,0 +1,229 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"dbtop/alerts"
+	"dbtop/monitor/stats"
+
+	"github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// Overview represents the multi-instance summary dashboard
+type Overview struct {
+	grid     *termui.Grid
+	table    *widgets.Table
+	helpBox  *widgets.Paragraph
+	names    []string
+	types    map[string]string
+	stats    map[string]*stats.DatabaseStats
+	errors   map[string]error
+	alerts   map[string]alerts.Status
+	selected int
+
+	connections map[string]ConnectionStatus // Connection state by instance name
+	servers     map[string]serverSupport    // Detected server by instance name
+}
+
+// serverSupport is a detected server and the features it supports
+type serverSupport struct {
+	info         stats.ServerInfo
+	capabilities stats.Capabilities
+}
+
+// NewOverview creates the overview dashboard for the given instances,
+// keyed by instance name with the database type as value
+func NewOverview(instances map[string]string) *Overview {
+	if err := termui.Init(); err != nil {
+		log.Fatal("Failed to initialize termui:", err)
+	}
+
+	overview := &Overview{
+		types:  instances,
+		stats:  make(map[string]*stats.DatabaseStats),
+		errors: make(map[string]error),
+		alerts: make(map[string]alerts.Status),
+
+		connections: make(map[string]ConnectionStatus),
+		servers:     make(map[string]serverSupport),
+	}
+	for name := range instances {
+		overview.names = append(overview.names, name)
+	}
+	sort.Strings(overview.names)
+
+	overview.table = widgets.NewTable()
+	overview.table.Title = "Instances (Enter to drill down)"
+	overview.table.TextStyle = termui.NewStyle(termui.ColorWhite)
+	overview.table.BorderStyle = termui.NewStyle(termui.ColorGreen)
+	overview.table.RowSeparator = false
+	overview.table.TextAlignment = termui.AlignLeft
+
+	overview.helpBox = widgets.NewParagraph()
+	overview.helpBox.Title = "Controls"
+	overview.helpBox.Text = "q: quit | up/down: select | Enter: open instance | Esc: back to overview"
+	overview.helpBox.TextStyle = termui.NewStyle(termui.ColorWhite)
+	overview.helpBox.BorderStyle = termui.NewStyle(termui.ColorRed)
+
+	overview.grid = termui.NewGrid()
+	termWidth, termHeight := termui.TerminalDimensions()
+	overview.grid.SetRect(0, 0, termWidth, termHeight)
+	overview.grid.Set(
+		termui.NewRow(0.9, overview.table),
+		termui.NewRow(0.1, overview.helpBox),
+	)
+
+	return overview
+}
+
+// Update stores the latest result of polling an instance
+func (o *Overview) Update(name string, stats *stats.DatabaseStats, err error) {
+	if err != nil {
+		o.errors[name] = err
+		return
+	}
+	delete(o.errors, name)
+	o.stats[name] = stats
+}
+
+// SetAlertStatus stores the latest alert status of an instance
+func (o *Overview) SetAlertStatus(name string, status alerts.Status) {
+	o.alerts[name] = status
+}
+
+// SetConnectionStatus stores the latest connection state of an instance
+func (o *Overview) SetConnectionStatus(name string, status ConnectionStatus) {
+	o.connections[name] = status
+}
+
+// SetServer stores the detected server of an instance and the features it
+// supports
+func (o *Overview) SetServer(name string, server stats.ServerInfo, capabilities stats.Capabilities) {
+	o.servers[name] = serverSupport{server, capabilities}
+}
+
+// Render redraws the overview
+func (o *Overview) Render() {
+	rows := [][]string{
+		{"Instance", "Type", "Uptime", "Active/Total", "QPS", "Longest Query", "Status"},
+	}
+	for _, name := range o.names {
+		row := []string{name, o.types[name], "-", "-", "-", "-", "OK"}
+		if stats, ok := o.stats[name]; ok {
+			row[2] = stats.Uptime.String()
+			row[3] = fmt.Sprintf("%d/%d", stats.ActiveConnections, stats.TotalConnections)
+			row[4] = fmt.Sprintf("%.2f", stats.QueriesPerSecond)
+			row[5] = longestQuery(stats.Processes)
+		} else {
+			row[6] = "connecting"
+		}
+		switch firing := len(o.alerts[name].Firing); firing {
+		case 0:
+		case 1:
+			row[6] = "1 alert firing"
+		default:
+			row[6] = fmt.Sprintf("%d alerts firing", firing)
+		}
+		if err, ok := o.errors[name]; ok {
+			row[6] = err.Error()
+			if status, ok := o.connections[name]; ok && status.State != StateConnected {
+				row[6] = status.Summary(time.Now()) + ": " + row[6]
+			}
+		}
+		rows = append(rows, row)
+	}
+	o.table.Rows = rows
+	o.table.ColumnWidths = []int{16, 10, 16, 14, 10, 28, max(o.table.Inner.Dx()-94, 10)}
+
+	o.table.RowStyles = map[int]termui.Style{
+		0:              termui.NewStyle(termui.ColorWhite, termui.ColorClear, termui.ModifierBold),
+		o.selected + 1: termui.NewStyle(termui.ColorBlack, termui.ColorCyan),
+	}
+	for i, name := range o.names {
+		if i == o.selected {
+			continue
+		}
+		if _, failed := o.errors[name]; failed {
+			o.table.RowStyles[i+1] = termui.NewStyle(termui.ColorRed)
+		} else if len(o.alerts[name].Firing) > 0 {
+			o.table.RowStyles[i+1] = breachStyle
+		}
+	}
+
+	termui.Clear()
+	termui.Render(o.grid)
+}
+
+// longestQuery describes the longest running non-idle process
+func longestQuery(processes []stats.ProcessInfo) string {
+	var longest *stats.ProcessInfo
+	for i, process := range processes {
+		if process.Info == "" || process.Command == "Sleep" || process.State == "idle" {
+			continue
+		}
+		if longest == nil || process.Time > longest.Time {
+			longest = &processes[i]
+		}
+	}
+	if longest == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%ds %s@%s", longest.Time, longest.User, longest.Database)
+}
+
+// Resize adjusts the grid to the new terminal dimensions
+func (o *Overview) Resize(width, height int) {
+	o.grid.SetRect(0, 0, width, height)
+	o.Render()
+}
+
+// HandleKey handles keyboard input and returns false when the user quits
+func (o *Overview) HandleKey(key string) bool {
+	switch key {
+	case "q", "<C-c>":
+		return false
+	case "<Down>", "j":
+		if o.selected < len(o.names)-1 {
+			o.selected++
+		}
+	case "<Up>", "k":
+		if o.selected > 0 {
+			o.selected--
+		}
+	}
+	return true
+}
+
+// Selected returns the name of the highlighted instance
+func (o *Overview) Selected() string {
+	if len(o.names) == 0 {
+		return ""
+	}
+	return o.names[o.selected]
+}
+
+// Detail creates a single-instance view that shares the overview's terminal.
+// The returned UI must not be closed; closing the overview is enough.
+func (o *Overview) Detail(name string, refreshInterval time.Duration) *UI {
+	ui := newUI(name, o.types[name], refreshInterval)
+	ui.SetAlertStatus(o.alerts[name])
+	if status, ok := o.connections[name]; ok {
+		ui.SetConnectionStatus(status)
+	}
+	if server, ok := o.servers[name]; ok {
+		ui.SetServer(server.info, server.capabilities)
+	}
+	if stats, ok := o.stats[name]; ok {
+		ui.Update(stats)
+	}
+	return ui
+}
+
+// Close cleans up the UI
+func (o *Overview) Close() {
+	termui.Close()
+}
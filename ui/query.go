@@ -0,0 +1,249 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"dbtop/monitor/stats"
+
+	"github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// ExplainHandler fetches the execution plan of a process's statement
+type ExplainHandler func(process stats.ProcessInfo) (*stats.QueryPlan, error)
+
+// clauseKeywords start a new line when formatting SQL. Longer keywords come
+// first so that "ORDER BY" is matched before "ORDER".
+var clauseKeywords = []string{
+	"LEFT OUTER JOIN", "RIGHT OUTER JOIN", "FULL OUTER JOIN",
+	"INSERT INTO", "DELETE FROM", "GROUP BY", "ORDER BY", "UNION ALL",
+	"LEFT JOIN", "RIGHT JOIN", "INNER JOIN", "CROSS JOIN", "FULL JOIN",
+	"SELECT", "FROM", "WHERE", "HAVING", "LIMIT", "OFFSET", "JOIN",
+	"UNION", "UPDATE", "SET", "VALUES", "RETURNING", "WITH",
+}
+
+// setupDetailWidget initializes the query detail pane
+func (ui *UI) setupDetailWidget() {
+	ui.detailPane = widgets.NewParagraph()
+	ui.detailPane.Title = "Query Detail (e: explain, up/down: scroll, Enter/Esc: close)"
+	ui.detailPane.TextStyle = termui.NewStyle(termui.ColorWhite)
+	ui.detailPane.BorderStyle = termui.NewStyle(termui.ColorBlue)
+}
+
+// SetExplainHandler sets the function that fetches execution plans.
+// Without a handler the explain action is unavailable.
+func (ui *UI) SetExplainHandler(handler ExplainHandler) {
+	ui.explainHandler = handler
+}
+
+// openDetail shows the detail pane for the selected process
+func (ui *UI) openDetail() bool {
+	process, ok := ui.selectedProcess()
+	if !ok {
+		ui.status = "No process selected"
+		return false
+	}
+	ui.detailProcess = &process
+	ui.detailPlan = nil
+	ui.detailPlanErr = nil
+	ui.detailOffset = 0
+	ui.setupGrid()
+	return true
+}
+
+// closeDetail hides the detail pane
+func (ui *UI) closeDetail() {
+	ui.detailProcess = nil
+	ui.setupGrid()
+}
+
+// explainDetail fetches the plan of the process shown in the detail pane
+func (ui *UI) explainDetail() {
+	if ui.explainHandler == nil {
+		ui.status = "Explain is not available here"
+		return
+	}
+	ui.detailPlan, ui.detailPlanErr = ui.explainHandler(*ui.detailProcess)
+	ui.detailOffset = 0
+}
+
+// scrollDetail moves the visible part of the detail pane
+func (ui *UI) scrollDetail(key string) {
+	page := max(ui.detailPane.Inner.Dy(), 1)
+	switch key {
+	case "<Up>":
+		ui.detailOffset--
+	case "<Down>":
+		ui.detailOffset++
+	case "<PageUp>":
+		ui.detailOffset -= page
+	case "<PageDown>":
+		ui.detailOffset += page
+	case "<Home>":
+		ui.detailOffset = 0
+	}
+	ui.detailOffset = max(ui.detailOffset, 0)
+}
+
+// renderDetail fills the detail pane with the query text and plan
+func (ui *UI) renderDetail() {
+	if ui.detailProcess == nil {
+		return
+	}
+	process := ui.detailProcess
+
+	lines := []string{
+		fmt.Sprintf("Process %d  %s@%s  database: %s", process.ID, process.User, process.Host, process.Database),
+		fmt.Sprintf("Command: %s  State: %s  Time: %ds", process.Command, process.State, process.Time),
+	}
+	if process.BackendType != "" {
+		wait := "none"
+		if process.WaitEventType != "" {
+			wait = process.WaitEventType + "/" + process.WaitEvent
+		}
+		lines = append(lines,
+			fmt.Sprintf("Backend: %s  Wait: %s  Transaction: %ds  Query: %ds", process.BackendType, wait, process.TransactionTime, process.Time),
+			fmt.Sprintf("xid: %s  xmin: %s", valueOr(process.BackendXID, "-"), valueOr(process.BackendXmin, "-")),
+		)
+	}
+	lines = append(lines, "")
+	if process.Info == "" {
+		lines = append(lines, "(no query text)")
+	} else {
+		lines = append(lines, strings.Split(formatSQL(process.Info), "\n")...)
+	}
+
+	switch {
+	case ui.detailPlanErr != nil:
+		lines = append(lines, "", "Explain failed: "+ui.detailPlanErr.Error())
+	case ui.detailPlan != nil:
+		lines = append(lines, "", "Plan:")
+		lines = append(lines, planLines(ui.detailPlan)...)
+	}
+
+	ui.detailOffset = min(ui.detailOffset, max(len(lines)-1, 0))
+	ui.detailPane.Text = strings.Join(lines[ui.detailOffset:], "\n")
+}
+
+// planLines renders a plan as an indented tree
+func planLines(plan *stats.QueryPlan) []string {
+	if len(plan.Nodes) == 0 {
+		return plan.Text
+	}
+
+	var lines []string
+	var walk func(nodes []*stats.PlanNode, prefix string)
+	walk = func(nodes []*stats.PlanNode, prefix string) {
+		for i, node := range nodes {
+			branch, indent := "├─ ", "│  "
+			if i == len(nodes)-1 {
+				branch, indent = "└─ ", "   "
+			}
+			lines = append(lines, prefix+branch+node.Label)
+			walk(node.Children, prefix+indent)
+		}
+	}
+	walk(plan.Nodes, "")
+	return lines
+}
+
+// formatSQL normalizes whitespace and starts each major clause on a new
+// line. Quoted strings and identifiers are left untouched.
+func formatSQL(query string) string {
+	var b strings.Builder
+	var quote rune
+	lastSpace := true
+
+	runes := []rune(strings.TrimSpace(query))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if quote != 0 {
+			b.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+			b.WriteRune(r)
+			lastSpace = false
+			continue
+		case unicode.IsSpace(r):
+			if !lastSpace {
+				b.WriteRune(' ')
+				lastSpace = true
+			}
+			continue
+		}
+
+		// Break the line before a clause keyword at a word boundary
+		if i == 0 || !isWordRune(runes[i-1]) {
+			if length := matchKeyword(runes[i:]); length > 0 {
+				if b.Len() > 0 {
+					text := strings.TrimRight(b.String(), " ")
+					b.Reset()
+					b.WriteString(text)
+					b.WriteString("\n")
+				}
+				b.WriteString(strings.Join(strings.Fields(string(runes[i:i+length])), " "))
+				i += length - 1
+				lastSpace = false
+				continue
+			}
+		}
+
+		b.WriteRune(r)
+		lastSpace = false
+	}
+	return b.String()
+}
+
+// matchKeyword returns the length of the clause keyword at the start of
+// text, or zero if there is none. Spaces inside a keyword match any run of
+// whitespace.
+func matchKeyword(text []rune) int {
+	for _, keyword := range clauseKeywords {
+		i := 0
+		matched := true
+		for _, k := range keyword {
+			if k == ' ' {
+				if i >= len(text) || !unicode.IsSpace(text[i]) {
+					matched = false
+					break
+				}
+				for i < len(text) && unicode.IsSpace(text[i]) {
+					i++
+				}
+				continue
+			}
+			if i >= len(text) || unicode.ToUpper(text[i]) != k {
+				matched = false
+				break
+			}
+			i++
+		}
+		if matched && (i == len(text) || !isWordRune(text[i])) {
+			return i
+		}
+	}
+	return 0
+}
+
+// isWordRune reports whether r can be part of an identifier
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// valueOr returns value, or fallback if value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
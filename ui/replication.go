@@ -0,0 +1,99 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"dbtop/monitor/stats"
+
+	"github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// setupReplicationWidget initializes the replication view
+func (ui *UI) setupReplicationWidget() {
+	ui.replicationPane = widgets.NewParagraph()
+	ui.replicationPane.Title = "Replication (Press 'p' for processes)"
+	ui.replicationPane.TextStyle = termui.NewStyle(termui.ColorWhite)
+	ui.replicationPane.BorderStyle = termui.NewStyle(termui.ColorBlue)
+}
+
+// formatLag formats a replication lag in seconds
+func formatLag(seconds float64, known bool) string {
+	if !known {
+		return "unknown"
+	}
+	if seconds < 10 {
+		return fmt.Sprintf("%.1fs", seconds)
+	}
+	return fmt.Sprintf("%.0fs", seconds)
+}
+
+// replicationSummary returns a one-line summary for the info box
+func replicationSummary(replication *stats.Replication) string {
+	summary := "Replication: " + replication.Role
+	if len(replication.Channels) > 0 || len(replication.Replicas) > 0 {
+		summary += ", lag " + formatLag(replication.Lag, replication.LagKnown)
+	}
+	if len(replication.Replicas) > 0 {
+		summary += fmt.Sprintf(", %d replicas", len(replication.Replicas))
+	}
+	return summary
+}
+
+// renderReplication fills the replication view from the last snapshot
+func (ui *UI) renderReplication() {
+	if ui.stats == nil || ui.stats.Replication == nil {
+		ui.replicationPane.Text = "No replication configured, or the replication status is not readable"
+		return
+	}
+	replication := ui.stats.Replication
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("Role: %s    Lag: %s", replication.Role, formatLag(replication.Lag, replication.LagKnown)))
+
+	if len(replication.Channels) > 0 {
+		lines = append(lines, "", "Replicating from:")
+		for _, channel := range replication.Channels {
+			name := channel.Name
+			if name == "" {
+				name = "(default)"
+			}
+			lines = append(lines, fmt.Sprintf("  %s  source: %s  IO: %s  SQL: %s  lag: %s",
+				name, channel.Source, channel.IOState, channel.SQLState, formatLag(channel.Lag, channel.LagKnown)))
+			if channel.ReceivedGTID != "" {
+				lines = append(lines, "    received: "+channel.ReceivedGTID)
+			}
+			if channel.ExecutedGTID != "" {
+				lines = append(lines, "    executed: "+channel.ExecutedGTID)
+			}
+			if channel.LastError != "" {
+				lines = append(lines, "    error: "+channel.LastError)
+			}
+		}
+	}
+
+	if len(replication.Replicas) > 0 {
+		lines = append(lines, "", "Replicas:")
+		for _, replica := range replication.Replicas {
+			lines = append(lines, fmt.Sprintf("  %s (%s)  %s %s  write: %s  flush: %s  replay: %s  behind: %s",
+				replica.Name, replica.Client, replica.State, replica.SyncState,
+				formatLag(replica.WriteLag, replica.WriteLagKnown), formatLag(replica.FlushLag, replica.FlushLagKnown),
+				formatLag(replica.ReplayLag, replica.ReplayLagKnown), formatBytes(replica.LagBytes)))
+		}
+	}
+
+	if len(replication.Slots) > 0 {
+		lines = append(lines, "", "Slots:")
+		for _, slot := range replication.Slots {
+			state := "inactive"
+			if slot.Active {
+				state = "active"
+			}
+			lines = append(lines, fmt.Sprintf("  %s (%s, %s)  retained WAL: %s",
+				slot.Name, slot.Type, state, formatBytes(slot.RetainedWAL)))
+		}
+	}
+
+	ui.replicationPane.Text = strings.Join(lines, "\n")
+}
@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"dbtop/monitor/stats"
+)
+
+// control is a key binding listed in the help box
+type control struct {
+	keys     string
+	label    string
+	requires stats.Capabilities // features the server needs for the control
+}
+
+// controls lists the key bindings of the single-instance view
+var controls = []control{
+	{"q", "quit", 0},
+	{"s", "sort", 0},
+	{"r", "reverse", 0},
+	{"t", "tables", stats.CapTables},
+	{"l", "locks", stats.CapLocks},
+	{"p", "replication", stats.CapReplication},
+	{"d", "statements", stats.CapDigests},
+	{"w", "waits", 0},
+	{"h", "history", 0},
+	{"E", "errors", 0},
+	{"up/down", "select", 0},
+	{"Enter", "query", 0},
+	{"e", "explain", stats.CapExplain},
+	{"k", "kill", stats.CapKill},
+	{"c", "cancel", stats.CapCancel},
+	{"+/-", "refresh", 0},
+}
+
+// viewCapabilities maps the views to the features they show
+var viewCapabilities = map[View]stats.Capabilities{
+	ViewTables:      stats.CapTables,
+	ViewLocks:       stats.CapLocks,
+	ViewReplication: stats.CapReplication,
+	ViewStatements:  stats.CapDigests,
+}
+
+// capabilityFeatures describes the capabilities in status messages
+var capabilityFeatures = map[stats.Capabilities]string{
+	stats.CapKill:        "Killing sessions",
+	stats.CapCancel:      "Cancelling queries",
+	stats.CapExplain:     "Explaining queries",
+	stats.CapReplication: "Replication status",
+	stats.CapLocks:       "Lock wait tracking",
+	stats.CapDigests:     "Statement statistics",
+	stats.CapTables:      "Table statistics",
+}
+
+// helpFor lists the controls whose features are all supported
+func helpFor(capabilities stats.Capabilities) string {
+	var entries []string
+	for _, control := range controls {
+		if capabilities.Has(control.requires) {
+			entries = append(entries, control.keys+": "+control.label)
+		}
+	}
+	return strings.Join(entries, " | ")
+}
+
+// SetServer sets the server shown in the info box and the features it
+// supports. Controls for other features are left out of the help box and
+// show a message instead of running queries the server cannot answer.
+func (ui *UI) SetServer(server stats.ServerInfo, capabilities stats.Capabilities) {
+	ui.server = &server
+	ui.capabilities = capabilities
+	if !ui.capabilities.Has(viewCapabilities[ui.view]) {
+		ui.setView(ViewProcesses)
+	}
+}
+
+// serverType describes the database type and, once known, the server
+func (ui *UI) serverType() string {
+	if ui.server == nil {
+		return ui.dbType
+	}
+	return fmt.Sprintf("%s (%s)", ui.dbType, ui.server)
+}
+
+// supports reports whether the server has the given features, and shows
+// why the control is unavailable if not
+func (ui *UI) supports(capability stats.Capabilities) bool {
+	if ui.capabilities.Has(capability) {
+		return true
+	}
+	server := ui.dbType
+	if ui.server != nil {
+		server = ui.server.String()
+	}
+	ui.status = fmt.Sprintf("%s is not supported on %s", capabilityFeatures[capability], server)
+	return false
+}
+
+// helpText returns the controls shown in the help box
+func (ui *UI) helpText() string {
+	if ui.help != "" {
+		return ui.help
+	}
+	return helpFor(ui.capabilities)
+}
@@ -0,0 +1,188 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dbtop/monitor/stats"
+
+	"github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// statementColumns are the headers of the top statements view for
+// pg_stat_statements, which reports buffer usage
+var statementColumns = []string{"Calls", "Time", "Avg", "Rows", "Hit %", "Reads", "Database", "Query"}
+
+// digestColumns are the headers of the top statements view for
+// performance_schema digests, which report rows examined and index usage
+var digestColumns = []string{"Calls", "Time", "Avg", "Sent", "Examined", "No Index", "Database", "Query"}
+
+// rankedStatement is a statement with the counters shown for it
+type rankedStatement struct {
+	statement stats.Statement
+	counters  stats.StatementCounters
+}
+
+// setupStatementsWidget initializes the top statements view
+func (ui *UI) setupStatementsWidget() {
+	ui.statementsTable = widgets.NewTable()
+	ui.statementsTable.TextStyle = termui.NewStyle(termui.ColorWhite)
+	ui.statementsTable.BorderStyle = termui.NewStyle(termui.ColorBlue)
+	ui.statementsTable.RowSeparator = false
+	ui.statementsTable.TextAlignment = termui.AlignLeft
+	ui.statementsTable.RowStyles = map[int]termui.Style{
+		0: termui.NewStyle(termui.ColorWhite, termui.ColorClear, termui.ModifierBold),
+	}
+	ui.statementsTable.Rows = [][]string{statementColumns}
+}
+
+// resetStatementBaseline makes the top statements view count from the
+// current totals instead of showing the last interval
+func (ui *UI) resetStatementBaseline() {
+	if ui.stats == nil {
+		return
+	}
+	ui.statementBaseline = make(map[string]stats.StatementCounters, len(ui.stats.Statements))
+	for _, statement := range ui.stats.Statements {
+		ui.statementBaseline[statement.ID] = statement.Total
+	}
+	ui.statementBaselineTime = ui.stats.Timestamp
+}
+
+// extendStatementBaseline adds the statements of a new snapshot that are
+// missing from the baseline. Snapshots only keep the busiest statements,
+// so one that is missing may well have existed at the reset; its total
+// before the last interval is the earliest one known after the reset.
+func (ui *UI) extendStatementBaseline(snapshot *stats.DatabaseStats) {
+	if ui.statementBaseline == nil {
+		return
+	}
+	for _, statement := range snapshot.Statements {
+		if _, ok := ui.statementBaseline[statement.ID]; !ok {
+			ui.statementBaseline[statement.ID] = statement.Total.Sub(statement.Delta)
+		}
+	}
+}
+
+// clearStatementBaseline returns the top statements view to per-interval
+// numbers
+func (ui *UI) clearStatementBaseline() {
+	ui.statementBaseline = nil
+}
+
+// statementCounters returns the counters shown for a statement: its
+// increase in the last interval, or since the baseline if one is set.
+// Statements whose counters were reset since the baseline are counted in
+// full.
+func (ui *UI) statementCounters(statement stats.Statement) stats.StatementCounters {
+	if ui.statementBaseline == nil {
+		return statement.Delta
+	}
+	base, ok := ui.statementBaseline[statement.ID]
+	if !ok {
+		return statement.Delta
+	}
+	if statement.Total.Calls < base.Calls {
+		return statement.Total
+	}
+	return statement.Total.Sub(base)
+}
+
+// rankStatements returns the statements ordered by the time they took in
+// the shown period, then by their total time
+func (ui *UI) rankStatements(statements []stats.Statement) []rankedStatement {
+	ranked := make([]rankedStatement, len(statements))
+	for i, statement := range statements {
+		ranked[i] = rankedStatement{statement, ui.statementCounters(statement)}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.counters.Time != b.counters.Time {
+			return a.counters.Time > b.counters.Time
+		}
+		return a.statement.Total.Time > b.statement.Total.Time
+	})
+	return ranked
+}
+
+// formatMillis formats a duration in milliseconds
+func formatMillis(ms float64) string {
+	if ms >= 1000 {
+		return fmt.Sprintf("%.2f s", ms/1000)
+	}
+	return fmt.Sprintf("%.1f ms", ms)
+}
+
+// renderStatements fills the top statements view from the last snapshot
+func (ui *UI) renderStatements() {
+	period := "per Interval"
+	if ui.statementBaseline != nil {
+		period = "since " + ui.statementBaselineTime.Local().Format(time.TimeOnly)
+	}
+	ui.statementsTable.Title = fmt.Sprintf("Top Statements %s (Press 'z' to reset baseline, 'Z' for intervals, 'd' for processes)", period)
+
+	width := ui.statementsTable.Inner.Dx()
+
+	message := ""
+	switch {
+	case ui.stats == nil:
+		message = "Waiting for data..."
+	case ui.stats.StatementsMessage != "":
+		message = ui.stats.StatementsMessage
+	case len(ui.stats.Statements) == 0:
+		message = "No statement statistics available for this database"
+	}
+	if message != "" {
+		ui.statementsTable.Rows = [][]string{{message}}
+		ui.statementsTable.ColumnWidths = []int{max(width, 1)}
+		return
+	}
+
+	digests := ui.stats.StatementsSource == "performance_schema"
+	header := statementColumns
+	if digests {
+		header = digestColumns
+	}
+
+	rows := [][]string{header}
+	for _, ranked := range ui.rankStatements(ui.stats.Statements) {
+		counters := ranked.counters
+
+		avg := "-"
+		if counters.Calls > 0 {
+			avg = formatMillis(counters.Time / float64(counters.Calls))
+		}
+
+		row := []string{
+			strconv.FormatInt(counters.Calls, 10),
+			formatMillis(counters.Time),
+			avg,
+			strconv.FormatInt(counters.Rows, 10),
+		}
+		if digests {
+			row = append(row,
+				strconv.FormatInt(counters.RowsExamined, 10),
+				strconv.FormatInt(counters.NoIndexUsed, 10),
+			)
+		} else {
+			hit := "-"
+			if blocks := counters.BlocksHit + counters.BlocksRead; blocks > 0 {
+				hit = fmt.Sprintf("%.1f", float64(counters.BlocksHit)*100/float64(blocks))
+			}
+			row = append(row, hit, strconv.FormatInt(counters.BlocksRead, 10))
+		}
+		row = append(row,
+			ranked.statement.Database,
+			strings.Join(strings.Fields(ranked.statement.Query), " "),
+		)
+		rows = append(rows, row)
+	}
+	ui.statementsTable.Rows = rows
+
+	queryWidth := max(width-6*10-14, 20)
+	ui.statementsTable.ColumnWidths = []int{10, 10, 10, 10, 10, 10, 14, queryWidth}
+}
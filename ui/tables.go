@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"dbtop/monitor/stats"
+
+	"github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// TableSortField represents the column the tables view is sorted by
+type TableSortField int
+
+const (
+	TableSortByName TableSortField = iota
+	TableSortByRows
+	TableSortByDataSize
+	TableSortByIndexSize
+	TableSortByTotalSize
+	TableSortByGrowth
+)
+
+// tableColumns are the headers of the tables view, indexed by TableSortField
+var tableColumns = []string{"Table", "Rows", "Data", "Index", "Total", "Growth"}
+
+// setupTablesWidget initializes the tables view
+func (ui *UI) setupTablesWidget() {
+	ui.tablesTable = widgets.NewTable()
+	ui.tablesTable.Title = "Tables (Press 's' to sort, 'r' to reverse, 't' for processes)"
+	ui.tablesTable.TextStyle = termui.NewStyle(termui.ColorWhite)
+	ui.tablesTable.BorderStyle = termui.NewStyle(termui.ColorBlue)
+	ui.tablesTable.RowSeparator = false
+	ui.tablesTable.TextAlignment = termui.AlignLeft
+	ui.tablesTable.RowStyles = map[int]termui.Style{
+		0: termui.NewStyle(termui.ColorWhite, termui.ColorClear, termui.ModifierBold),
+	}
+	ui.tablesTable.Rows = [][]string{tableColumns}
+	ui.tableSizes = make(map[string]int64)
+}
+
+// tableGrowth returns how much a table grew since it was first seen
+func (ui *UI) tableGrowth(table stats.TableInfo) int64 {
+	return table.DataSize + table.IndexSize - ui.tableSizes[table.Name]
+}
+
+// trackTables remembers the size of tables seen for the first time so that
+// their growth can be computed from later snapshots
+func (ui *UI) trackTables(tables []stats.TableInfo) {
+	for _, table := range tables {
+		if _, seen := ui.tableSizes[table.Name]; !seen {
+			ui.tableSizes[table.Name] = table.DataSize + table.IndexSize
+		}
+	}
+}
+
+// sortTables sorts the tables based on the current table sort field
+func (ui *UI) sortTables() {
+	sort.Slice(ui.tables, func(i, j int) bool {
+		a, b := ui.tables[i], ui.tables[j]
+		var result bool
+		switch ui.tableSortField {
+		case TableSortByName:
+			result = a.Name < b.Name
+		case TableSortByRows:
+			result = a.Rows < b.Rows
+		case TableSortByDataSize:
+			result = a.DataSize < b.DataSize
+		case TableSortByIndexSize:
+			result = a.IndexSize < b.IndexSize
+		case TableSortByTotalSize:
+			result = a.DataSize+a.IndexSize < b.DataSize+b.IndexSize
+		case TableSortByGrowth:
+			result = ui.tableGrowth(a) < ui.tableGrowth(b)
+		}
+		if ui.tableSortDescending {
+			return !result
+		}
+		return result
+	})
+}
+
+// renderTables fills the tables view from the sorted tables
+func (ui *UI) renderTables() {
+	header := make([]string, len(tableColumns))
+	copy(header, tableColumns)
+	if ui.tableSortDescending {
+		header[ui.tableSortField] += " ▼"
+	} else {
+		header[ui.tableSortField] += " ▲"
+	}
+
+	rows := [][]string{header}
+	for _, table := range ui.tables {
+		rows = append(rows, []string{
+			table.Name,
+			strconv.FormatInt(table.Rows, 10),
+			formatBytes(table.DataSize),
+			formatBytes(table.IndexSize),
+			formatBytes(table.DataSize + table.IndexSize),
+			formatGrowth(ui.tableGrowth(table)),
+		})
+	}
+	ui.tablesTable.Rows = rows
+
+	nameWidth := max(ui.tablesTable.Inner.Dx()-5*14, 20)
+	ui.tablesTable.ColumnWidths = []int{nameWidth, 14, 14, 14, 14, 14}
+}
+
+// formatBytes formats a size in bytes using binary units
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit && size > -unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size)
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+	for i := range units {
+		value /= unit
+		if value < unit && value > -unit || i == len(units)-1 {
+			return fmt.Sprintf("%.1f %s", value, units[i])
+		}
+	}
+	return ""
+}
+
+// formatGrowth formats a size change with an explicit sign
+func formatGrowth(delta int64) string {
+	switch {
+	case delta > 0:
+		return "+" + formatBytes(delta)
+	case delta < 0:
+		return "-" + formatBytes(-delta)
+	default:
+		return "0 B"
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"time"
 
+	"dbtop/alerts"
 	"dbtop/monitor/stats"
 
 	"github.com/gizak/termui/v3"
@@ -23,6 +24,24 @@ const (
 	SortByDatabase
 	SortByTime
 	SortByState
+	SortByTransaction
+
+	// sortFieldCount is the number of process sort fields
+	sortFieldCount = iota
+)
+
+// View represents the panel shown below the statistics
+type View int
+
+const (
+	ViewProcesses View = iota
+	ViewTables
+	ViewLocks
+	ViewReplication
+	ViewStatements
+	ViewWaits
+	ViewHistory
+	ViewErrors
 )
 
 // UI represents the terminal user interface
@@ -32,12 +51,62 @@ type UI struct {
 	refreshInterval time.Duration
 	grid            *termui.Grid
 	processList     *widgets.List
+	tablesTable     *widgets.Table
 	statsTable      *widgets.Table
 	infoBox         *widgets.Paragraph
 	helpBox         *widgets.Paragraph
 	sortField       SortField
 	sortDescending  bool
 	processes       []stats.ProcessInfo
+	stats           *stats.DatabaseStats
+	view            View
+
+	visibleProcesses []stats.ProcessInfo
+	selectedID       int64
+	processHandler   ProcessHandler
+	pending          *pendingAction
+	status           string
+	notice           string
+	help             string
+	replay           bool // showing a recording, so live-only keys are off
+
+	detailPane     *widgets.Paragraph
+	detailProcess  *stats.ProcessInfo
+	detailPlan     *stats.QueryPlan
+	detailPlanErr  error
+	detailOffset   int
+	explainHandler ExplainHandler
+
+	tableSortField      TableSortField
+	tableSortDescending bool
+	tables              []stats.TableInfo
+	tableSizes          map[string]int64 // total size when first seen, by table name
+
+	locksList *widgets.List
+	lockRows  []lockRow
+
+	replicationPane       *widgets.Paragraph
+	statementsTable       *widgets.Table
+	statementBaseline     map[string]stats.StatementCounters // totals at the last baseline reset, by statement ID
+	statementBaselineTime time.Time
+
+	waitsTable           *widgets.Table
+	activeSessionsPlot   *widgets.Plot
+	activeSessionsLegend *widgets.Paragraph
+	activeSessionSamples []activeSessionSample
+
+	sparklines     *widgets.SparklineGroup
+	historyPlots   []*widgets.Plot
+	historyHandler HistoryHandler
+
+	alertStatus alerts.Status
+
+	server       *stats.ServerInfo
+	capabilities stats.Capabilities
+
+	connection *ConnectionStatus
+	errorLog   *ErrorLog
+	errorsList *widgets.List
 }
 
 // NewUI creates a new UI instance
@@ -46,12 +115,23 @@ func NewUI(instanceName, dbType string, refreshInterval time.Duration) *UI {
 		log.Fatal("Failed to initialize termui:", err)
 	}
 
+	return newUI(instanceName, dbType, refreshInterval)
+}
+
+// newUI creates the widgets of a single-instance view on an already
+// initialized terminal
+func newUI(instanceName, dbType string, refreshInterval time.Duration) *UI {
 	ui := &UI{
 		instanceName:    instanceName,
 		dbType:          dbType,
 		refreshInterval: refreshInterval,
 		sortField:       SortByTime,
 		sortDescending:  true,
+
+		tableSortField:      TableSortByTotalSize,
+		tableSortDescending: true,
+
+		capabilities: stats.AllCapabilities,
 	}
 
 	ui.setupWidgets()
@@ -64,9 +144,34 @@ func NewUI(instanceName, dbType string, refreshInterval time.Duration) *UI {
 func (ui *UI) setupWidgets() {
 	// Process list
 	ui.processList = widgets.NewList()
-	ui.processList.Title = "Active Processes (Press 's' to sort, 'r' to reverse, 'h' for help)"
+	ui.processList.Title = "Active Processes (Press 's' to sort, 'r' to reverse, 'k' to kill, 'c' to cancel)"
 	ui.processList.TextStyle = termui.NewStyle(termui.ColorYellow)
 	ui.processList.BorderStyle = termui.NewStyle(termui.ColorBlue)
+	ui.processList.SelectedRowStyle = termui.NewStyle(termui.ColorBlack, termui.ColorYellow)
+
+	// Tables view
+	ui.setupTablesWidget()
+
+	// Lock waits view
+	ui.setupLocksWidget()
+
+	// Replication view
+	ui.setupReplicationWidget()
+
+	// Top statements view
+	ui.setupStatementsWidget()
+
+	// Wait events view
+	ui.setupWaitsWidgets()
+
+	// Metric history sparklines and charts
+	ui.setupHistoryWidgets()
+
+	// Error log view
+	ui.setupErrorsWidget()
+
+	// Query detail pane
+	ui.setupDetailWidget()
 
 	// Stats table
 	ui.statsTable = widgets.NewTable()
@@ -74,6 +179,7 @@ func (ui *UI) setupWidgets() {
 	ui.statsTable.TextStyle = termui.NewStyle(termui.ColorWhite)
 	ui.statsTable.BorderStyle = termui.NewStyle(termui.ColorGreen)
 	ui.statsTable.RowSeparator = true
+	ui.statsTable.Rows = [][]string{{"Metric", "Value"}}
 
 	// Info box
 	ui.infoBox = widgets.NewParagraph()
@@ -84,7 +190,7 @@ func (ui *UI) setupWidgets() {
 	// Help box
 	ui.helpBox = widgets.NewParagraph()
 	ui.helpBox.Title = "Controls"
-	ui.helpBox.Text = "q: quit | s: sort | r: reverse | h: help | +/-: refresh rate"
+	ui.helpBox.Text = ui.helpText()
 	ui.helpBox.TextStyle = termui.NewStyle(termui.ColorWhite)
 	ui.helpBox.BorderStyle = termui.NewStyle(termui.ColorRed)
 }
@@ -95,16 +201,61 @@ func (ui *UI) setupGrid() {
 	termWidth, termHeight := termui.TerminalDimensions()
 	ui.grid.SetRect(0, 0, termWidth, termHeight)
 
+	body := []interface{}{ui.processList}
+	if ui.detailProcess != nil {
+		body = []interface{}{ui.detailPane}
+	} else if ui.view == ViewTables {
+		body = []interface{}{ui.tablesTable}
+	} else if ui.view == ViewLocks {
+		body = []interface{}{ui.locksList}
+	} else if ui.view == ViewReplication {
+		body = []interface{}{ui.replicationPane}
+	} else if ui.view == ViewStatements {
+		body = []interface{}{ui.statementsTable}
+	} else if ui.view == ViewErrors {
+		body = []interface{}{ui.errorsList}
+	} else if ui.view == ViewWaits {
+		body = []interface{}{
+			termui.NewCol(0.55, ui.waitsTable),
+			termui.NewCol(0.45,
+				termui.NewRow(0.8, ui.activeSessionsPlot),
+				termui.NewRow(0.2, ui.activeSessionsLegend),
+			),
+		}
+	} else if ui.view == ViewHistory {
+		body = []interface{}{
+			termui.NewCol(0.5,
+				termui.NewRow(0.5, ui.historyPlots[0]),
+				termui.NewRow(0.5, ui.historyPlots[2]),
+			),
+			termui.NewCol(0.5,
+				termui.NewRow(0.5, ui.historyPlots[1]),
+				termui.NewRow(0.5, ui.historyPlots[3]),
+			),
+		}
+	}
+
 	ui.grid.Set(
 		termui.NewRow(0.25,
-			termui.NewCol(0.5, ui.infoBox),
-			termui.NewCol(0.5, ui.statsTable),
+			termui.NewCol(0.34, ui.infoBox),
+			termui.NewCol(0.33, ui.statsTable),
+			termui.NewCol(0.33, ui.sparklines),
 		),
 		termui.NewRow(0.05, ui.helpBox),
-		termui.NewRow(0.7, ui.processList),
+		termui.NewRow(0.7, body...),
 	)
 }
 
+// setView switches the panel shown below the statistics, unless the
+// server does not support the view
+func (ui *UI) setView(view View) {
+	if !ui.supports(viewCapabilities[view]) {
+		return
+	}
+	ui.view = view
+	ui.setupGrid()
+}
+
 // sortProcesses sorts the processes based on the current sort field
 func (ui *UI) sortProcesses() {
 	sort.Slice(ui.processes, func(i, j int) bool {
@@ -122,6 +273,8 @@ func (ui *UI) sortProcesses() {
 			result = ui.processes[i].Time < ui.processes[j].Time
 		case SortByState:
 			result = ui.processes[i].State < ui.processes[j].State
+		case SortByTransaction:
+			result = ui.processes[i].TransactionTime < ui.processes[j].TransactionTime
 		}
 		if ui.sortDescending {
 			return !result
@@ -132,15 +285,63 @@ func (ui *UI) sortProcesses() {
 
 // Update refreshes the UI with new statistics
 func (ui *UI) Update(stats *stats.DatabaseStats) {
+	ui.stats = stats
+	ui.extendStatementBaseline(stats)
+
+	// Store and sort processes
+	ui.processes = stats.Processes
+	ui.sortProcesses()
+
+	// Store and sort tables
+	ui.tables = stats.Tables
+	ui.trackTables(ui.tables)
+	ui.sortTables()
+
+	// Remember the active sessions for the wait class chart
+	ui.trackActiveSessions(stats)
+
+	ui.Render()
+}
+
+// Render redraws the UI from the most recent statistics
+func (ui *UI) Render() {
+	if ui.stats == nil {
+		ui.infoBox.Text = fmt.Sprintf("Instance: %s\nType: %s\nWaiting for data...", ui.instanceName, ui.serverType())
+		if summary := ui.connectionSummary(); summary != "" {
+			ui.infoBox.Text += "\n" + summary
+		}
+		if ui.notice != "" {
+			ui.infoBox.Text += "\n" + ui.notice
+		}
+		ui.renderErrors()
+		ui.renderHelp()
+		termui.Clear()
+		termui.Render(ui.grid)
+		return
+	}
+	stats := ui.stats
+
 	// Update info box
 	ui.infoBox.Text = fmt.Sprintf(
-		"Instance: %s\nType: %s\nUptime: %s\nActive Connections: %d\nRefresh: %v",
+		"Instance: %s\nType: %s\nUptime: %s\n%s\nRefresh: %v",
 		ui.instanceName,
-		ui.dbType,
+		ui.serverType(),
 		stats.Uptime.String(),
-		stats.ActiveConnections,
+		highlight(fmt.Sprintf("Active Connections: %d", stats.ActiveConnections), ui.alertStatus.Fields["active_connections"]),
 		ui.refreshInterval,
 	)
+	if stats.Replication != nil {
+		ui.infoBox.Text += "\n" + highlight(replicationSummary(stats.Replication), ui.alertStatus.Fields["replication_lag"])
+	}
+	if summary := alertsSummary(ui.alertStatus.Firing); summary != "" {
+		ui.infoBox.Text += "\n" + summary
+	}
+	if summary := ui.connectionSummary(); summary != "" {
+		ui.infoBox.Text += "\n" + summary
+	}
+	if ui.notice != "" {
+		ui.infoBox.Text += "\n" + ui.notice
+	}
 
 	// Update stats table
 	ui.statsTable.Rows = [][]string{
@@ -151,36 +352,92 @@ func (ui *UI) Update(stats *stats.DatabaseStats) {
 		{"Threads Running", strconv.FormatInt(stats.Threads.Running, 10)},
 		{"Threads Connected", strconv.FormatInt(stats.Threads.Connected, 10)},
 		{"Threads Sleeping", strconv.FormatInt(stats.Threads.Sleeping, 10)},
+		{"Threads Locked", strconv.FormatInt(stats.Threads.Locked, 10)},
 	}
-
-	// Store and sort processes
-	ui.processes = stats.Processes
-	ui.sortProcesses()
+	ui.highlightStats()
 
 	// Update process list with dynamic height
 	_, termHeight := termui.TerminalDimensions()
 	maxProcesses := int(float64(termHeight) * 0.6) // Use 60% of terminal height for processes
 
-	if len(ui.processes) > maxProcesses {
-		ui.processes = ui.processes[:maxProcesses]
+	processes := ui.processes
+	if len(processes) > maxProcesses {
+		processes = processes[:maxProcesses]
 	}
 
 	var processLines []string
-	for _, process := range ui.processes {
+	for _, process := range processes {
+		command := process.Command
+		if command == "" {
+			command = process.BackendType
+		}
 		line := fmt.Sprintf("[%d] %s@%s - %s (%s) - %s",
-			process.ID, process.User, process.Host, process.Database, process.Command, process.State)
+			process.ID, process.User, process.Host, process.Database, command, process.State)
 		if process.Time > 0 {
 			line += fmt.Sprintf(" [%ds]", process.Time)
 		}
-		processLines = append(processLines, line)
+		if process.TransactionTime > 0 {
+			line += fmt.Sprintf(" [xact %ds]", process.TransactionTime)
+		}
+		if process.WaitEventType != "" {
+			line += fmt.Sprintf(" wait: %s/%s", process.WaitEventType, process.WaitEvent)
+		}
+		processLines = append(processLines, highlight(line, ui.alertStatus.Processes[process.ID]))
 	}
 	ui.processList.Rows = processLines
+	ui.visibleProcesses = processes
+	ui.restoreSelection()
+
+	// Update the other views and the query detail pane
+	ui.renderTables()
+	ui.renderLocks()
+	ui.renderReplication()
+	ui.renderStatements()
+	ui.renderWaits()
+	ui.renderHistory()
+	ui.renderErrors()
+	ui.renderDetail()
+
+	// Update the controls, prompt, or status message
+	ui.renderHelp()
 
 	// Render the UI
 	termui.Clear()
 	termui.Render(ui.grid)
 }
 
+// Resize adjusts the grid to the new terminal dimensions
+func (ui *UI) Resize(width, height int) {
+	ui.grid.SetRect(0, 0, width, height)
+	ui.Render()
+}
+
+// RefreshInterval returns the currently selected refresh interval
+func (ui *UI) RefreshInterval() time.Duration {
+	return ui.refreshInterval
+}
+
+// SetNotice shows an extra line in the connection info box, e.g. the
+// position of a replay. An empty notice removes the line.
+func (ui *UI) SetNotice(notice string) {
+	ui.notice = notice
+}
+
+// SetReplay marks the UI as showing a recording. Killing, cancelling,
+// explaining, and changing the refresh rate need a live server, so their
+// keys then only report that they are unavailable.
+func (ui *UI) SetReplay() {
+	ui.replay = true
+}
+
+// liveKeys are the keys that act on a live server
+var liveKeys = map[string]bool{"k": true, "c": true, "e": true, "+": true, "-": true}
+
+// SetHelp replaces the list of controls shown in the help box
+func (ui *UI) SetHelp(help string) {
+	ui.help = help
+}
+
 // Close cleans up the UI
 func (ui *UI) Close() {
 	termui.Close()
@@ -188,17 +445,142 @@ func (ui *UI) Close() {
 
 // HandleKey handles keyboard input
 func (ui *UI) HandleKey(key string) bool {
+	if key == "<C-c>" {
+		return false // Exit
+	}
+	if ui.pending != nil {
+		ui.handleConfirmation(key)
+		return true
+	}
+	ui.status = ""
+	if ui.replay && liveKeys[key] {
+		ui.status = "Not available when replaying a recording"
+		return true
+	}
+
+	if ui.detailProcess != nil {
+		switch key {
+		case "<Enter>", "<Escape>":
+			ui.closeDetail()
+			return true
+		case "e":
+			if ui.supports(stats.CapExplain) {
+				ui.explainDetail()
+			}
+			return true
+		case "<Up>", "<Down>", "<PageUp>", "<PageDown>", "<Home>":
+			ui.scrollDetail(key)
+			return true
+		}
+	}
+
 	switch key {
-	case "q", "<C-c>":
+	case "q":
 		return false // Exit
+	case "<Up>", "<Down>", "<PageUp>", "<PageDown>", "<Home>", "<End>":
+		switch ui.view {
+		case ViewProcesses:
+			ui.moveSelection(key)
+		case ViewLocks:
+			ui.moveLockSelection(key)
+		}
+	case "<Enter>":
+		switch ui.view {
+		case ViewProcesses:
+			ui.openDetail()
+		case ViewLocks:
+			ui.jumpToBlocker()
+		}
+	case "e":
+		if ui.view == ViewProcesses && ui.supports(stats.CapExplain) && ui.openDetail() {
+			ui.explainDetail()
+		}
+	case "k":
+		switch ui.view {
+		case ViewProcesses:
+			ui.requestAction(ActionKill)
+		case ViewLocks:
+			ui.killBlocker()
+		}
+	case "c":
+		if ui.view == ViewProcesses {
+			ui.requestAction(ActionCancel)
+		}
 	case "s":
-		// Cycle through sort fields
-		ui.sortField = (ui.sortField + 1) % 6
-		ui.sortProcesses()
+		// Cycle through sort fields of the current view
+		if ui.view == ViewTables {
+			ui.tableSortField = (ui.tableSortField + 1) % TableSortField(len(tableColumns))
+			ui.sortTables()
+		} else {
+			ui.sortField = (ui.sortField + 1) % sortFieldCount
+			ui.sortProcesses()
+		}
 	case "r":
-		// Reverse sort order
-		ui.sortDescending = !ui.sortDescending
-		ui.sortProcesses()
+		// Reverse sort order of the current view
+		if ui.view == ViewTables {
+			ui.tableSortDescending = !ui.tableSortDescending
+			ui.sortTables()
+		} else {
+			ui.sortDescending = !ui.sortDescending
+			ui.sortProcesses()
+		}
+	case "t":
+		// Toggle between the process list and the tables view
+		if ui.view == ViewTables {
+			ui.setView(ViewProcesses)
+		} else {
+			ui.setView(ViewTables)
+		}
+	case "l":
+		// Toggle between the process list and the lock waits view
+		if ui.view == ViewLocks {
+			ui.setView(ViewProcesses)
+		} else {
+			ui.setView(ViewLocks)
+		}
+	case "p":
+		// Toggle between the process list and the replication view
+		if ui.view == ViewReplication {
+			ui.setView(ViewProcesses)
+		} else {
+			ui.setView(ViewReplication)
+		}
+	case "d":
+		// Toggle between the process list and the top statements view
+		if ui.view == ViewStatements {
+			ui.setView(ViewProcesses)
+		} else {
+			ui.setView(ViewStatements)
+		}
+	case "w":
+		// Toggle between the process list and the wait events view
+		if ui.view == ViewWaits {
+			ui.setView(ViewProcesses)
+		} else {
+			ui.setView(ViewWaits)
+		}
+	case "h":
+		// Toggle between the process list and the history charts
+		if ui.view == ViewHistory {
+			ui.setView(ViewProcesses)
+		} else {
+			ui.setView(ViewHistory)
+		}
+	case "E":
+		// Toggle between the process list and the error log
+		if ui.view == ViewErrors {
+			ui.setView(ViewProcesses)
+		} else {
+			ui.setView(ViewErrors)
+		}
+	case "z":
+		if ui.view == ViewStatements {
+			ui.resetStatementBaseline()
+		}
+	case "Z":
+		if ui.view == ViewStatements {
+			ui.clearStatementBaseline()
+		}
 	case "+":
 		// Increase refresh rate
 		if ui.refreshInterval > 500*time.Millisecond {
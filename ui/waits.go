@@ -0,0 +1,288 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dbtop/monitor/stats"
+
+	"github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// maxActiveSessionSamples is the number of snapshots the active sessions
+// chart keeps
+const maxActiveSessionSamples = 300
+
+// waitColumns are the headers of the wait events table. All numbers are
+// the increase since the previous refresh.
+var waitColumns = []string{"Event", "Class", "Waits", "Time", "Avg"}
+
+// chartColor is the color of a line in the active sessions chart, with
+// its name for styled legend text
+type chartColor struct {
+	color termui.Color
+	name  string
+}
+
+// chartColors are the colors of the busiest wait classes in the active
+// sessions chart. The remaining classes are drawn together.
+var chartColors = []chartColor{
+	{termui.ColorGreen, "green"},
+	{termui.ColorBlue, "blue"},
+	{termui.ColorCyan, "cyan"},
+	{termui.ColorRed, "red"},
+	{termui.ColorMagenta, "magenta"},
+	{termui.ColorYellow, "yellow"},
+}
+
+// activeSessionSample is the number of active sessions per wait class in
+// one snapshot
+type activeSessionSample struct {
+	timestamp time.Time
+	classes   map[string]int
+}
+
+// setupWaitsWidgets initializes the wait events view
+func (ui *UI) setupWaitsWidgets() {
+	ui.waitsTable = widgets.NewTable()
+	ui.waitsTable.Title = "Top Wait Events per Interval (Press 'w' for processes)"
+	ui.waitsTable.TextStyle = termui.NewStyle(termui.ColorWhite)
+	ui.waitsTable.BorderStyle = termui.NewStyle(termui.ColorBlue)
+	ui.waitsTable.RowSeparator = false
+	ui.waitsTable.TextAlignment = termui.AlignLeft
+	ui.waitsTable.RowStyles = map[int]termui.Style{
+		0: termui.NewStyle(termui.ColorWhite, termui.ColorClear, termui.ModifierBold),
+	}
+	ui.waitsTable.Rows = [][]string{waitColumns}
+
+	ui.activeSessionsPlot = widgets.NewPlot()
+	ui.activeSessionsPlot.Title = "Active Sessions by Wait Class"
+	ui.activeSessionsPlot.BorderStyle = termui.NewStyle(termui.ColorBlue)
+	ui.activeSessionsPlot.Data = [][]float64{{0, 0}}
+
+	ui.activeSessionsLegend = widgets.NewParagraph()
+	ui.activeSessionsLegend.Title = "Average Active Sessions"
+	ui.activeSessionsLegend.BorderStyle = termui.NewStyle(termui.ColorBlue)
+}
+
+// trackActiveSessions adds the active sessions of a snapshot to the chart.
+// Going back in time, as when seeking in a replay, starts a new chart.
+func (ui *UI) trackActiveSessions(snapshot *stats.DatabaseStats) {
+	if n := len(ui.activeSessionSamples); n > 0 && snapshot.Timestamp.Before(ui.activeSessionSamples[n-1].timestamp) {
+		ui.activeSessionSamples = nil
+	}
+
+	sample := activeSessionSample{timestamp: snapshot.Timestamp, classes: make(map[string]int)}
+	for _, session := range snapshot.ActiveSessions {
+		sample.classes[session.WaitClass]++
+	}
+	ui.activeSessionSamples = append(ui.activeSessionSamples, sample)
+
+	if len(ui.activeSessionSamples) > maxActiveSessionSamples {
+		ui.activeSessionSamples = ui.activeSessionSamples[len(ui.activeSessionSamples)-maxActiveSessionSamples:]
+	}
+}
+
+// renderWaits fills the wait events table and the active sessions chart
+func (ui *UI) renderWaits() {
+	ui.renderWaitEvents()
+	ui.renderActiveSessions()
+}
+
+// renderWaitEvents fills the wait events table, ranked by the time waited
+// in the last interval. Without wait event statistics it shows a summary
+// of the current sessions instead.
+func (ui *UI) renderWaitEvents() {
+	width := ui.waitsTable.Inner.Dx()
+	ui.waitsTable.Title = "Top Wait Events per Interval (Press 'w' for processes)"
+	ui.waitsTable.RowStyles = map[int]termui.Style{
+		0: termui.NewStyle(termui.ColorWhite, termui.ColorClear, termui.ModifierBold),
+	}
+
+	if ui.stats != nil && len(ui.stats.WaitEvents) == 0 && len(ui.stats.SessionGroups) > 0 {
+		ui.renderSessionSummary()
+		return
+	}
+	if ui.stats == nil || len(ui.stats.WaitEvents) == 0 {
+		ui.waitsTable.Rows = [][]string{{"No wait event statistics available for this database"}}
+		ui.waitsTable.ColumnWidths = []int{max(width, 1)}
+		return
+	}
+
+	events := make([]stats.WaitEvent, len(ui.stats.WaitEvents))
+	copy(events, ui.stats.WaitEvents)
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Delta.Time != events[j].Delta.Time {
+			return events[i].Delta.Time > events[j].Delta.Time
+		}
+		return events[i].Total.Time > events[j].Total.Time
+	})
+
+	rows := [][]string{waitColumns}
+	for _, event := range events {
+		avg := "-"
+		if event.Delta.Waits > 0 {
+			avg = formatMillis(event.Delta.Time / float64(event.Delta.Waits))
+		}
+		rows = append(rows, []string{
+			event.Event,
+			event.WaitClass,
+			strconv.FormatInt(event.Delta.Waits, 10),
+			formatMillis(event.Delta.Time),
+			avg,
+		})
+	}
+	ui.waitsTable.Rows = rows
+
+	eventWidth := max(width-14-3*10, 20)
+	ui.waitsTable.ColumnWidths = []int{eventWidth, 14, 10, 10, 10}
+}
+
+// renderSessionSummary fills the wait events table with the number of
+// sessions per wait event, backend type, and state
+func (ui *UI) renderSessionSummary() {
+	ui.waitsTable.Title = "Sessions by Wait Event, Backend Type, and State (Press 'w' for processes)"
+
+	waits := make(map[[2]string]int64)
+	backends := make(map[string]int64)
+	states := make(map[string]int64)
+	for _, group := range ui.stats.SessionGroups {
+		backends[group.BackendType] += group.Count
+		if group.State != "" {
+			states[group.State] += group.Count
+		}
+		// Idle sessions wait for the client, which is not worth listing
+		if group.State == "idle" {
+			continue
+		}
+		class, event := group.WaitEventType, group.WaitEvent
+		if class == "" {
+			if group.State != "active" {
+				continue
+			}
+			class, event = "CPU", "ON CPU"
+		}
+		waits[[2]string{class, event}] += group.Count
+	}
+
+	rows := [][]string{{"Wait Class", "Event", "Sessions"}}
+	for _, key := range sortedCounts(waits) {
+		rows = append(rows, []string{key[0], key[1], strconv.FormatInt(waits[key], 10)})
+	}
+
+	section := func(title string, counts map[string]int64) {
+		rows = append(rows, []string{"", "", ""})
+		ui.waitsTable.RowStyles[len(rows)] = ui.waitsTable.RowStyles[0]
+		rows = append(rows, []string{title, "", "Sessions"})
+
+		keyed := make(map[[2]string]int64, len(counts))
+		for name, count := range counts {
+			keyed[[2]string{name}] = count
+		}
+		for _, key := range sortedCounts(keyed) {
+			rows = append(rows, []string{key[0], "", strconv.FormatInt(counts[key[0]], 10)})
+		}
+	}
+	section("Backend Type", backends)
+	section("State", states)
+
+	ui.waitsTable.Rows = rows
+	firstWidth := max(ui.waitsTable.Inner.Dx()-10-24, 20)
+	ui.waitsTable.ColumnWidths = []int{firstWidth, 24, 10}
+}
+
+// sortedCounts returns the keys of counts, largest count first
+func sortedCounts(counts map[[2]string]int64) [][2]string {
+	keys := make([][2]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i][0]+keys[i][1] < keys[j][0]+keys[j][1]
+	})
+	return keys
+}
+
+// renderActiveSessions draws one line per wait class with the number of
+// active sessions in each snapshot, and their averages in the legend
+func (ui *UI) renderActiveSessions() {
+	samples := ui.activeSessionSamples
+
+	// One point per column of the plot area, which is the inner width
+	// minus the y axis labels
+	if points := ui.activeSessionsPlot.Inner.Dx() - 5; points > 1 && len(samples) > points {
+		samples = samples[len(samples)-points:]
+	}
+
+	// Give the busiest classes their own line and draw the rest together
+	totals := make(map[[2]string]int64)
+	for _, sample := range samples {
+		for class, count := range sample.classes {
+			totals[[2]string{class}] += int64(count)
+		}
+	}
+	const rest = "Other classes"
+	classes := sortedCounts(totals)
+	lines := make(map[string]string) // chart line of each wait class
+	var names []string
+	for i, key := range classes {
+		if i < len(chartColors) {
+			lines[key[0]] = key[0]
+			names = append(names, key[0])
+		} else {
+			lines[key[0]] = rest
+		}
+	}
+	if len(classes) > len(chartColors) {
+		names = append(names, rest)
+	}
+
+	var data [][]float64
+	var colors []termui.Color
+	var legend []string
+	peak := 1.0
+	for i, name := range names {
+		series := make([]float64, len(samples))
+		total := 0.0
+		for j, sample := range samples {
+			for class, count := range sample.classes {
+				if lines[class] == name {
+					series[j] += float64(count)
+				}
+			}
+			total += series[j]
+			peak = max(peak, series[j])
+		}
+		// A line needs at least two points
+		if len(series) == 1 {
+			series = append(series, series[0])
+		}
+
+		color := chartColor{termui.ColorWhite, "white"}
+		if i < len(chartColors) {
+			color = chartColors[i]
+		}
+		data = append(data, series)
+		colors = append(colors, color.color)
+		legend = append(legend, fmt.Sprintf("[%s %.2f](fg:%s)", name, total/float64(len(samples)), color.name))
+	}
+
+	if len(data) == 0 {
+		data = [][]float64{{0, 0}}
+		colors = []termui.Color{termui.ColorWhite}
+		legend = []string{"No active sessions sampled"}
+	}
+
+	ui.activeSessionsPlot.Data = data
+	ui.activeSessionsPlot.LineColors = colors
+	ui.activeSessionsPlot.MaxVal = peak
+	ui.activeSessionsPlot.Title = fmt.Sprintf("Active Sessions by Wait Class (last %d samples)", len(samples))
+	ui.activeSessionsLegend.Text = strings.Join(legend, "  ")
+}